@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+)
+
+// redacted replaces secret values in the /admin/config response.
+const redacted = "<redacted>"
+
+// runtimeVars are set by the Lambda runtime rather than the deployment and
+// left out of /admin/config; AWS_* also holds the role’s credentials.
+var runtimeVars = map[string]bool{
+	"PATH": true, "LANG": true, "TZ": true, "LD_LIBRARY_PATH": true, "HOME": true, "PWD": true, "SHLVL": true,
+}
+
+// secretVar reports whether the variable’s value is a credential, judged by
+// its name: tokens, secrets, keys, webhooks and the settings that embed them
+// (inline user and tenant lists, extra headers, the refresh hook URL with its
+// token, the Pushover user key). ARNs, key IDs and durations named after a
+// token are not.
+func secretVar(name string) bool {
+	for _, suffix := range []string{"_ARN", "_KEY_ID", "_TTL", "_DAYS", "_AFTER"} {
+		if strings.HasSuffix(name, suffix) {
+			return false
+		}
+	}
+	for _, part := range []string{"TOKEN", "SECRET", "PASSWORD", "API_KEY", "ROUTING_KEY", "WEBHOOK"} {
+		if strings.Contains(name, part) {
+			return true
+		}
+	}
+	switch name {
+	case "CONFIG_JSON", "HTB_HEADERS", "TENANTS", "REFRESH_URL", "PUSHOVER_USER":
+		return true
+	}
+	return false
+}
+
+// redactSetting hides a secret variable entirely and strips the user info
+// and query string, where credentials are passed, from any other URL.
+func redactSetting(name, value string) string {
+	if secretVar(name) {
+		return redacted
+	}
+	if u, err := url.Parse(value); err == nil && u.Scheme != "" && u.Host != "" {
+		u.User, u.RawQuery, u.ForceQuery, u.Fragment = nil, "", false, ""
+		return u.String()
+	}
+	return value
+}
+
+// settingOrigin tells where a variable’s current value came from: an SSM
+// parameter, CONFIG_FILE, or the function’s own environment.
+func settingOrigin(name, value string) string {
+	ssmMutex.Lock()
+	fromSSM, ok := ssmValues[name]
+	ssmMutex.Unlock()
+	if ok && fromSSM == value {
+		return "ssm"
+	}
+	configMutex.Lock()
+	fromFile, ok := configValues[name]
+	configMutex.Unlock()
+	if ok && fromFile == value {
+		return "file"
+	}
+	return "env"
+}
+
+// effectiveEnvironment lists the deployment’s variables, after CONFIG_FILE
+// and SSM were applied, with their origin and secrets redacted.
+func effectiveEnvironment() map[string]interface{} {
+	vars := map[string]interface{}{}
+	for _, kv := range os.Environ() {
+		name, value, _ := strings.Cut(kv, "=")
+		if runtimeVars[name] || strings.HasPrefix(name, "AWS_") || strings.HasPrefix(name, "LAMBDA_") || strings.HasPrefix(name, "_") {
+			continue
+		}
+		vars[name] = map[string]string{"value": redactSetting(name, value), "source": settingOrigin(name, value)}
+	}
+	return vars
+}
+
+// effectiveUsers lists the stored user entries with their tokens redacted.
+func effectiveUsers() []userConfig {
+	usersMutex.RLock()
+	defer usersMutex.RUnlock()
+	out := make([]userConfig, 0, len(userOrder))
+	for _, id := range userOrder {
+		c := userConfigs[id]
+		if c.Token != "" {
+			c.Token = redacted
+		}
+		if c.EncryptedToken != "" {
+			c.EncryptedToken = redacted
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+// adminConfigHandler serves /admin/config: the configuration the function is
+// actually running with — every variable and where it came from, the users,
+// tenants, notifiers, routes, rules and milestones as parsed, and the derived
+// settings — authenticated like /hooks/refresh. Secrets are never returned.
+func adminConfigHandler(ctx context.Context, inv invocation) (map[string]interface{}, error) {
+	if !hookAuthorized(inv) {
+		return httpResponse(http.StatusUnauthorized, map[string]string{"error": "unauthorized"}), nil
+	}
+
+	var notifiers []string
+	for _, n := range configuredNotifiers() {
+		notifiers = append(notifiers, n.Name())
+	}
+	sort.Strings(notifiers)
+	var tenantList []map[string]interface{}
+	for _, t := range loadTenants() {
+		tenantList = append(tenantList, map[string]interface{}{"name": t.Name, "users": t.Users, "daily_quota": t.DailyQuota})
+	}
+
+	return httpResponse(http.StatusOK, map[string]interface{}{
+		"environment":  effectiveEnvironment(),
+		"users":        configuredUsers(),
+		"user_configs": effectiveUsers(),
+		"tenants":      tenantList,
+		"notifiers":    notifiers,
+		"routes":       loadRoutes(),
+		"rules":        loadRules(),
+		"milestones":   loadMilestones(),
+		"settings": map[string]interface{}{
+			"key_prefix":       envKey(""),
+			"timezone":         dateLocation().String(),
+			"today":            currentDate(),
+			"refresh_interval": refreshInterval().String(),
+			"htb_api":          htbAPI(""),
+			"http_timeout":     htbTimeout().String(),
+			"max_retries":      htbRetries(),
+			"backoff_base":     htbBackoff().String(),
+			"htb_rate_limit":   htbRateLimit(),
+			"failure_ttl":      failureTTL().String(),
+			"cache_ttl":        cacheTTL().String(),
+			"refresh_retries":  refreshRetries(),
+			"htb_probe_ttl":    probeTTL().String(),
+			"log_level":        logLevel.Level().String(),
+			"skip_fetch":       splitList(os.Getenv("SKIP_FETCH")),
+			"public_fields":    splitList(os.Getenv("PUBLIC_FIELDS")),
+		},
+	}), nil
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"os"
+	"time"
+)
+
+// periodStats summarises the snapshots of one week or month.
+type periodStats struct {
+	Period     string  `json:"period"`
+	From       string  `json:"from"`
+	To         string  `json:"to"`
+	Days       int     `json:"days"`
+	MinRank    int     `json:"min_rank,omitempty"`
+	MaxRank    int     `json:"max_rank,omitempty"`
+	AvgRank    float64 `json:"avg_rank,omitempty"`
+	OwnsGained int     `json:"owns_gained"`
+
+	rankSum   float64
+	rankCount int
+}
+
+// periodKey labels the week ("2024-W05", ISO weeks) or month ("2024-01")
+// that d falls in.
+func periodKey(period string, d time.Time) string {
+	if period == "week" {
+		year, week := d.ISOWeek()
+		return fmt.Sprintf("%d-W%02d", year, week)
+	}
+	return d.Format("2006-01")
+}
+
+// aggregate groups a date‑ordered series into periods. The global rank is
+// summarised as min/max/average; owns gained are counted against the previous
+// snapshot, even when that one falls in the period before.
+func aggregate(points []map[string]interface{}, period string) []*periodStats {
+	var out []*periodStats
+	var cur *periodStats
+	var lastOwns float64
+	haveOwns := false
+	for _, p := range points {
+		date := p["date"].(string)
+		d, err := time.Parse("2006-01-02", date)
+		if err != nil {
+			continue
+		}
+		if key := periodKey(period, d); cur == nil || cur.Period != key {
+			cur = &periodStats{Period: key, From: date}
+			out = append(out, cur)
+		}
+		cur.To = date
+		cur.Days++
+
+		if rank, ok := toFloat(p["User_Global_Rank"]); ok && rank > 0 {
+			if cur.rankCount == 0 || int(rank) < cur.MinRank {
+				cur.MinRank = int(rank)
+			}
+			if int(rank) > cur.MaxRank {
+				cur.MaxRank = int(rank)
+			}
+			cur.rankSum += rank
+			cur.rankCount++
+			cur.AvgRank = math.Round(cur.rankSum/float64(cur.rankCount)*10) / 10
+		}
+		if owns, ok := totalOwns(p); ok {
+			if haveOwns {
+				cur.OwnsGained += int(owns - lastOwns)
+			}
+			lastOwns, haveOwns = owns, true
+		}
+	}
+	return out
+}
+
+// aggregateHandler serves /history/aggregate?period=week|month[&from=&to=]
+// [&user=ID]: rank and owns statistics per calendar week or month.
+func aggregateHandler(ctx context.Context, inv invocation) (map[string]interface{}, error) {
+	tableName := os.Getenv("TABLE_NAME")
+	if tableName == "" {
+		return httpResponse(http.StatusInternalServerError, map[string]string{"error": "TABLE_NAME not configured"}), nil
+	}
+	period := inv.QueryParams["period"]
+	if period == "" {
+		period = "week"
+	}
+	if period != "week" && period != "month" {
+		return httpResponse(http.StatusBadRequest, map[string]string{"error": "period must be week or month"}), nil
+	}
+	from, to, err := dateRange(inv, 90)
+	if err != nil {
+		return httpResponse(http.StatusBadRequest, map[string]string{"error": err.Error()}), nil
+	}
+	user, ok := requestedUser(inv)
+	if !ok {
+		return httpResponse(http.StatusNotFound, map[string]string{"error": "unknown user"}), nil
+	}
+	// the rank statistics are left out when User_Global_Rank is private
+	if denied := requireVisible(inv, "System_Owns", "User_Owns"); denied != nil {
+		return denied, nil
+	}
+
+	items, err := loadRange(ctx, tableName, user, from, to)
+	if err != nil {
+		slog.ErrorContext(ctx, "BatchGetItem failed", "region", awsRegion, "table", tableName, "error", err)
+		return httpResponse(http.StatusInternalServerError, map[string]string{"error": "Database lookup failed", "detail": err.Error()}), nil
+	}
+	return httpResponse(http.StatusOK, map[string]interface{}{
+		"user":    user,
+		"from":    from.Format("2006-01-02"),
+		"to":      to.Format("2006-01-02"),
+		"period":  period,
+		"periods": aggregate(visibleSeries(inv, series(items)), period),
+	}), nil
+}
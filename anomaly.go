@@ -0,0 +1,101 @@
+package main
+
+import (
+	"math"
+	"os"
+	"strconv"
+)
+
+// anomalyField is the Change.Field of a data‑quality notice: a stat that
+// moved implausibly between two snapshots.
+const anomalyField = "Anomaly"
+
+// countFields can only grow; any decrease is reported as an anomaly.
+var countFields = []string{"System_Owns", "User_Owns", "System_Bloods", "User_Bloods", "Challenge_Owns"}
+
+// anomalyThreshold is the relative day‑over‑day rank movement treated as
+// suspicious, from ANOMALY_THRESHOLD (a fraction, default 0.2 = 20%).
+func anomalyThreshold() float64 {
+	if f, err := strconv.ParseFloat(os.Getenv("ANOMALY_THRESHOLD"), 64); err == nil && f > 0 {
+		return f
+	}
+	return 0.2
+}
+
+// anomalyAlertsEnabled reports whether ANOMALY_ALERTS sends anomalies as
+// notifications in place of the suspicious changes.
+func anomalyAlertsEnabled() bool {
+	return os.Getenv("ANOMALY_ALERTS") == "true"
+}
+
+// detectAnomalies returns, keyed by stat, every rank that moved by more than
+// the threshold and every count that went down between prev and curr — the
+// typical signs of an HTB recalculation or a parsing bug.
+func detectAnomalies(prev, curr map[string]interface{}) map[string]Change {
+	anomalies := map[string]Change{}
+	if len(prev) <= 1 {
+		return anomalies
+	}
+	threshold := anomalyThreshold()
+	for _, field := range []string{"User_Global_Rank", "Local_Rank"} {
+		oldV, okOld := toFloat(prev[field])
+		newV, okNew := toFloat(curr[field])
+		if !okOld || !okNew || oldV <= 0 || newV <= 0 || field == "Local_Rank" && countryMoved(prev, curr) {
+			continue
+		}
+		if rel := (newV - oldV) / oldV; math.Abs(rel) > threshold {
+			anomalies[field] = Change{
+				Field:  anomalyField,
+				Old:    prev[field],
+				New:    curr[field],
+				Detail: tr("anomaly_jump", fieldLabel(notifyLocale(), field), formatValue(prev[field]), formatValue(curr[field]), int(math.Round(rel*100))),
+			}
+		}
+	}
+	for _, field := range countFields {
+		oldV, okOld := toFloat(prev[field])
+		newV, okNew := toFloat(curr[field])
+		if okOld && okNew && newV < oldV {
+			anomalies[field] = Change{
+				Field:  anomalyField,
+				Old:    prev[field],
+				New:    curr[field],
+				Detail: tr("anomaly_drop", fieldLabel(notifyLocale(), field), formatValue(prev[field]), formatValue(curr[field])),
+			}
+		}
+	}
+	return anomalies
+}
+
+// markAnomalies stores the anomalies found against prev on info, as
+// "Anomalies": [{field, old, new}], so suspicious snapshots can be told apart
+// in history and charts.
+func markAnomalies(prev, info map[string]interface{}) {
+	anomalies := detectAnomalies(prev, info)
+	if len(anomalies) == 0 {
+		return
+	}
+	var marks []interface{}
+	for _, field := range append([]string{"User_Global_Rank", "Local_Rank"}, countFields...) {
+		if a, ok := anomalies[field]; ok {
+			marks = append(marks, map[string]interface{}{"field": field, "old": a.Old, "new": a.New})
+		}
+	}
+	info["Anomalies"] = marks
+}
+
+// withoutAnomalies drops the changes to stats that moved implausibly and,
+// if ANOMALY_ALERTS is on, returns the matching anomaly notices to send
+// instead.
+func withoutAnomalies(changes []Change, anomalies map[string]Change) (kept, notices []Change) {
+	for _, c := range changes {
+		if a, ok := anomalies[c.Field]; ok {
+			if anomalyAlertsEnabled() {
+				notices = append(notices, a)
+			}
+			continue
+		}
+		kept = append(kept, c)
+	}
+	return kept, notices
+}
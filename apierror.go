@@ -0,0 +1,77 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// apiError is a failed request or action with the HTTP status it answers
+// with. It is returned as an error rather than as a 200 map with an "error"
+// key, so API Gateway error mapping and Lambda retries see the failure.
+type apiError struct {
+	code    int
+	msg     string
+	detail  string
+	retryAt time.Time
+}
+
+func (e *apiError) Error() string {
+	if e.detail == "" {
+		return e.msg
+	}
+	return e.msg + ": " + e.detail
+}
+
+func (e *apiError) status() int { return e.code }
+
+func (e *apiError) response() map[string]interface{} {
+	res := map[string]interface{}{"error": e.msg}
+	if e.detail != "" {
+		res["detail"] = e.detail
+	}
+	if !e.retryAt.IsZero() {
+		res["retry_at"] = e.retryAt.UTC().Format(time.RFC3339)
+	}
+	return res
+}
+
+// httpError is implemented by *apiError and *refreshError.
+type httpError interface {
+	error
+	status() int
+	response() map[string]interface{}
+}
+
+// errorResponse renders err as a Function URL response: its status, a
+// Retry-After header when it knows when to retry, and {"error", "detail", …}
+// as the body. Errors of other types answer 500.
+func errorResponse(err error) map[string]interface{} {
+	var he httpError
+	if !errors.As(err, &he) {
+		return httpResponse(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	res := httpResponse(he.status(), he.response())
+	var ae *apiError
+	if errors.As(err, &ae) && !ae.retryAt.IsZero() {
+		wait := int(time.Until(ae.retryAt).Seconds()) + 1
+		res["headers"].(map[string]string)["Retry-After"] = strconv.Itoa(max(wait, 1))
+	}
+	return res
+}
+
+// actionResult turns the {"error": …} map an action reports a failure with
+// into an *apiError, so the invocation fails and its trigger (EventBridge,
+// SQS, an async invoke) can retry it or send it to a dead‑letter queue. The
+// full map, e.g. the progress made before the failure, is logged.
+func actionResult(res map[string]interface{}, err error) (map[string]interface{}, error) {
+	msg, failed := res["error"].(string)
+	if err != nil || !failed {
+		return res, err
+	}
+	slog.Error("action failed", "result", res)
+	detail, _ := res["detail"].(string)
+	return nil, &apiError{code: http.StatusInternalServerError, msg: msg, detail: detail}
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// retentionDays is how many days of snapshots stay in DynamoDB, from
+// RETENTION_DAYS; 0 keeps everything.
+func retentionDays() int {
+	n, _ := strconv.Atoi(os.Getenv("RETENTION_DAYS"))
+	return max(n, 0)
+}
+
+// archiveEnabled reports whether old snapshots are moved to ARCHIVE_BUCKET.
+func archiveEnabled() bool {
+	return retentionDays() > 0 && os.Getenv("ARCHIVE_BUCKET") != ""
+}
+
+// archiveCutoff is the first day still kept in the table.
+func archiveCutoff() time.Time {
+	today := currentDay()
+	return today.AddDate(0, 0, -retentionDays())
+}
+
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
+
+// archiveKey is the S3 object holding userID’s snapshots for month (YYYY-MM).
+func archiveKey(userID, month string) string {
+	prefix := strings.Trim(os.Getenv("ARCHIVE_PREFIX"), "/")
+	if prefix == "" {
+		prefix = "htb-archive"
+	}
+	if userID == "" {
+		userID = os.Getenv("USER_ID")
+	}
+	if env := environment(); env != "" {
+		prefix += "/" + env
+	}
+	return fmt.Sprintf("%s/%s/%s.json.gz", prefix, userID, month)
+}
+
+// splitItemKey reverses itemKey, returning false for keys that aren’t daily
+// snapshots (throttle state, streaks, dedup claims, …) of this environment.
+func splitItemKey(key string) (userID, date string, ok bool) {
+	if key, ok = stripEnvKey(key); !ok {
+		return "", "", false
+	}
+	date = key
+	if i := strings.LastIndex(key, "#"); i >= 0 {
+		if userID, ok = prefixUser(key[:i]); !ok {
+			return "", "", false
+		}
+		date = key[i+1:]
+	}
+	if _, err := time.Parse("2006-01-02", date); err != nil {
+		return "", "", false
+	}
+	if userID == "" {
+		userID = os.Getenv("USER_ID")
+	}
+	return userID, date, true
+}
+
+// readArchive returns the snapshots stored in one archive object, keyed by
+// date, or an empty map if the object doesn’t exist.
+func readArchive(ctx context.Context, client *s3.Client, key string) (map[string]map[string]interface{}, error) {
+	items := map[string]map[string]interface{}{}
+	resp, err := client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(os.Getenv("ARCHIVE_BUCKET")),
+		Key:    aws.String(key),
+	})
+	var missing *s3types.NoSuchKey
+	if errors.As(err, &missing) {
+		return items, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	zr, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := io.ReadAll(zr)
+	if err != nil {
+		return nil, err
+	}
+	var list []map[string]interface{}
+	if err := json.Unmarshal(raw, &list); err != nil {
+		return nil, err
+	}
+	for _, item := range list {
+		if date, ok := item["date"].(string); ok {
+			items[date] = item
+		}
+	}
+	return items, nil
+}
+
+func writeArchive(ctx context.Context, client *s3.Client, key string, items map[string]map[string]interface{}) error {
+	dates := make([]string, 0, len(items))
+	for d := range items {
+		dates = append(dates, d)
+	}
+	sort.Strings(dates)
+	list := make([]map[string]interface{}, 0, len(dates))
+	for _, d := range dates {
+		list = append(list, items[d])
+	}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if err := json.NewEncoder(zw).Encode(list); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	_, err := client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:          aws.String(os.Getenv("ARCHIVE_BUCKET")),
+		Key:             aws.String(key),
+		Body:            bytes.NewReader(buf.Bytes()),
+		ContentType:     aws.String("application/json"),
+		ContentEncoding: aws.String("gzip"),
+	})
+	return err
+}
+
+// loadArchived reads userID’s archived snapshots between from and to, keyed
+// by date. loadRange calls it for the part of a range older than the cutoff.
+func loadArchived(ctx context.Context, userID string, from, to time.Time) (map[string]map[string]interface{}, error) {
+	client := s3.NewFromConfig(awsCfg)
+	out := map[string]map[string]interface{}{}
+	first := time.Date(from.Year(), from.Month(), 1, 0, 0, 0, 0, time.UTC)
+	for month := first; !month.After(to); month = month.AddDate(0, 1, 0) {
+		items, err := readArchive(ctx, client, archiveKey(userID, month.Format("2006-01")))
+		if err != nil {
+			return nil, err
+		}
+		for date, item := range items {
+			if date >= from.Format("2006-01-02") && date <= to.Format("2006-01-02") {
+				out[date] = item
+			}
+		}
+	}
+	return out, nil
+}
+
+// archiveSnapshots moves daily snapshots older than RETENTION_DAYS from the
+// table to gzipped JSON in ARCHIVE_BUCKET, one object per user and month,
+// merging with what an earlier run archived. Schedule it (e.g. weekly) with
+// {"action": "archive"}.
+func archiveSnapshots(ctx context.Context) (map[string]interface{}, error) {
+	tableName := os.Getenv("TABLE_NAME")
+	if tableName == "" {
+		return map[string]interface{}{"error": "TABLE_NAME not configured"}, nil
+	}
+	if !archiveEnabled() {
+		return map[string]interface{}{"error": "RETENTION_DAYS or ARCHIVE_BUCKET not configured"}, nil
+	}
+	cutoff := archiveCutoff().Format("2006-01-02")
+
+	// user → month → date → item, plus the keys to delete afterwards by table
+	old := map[string]map[string]map[string]map[string]interface{}{}
+	keys := map[string][]string{}
+	archived := 0
+	for _, table := range dataTables(tableName) {
+		paginator := dynamodb.NewScanPaginator(dynamoClient, &dynamodb.ScanInput{TableName: aws.String(table)})
+		for paginator.HasMorePages() {
+			page, err := paginator.NextPage(ctx)
+			if err != nil {
+				slog.ErrorContext(ctx, "Scan failed", "region", awsRegion, "table", table, "error", err)
+				return map[string]interface{}{"error": "Database scan failed", "detail": err.Error()}, nil
+			}
+			for _, raw := range page.Items {
+				var item map[string]interface{}
+				if err := attributevalue.UnmarshalMap(raw, &item); err != nil {
+					continue
+				}
+				key, _ := item["date"].(string)
+				user, date, ok := splitItemKey(key)
+				if !ok || date >= cutoff {
+					continue
+				}
+				item["date"] = date
+				month := date[:7]
+				if old[user] == nil {
+					old[user] = map[string]map[string]map[string]interface{}{}
+				}
+				if old[user][month] == nil {
+					old[user][month] = map[string]map[string]interface{}{}
+				}
+				old[user][month][date] = item
+				keys[table] = append(keys[table], key)
+				archived++
+			}
+		}
+	}
+
+	client := s3.NewFromConfig(awsCfg)
+	for user, months := range old {
+		for month, items := range months {
+			key := archiveKey(user, month)
+			existing, err := readArchive(ctx, client, key)
+			if err != nil {
+				slog.ErrorContext(ctx, "reading archive failed", "key", key, "error", err)
+				return map[string]interface{}{"error": "Error reading archive", "detail": err.Error()}, nil
+			}
+			for date, item := range items {
+				existing[date] = item
+			}
+			if err := writeArchive(ctx, client, key, existing); err != nil {
+				slog.ErrorContext(ctx, "writing archive failed", "key", key, "error", err)
+				return map[string]interface{}{"error": "Error writing archive", "detail": err.Error()}, nil
+			}
+		}
+	}
+
+	// only delete once every month is safely in S3
+	for table, tableKeys := range keys {
+		if err := deleteItems(ctx, table, tableKeys); err != nil {
+			slog.ErrorContext(ctx, "BatchWriteItem failed", "region", awsRegion, "table", table, "error", err)
+			return map[string]interface{}{"error": "Error deleting archived items", "detail": err.Error()}, nil
+		}
+	}
+	return map[string]interface{}{"archived": archived, "cutoff": cutoff}, nil
+}
+
+// deleteItems removes the given table keys, 25 per BatchWriteItem call.
+func deleteItems(ctx context.Context, tableName string, keys []string) error {
+	for len(keys) > 0 {
+		n := min(len(keys), 25)
+		var reqs []types.WriteRequest
+		for _, k := range keys[:n] {
+			reqs = append(reqs, types.WriteRequest{DeleteRequest: &types.DeleteRequest{
+				Key: map[string]types.AttributeValue{"date": &types.AttributeValueMemberS{Value: k}},
+			}})
+		}
+		keys = keys[n:]
+		pending := map[string][]types.WriteRequest{tableName: reqs}
+		for len(pending) > 0 {
+			resp, err := dynamoClient.BatchWriteItem(ctx, &dynamodb.BatchWriteItemInput{RequestItems: pending})
+			if err != nil {
+				return err
+			}
+			pending = resp.UnprocessedItems
+		}
+	}
+	return nil
+}
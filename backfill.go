@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// htbActivity is one entry of the HTB profile activity feed.
+type htbActivity struct {
+	Date       string `json:"date"`
+	Type       string `json:"type"`
+	ObjectType string `json:"object_type"`
+	Name       string `json:"name"`
+	FirstBlood bool   `json:"first_blood"`
+}
+
+// activityFields returns the counters one activity entry incremented.
+func activityFields(a htbActivity) []string {
+	if a.ObjectType == "challenge" || a.Type == "challenge" {
+		return []string{"Challenge_Owns"}
+	}
+	var fields []string
+	switch a.Type {
+	case "user":
+		fields = append(fields, "User_Owns")
+		if a.FirstBlood {
+			fields = append(fields, "User_Bloods")
+		}
+	case "root":
+		fields = append(fields, "System_Owns")
+		if a.FirstBlood {
+			fields = append(fields, "System_Bloods")
+		}
+	}
+	return fields
+}
+
+// reconstructHistory rebuilds daily owns, bloods and challenge counts by
+// winding today’s stats back through the activity feed. Days before the oldest
+// activity entry are not returned, since the feed may be truncated there.
+// Ranks cannot be recovered this way and are left out.
+func reconstructHistory(today map[string]interface{}, activity []htbActivity, from, to time.Time) map[string]map[string]interface{} {
+	counts := map[string]float64{}
+	for _, f := range []string{"System_Owns", "User_Owns", "System_Bloods", "User_Bloods", "Challenge_Owns"} {
+		counts[f], _ = toFloat(today[f])
+	}
+
+	// newest first, so each day can undo what happened after it
+	sort.Slice(activity, func(i, j int) bool { return activity[i].Date > activity[j].Date })
+	if len(activity) == 0 {
+		return nil
+	}
+	oldest, err := time.Parse(time.RFC3339, activity[len(activity)-1].Date)
+	if err != nil {
+		return nil
+	}
+
+	days := map[string]map[string]interface{}{}
+	next := 0
+	for d := to; !d.Before(from) && !d.Before(oldest.Truncate(24*time.Hour)); d = d.AddDate(0, 0, -1) {
+		end := d.AddDate(0, 0, 1)
+		for ; next < len(activity); next++ {
+			at, err := time.Parse(time.RFC3339, activity[next].Date)
+			if err != nil || at.Before(end) {
+				break
+			}
+			for _, f := range activityFields(activity[next]) {
+				counts[f]--
+			}
+		}
+		item := map[string]interface{}{"Synthesized": true}
+		for f, v := range counts {
+			item[f] = int(v)
+		}
+		days[d.Format("2006-01-02")] = item
+	}
+	return days
+}
+
+// backfill reconstructs up to {"days": N} (default 365) past daily snapshots
+// for {"user": ID} (default USER_ID) from the HTB activity feed and stores
+// them marked "Synthesized": true. Days that already have an item are kept.
+func backfill(ctx context.Context, inv invocation) (map[string]interface{}, error) {
+	tableName := os.Getenv("TABLE_NAME")
+	if tableName == "" {
+		return map[string]interface{}{"error": "TABLE_NAME not configured"}, nil
+	}
+	userID := inv.User
+	if userID == "" {
+		userID = os.Getenv("USER_ID")
+	}
+	tableName = userTable(userID, tableName)
+	days := inv.Days
+	if days <= 0 || days > maxHistoryDays {
+		days = 365
+	}
+
+	current, err := getRankingsFromHTB(ctx, userID)
+	if err != nil {
+		return map[string]interface{}{"error": "Error fetching stats from HTB", "detail": err.Error()}, nil
+	}
+	if !fetchOK(current, "profile") {
+		return map[string]interface{}{"error": "Error fetching stats from HTB", "detail": "profile unavailable"}, nil
+	}
+	var activityResp struct {
+		Profile struct {
+			Activity []htbActivity `json:"activity"`
+		} `json:"profile"`
+	}
+	if err := htbGetter(ctx, userID)(htbAPI("/api/v4/user/profile/activity/"+userID), &activityResp); err != nil {
+		return map[string]interface{}{"error": "Error fetching activity from HTB", "detail": err.Error()}, nil
+	}
+
+	today := currentDay()
+	history := reconstructHistory(current, activityResp.Profile.Activity, today.AddDate(0, 0, -days), today.AddDate(0, 0, -1))
+
+	written, skipped := 0, 0
+	for date, item := range history {
+		item["date"] = itemKey(userID, date)
+		av, err := attributevalue.MarshalMap(item)
+		if err != nil {
+			return map[string]interface{}{"error": "Error marshalling item"}, nil
+		}
+		_, err = dynamoClient.PutItem(ctx, &dynamodb.PutItemInput{
+			TableName:                aws.String(tableName),
+			Item:                     withContentHash(av),
+			ConditionExpression:      aws.String("attribute_not_exists(#d)"),
+			ExpressionAttributeNames: map[string]string{"#d": "date"},
+		})
+		var exists *types.ConditionalCheckFailedException
+		switch {
+		case errors.As(err, &exists):
+			skipped++
+		case err != nil:
+			slog.ErrorContext(ctx, "PutItem failed", "region", awsRegion, "table", tableName, "key", item["date"], "error", err)
+			return map[string]interface{}{"error": "Error writing item to DynamoDB", "detail": err.Error(), "written": written}, nil
+		default:
+			written++
+		}
+	}
+	return map[string]interface{}{"written": written, "skipped": skipped}, nil
+}
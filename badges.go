@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// badgeField is the Change.Field used for newly earned badges.
+const badgeField = "Badge"
+
+// badgeIconURL makes relative badge icon paths from the HTB API absolute.
+func badgeIconURL(icon string) string {
+	if icon == "" || strings.HasPrefix(icon, "http") {
+		return icon
+	}
+	return "https://labs.hackthebox.com/" + strings.TrimLeft(icon, "/")
+}
+
+// detectNewBadges returns one Change per badge present in curr but not in
+// prev. Nothing is reported when either snapshot lacks badge data, so the
+// first day with badges doesn't announce the whole collection.
+func detectNewBadges(prev, curr map[string]interface{}) []Change {
+	oldList, okOld := prev["Badges"].([]interface{})
+	newList, okNew := curr["Badges"].([]interface{})
+	if !okOld || !okNew {
+		return nil
+	}
+	seen := make(map[string]bool, len(oldList))
+	for _, b := range oldList {
+		if m, ok := b.(map[string]interface{}); ok {
+			seen[formatValue(m["id"])] = true
+		}
+	}
+	var changes []Change
+	for _, b := range newList {
+		m, ok := b.(map[string]interface{})
+		if !ok || seen[formatValue(m["id"])] {
+			continue
+		}
+		changes = append(changes, Change{
+			Field: badgeField,
+			New:   fmt.Sprint(m["name"]),
+			Image: fmt.Sprint(m["icon"]),
+		})
+	}
+	return changes
+}
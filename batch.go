@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"os"
+	"sync"
+)
+
+// notifyBatch collects every change notified during a refresh so they can be
+// sent as one combined message per channel.
+type notifyBatch struct {
+	mu      sync.Mutex
+	changes []Change
+}
+
+type batchKey struct{}
+
+// batchingEnabled reports whether NOTIFY_BATCH asks for combined messages.
+func batchingEnabled() bool {
+	return os.Getenv("NOTIFY_BATCH") == "true"
+}
+
+// withNotifyBatch returns a context whose notifications are held in the
+// returned batch until flush is called. When batching is disabled the
+// context is returned unchanged and the batch is nil.
+func withNotifyBatch(ctx context.Context) (context.Context, *notifyBatch) {
+	if !batchingEnabled() {
+		return ctx, nil
+	}
+	b := &notifyBatch{}
+	return context.WithValue(ctx, batchKey{}, b), b
+}
+
+// batchFrom returns the batch collecting ctx's notifications, if any.
+func batchFrom(ctx context.Context) *notifyBatch {
+	b, _ := ctx.Value(batchKey{}).(*notifyBatch)
+	return b
+}
+
+func (b *notifyBatch) add(changes []Change) {
+	b.mu.Lock()
+	b.changes = append(b.changes, changes...)
+	b.mu.Unlock()
+}
+
+// flush sends everything collected so far. It is safe to call on a nil batch.
+func (b *notifyBatch) flush(ctx context.Context) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	changes := b.changes
+	b.changes = nil
+	b.mu.Unlock()
+	// detach from the batch so notifyChanges sends instead of collecting
+	sendChanges(context.WithValue(ctx, batchKey{}, (*notifyBatch)(nil)), changes)
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// bloodFields are the stats whose increase triggers a first‑blood alert, with
+// the HTB activity type each one corresponds to.
+var bloodFields = map[string]string{
+	"System_Bloods": "root",
+	"User_Bloods":   "user",
+}
+
+// splitBloods separates blood‑count increases from all other changes.
+func splitBloods(changes []Change) (bloods, rest []Change) {
+	for _, c := range changes {
+		if _, ok := bloodFields[c.Field]; ok {
+			if improved, _ := c.Improved(); improved {
+				bloods = append(bloods, c)
+				continue
+			}
+		}
+		rest = append(rest, c)
+	}
+	return bloods, rest
+}
+
+// highPriority reports whether the batch contains a first blood.
+func highPriority(changes []Change) bool {
+	for _, c := range changes {
+		if _, ok := bloodFields[c.Field]; ok {
+			if improved, _ := c.Improved(); improved {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// bloodDetailsEnabled reports whether the extra activity call that names the
+// blooded machines is switched on.
+func bloodDetailsEnabled() bool {
+	return os.Getenv("FETCH_BLOOD_DETAILS") == "true"
+}
+
+// annotateBloods fills Detail with the machine names from the snapshot’s
+// Recent_Bloods that weren’t in the previous one. When the previous snapshot
+// predates the details fetch, the newest blood of that type is used.
+func annotateBloods(bloods []Change, prev, curr map[string]interface{}) []Change {
+	newList, ok := curr["Recent_Bloods"].([]interface{})
+	if !ok {
+		return bloods
+	}
+	oldList, hadOld := prev["Recent_Bloods"].([]interface{})
+	seen := make(map[string]bool, len(oldList))
+	for _, b := range oldList {
+		if m, ok := b.(map[string]interface{}); ok {
+			seen[fmt.Sprint(m["type"], "/", m["name"])] = true
+		}
+	}
+
+	for i, c := range bloods {
+		for _, b := range newList {
+			m, ok := b.(map[string]interface{})
+			if !ok || m["type"] != bloodFields[c.Field] || seen[fmt.Sprint(m["type"], "/", m["name"])] {
+				continue
+			}
+			if bloods[i].Detail != "" {
+				bloods[i].Detail += ", "
+			}
+			bloods[i].Detail += fmt.Sprint(m["name"])
+			if !hadOld {
+				break
+			}
+		}
+	}
+	return bloods
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"os"
+	"time"
+)
+
+// cacheTTL is how long a warm container serves the primary user’s stats
+// from memory before reading DynamoDB again — where another container, the
+// refresh hook or the queue worker may have stored newer ones — from
+// CACHE_TTL (default 5m; 0 turns the in‑memory cache off). The cache never
+// outlives its day or REFRESH_INTERVAL slot either way.
+func cacheTTL() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("CACHE_TTL")); err == nil && d >= 0 {
+		return d
+	}
+	return 5 * time.Minute
+}
+
+// storeCache remembers info as the stats for date.
+func storeCache(info map[string]interface{}, date string) {
+	cacheMutex.Lock()
+	dataCache, cacheDate, cachedAt = info, date, time.Now()
+	cacheMutex.Unlock()
+}
+
+// cachedStats returns a copy of the cached stats if they are date’s, younger
+// than cacheTTL and not due a refresh; nil otherwise.
+func cachedStats(date string) map[string]interface{} {
+	cacheMutex.RLock()
+	defer cacheMutex.RUnlock()
+	if len(dataCache) == 0 || cacheDate != date || time.Since(cachedAt) >= cacheTTL() || refreshDue(dataCache) {
+		return nil
+	}
+	res := make(map[string]interface{}, len(dataCache))
+	for k, v := range dataCache {
+		res[k] = v
+	}
+	return res
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+)
+
+// categoryPoint is one day of a challenge category’s solve count.
+type categoryPoint struct {
+	Date   string `json:"date"`
+	Solved int    `json:"solved"`
+}
+
+// categoryGrowth is the solve history of one challenge category.
+type categoryGrowth struct {
+	Category string          `json:"category"`
+	Start    int             `json:"start"`
+	End      int             `json:"end"`
+	Gained   int             `json:"gained"`
+	Points   []categoryPoint `json:"points"`
+}
+
+// categorySeries splits the Challenge_Categories of a date‑ordered series
+// into one history per category, fastest growing first. only, when set,
+// keeps a single category (case‑insensitive).
+func categorySeries(points []map[string]interface{}, only string) []*categoryGrowth {
+	byName := map[string]*categoryGrowth{}
+	var out []*categoryGrowth
+	for _, p := range points {
+		cats, ok := p["Challenge_Categories"].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for name, v := range cats {
+			if only != "" && !strings.EqualFold(name, only) {
+				continue
+			}
+			solved, ok := toFloat(v)
+			if !ok {
+				continue
+			}
+			g := byName[name]
+			if g == nil {
+				g = &categoryGrowth{Category: name, Start: int(solved)}
+				byName[name] = g
+				out = append(out, g)
+			}
+			g.End = int(solved)
+			g.Points = append(g.Points, categoryPoint{Date: p["date"].(string), Solved: int(solved)})
+		}
+	}
+	for _, g := range out {
+		g.Gained = g.End - g.Start
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].Gained != out[j].Gained {
+			return out[i].Gained > out[j].Gained
+		}
+		return out[i].Category < out[j].Category
+	})
+	return out
+}
+
+// categoryHistoryHandler serves /history/categories?from=&to=[&category=]
+// [&user=ID]: challenge solves per category over the range.
+func categoryHistoryHandler(ctx context.Context, inv invocation) (map[string]interface{}, error) {
+	tableName := os.Getenv("TABLE_NAME")
+	if tableName == "" {
+		return httpResponse(http.StatusInternalServerError, map[string]string{"error": "TABLE_NAME not configured"}), nil
+	}
+	from, to, err := dateRange(inv, 90)
+	if err != nil {
+		return httpResponse(http.StatusBadRequest, map[string]string{"error": err.Error()}), nil
+	}
+	user, ok := requestedUser(inv)
+	if !ok {
+		return httpResponse(http.StatusNotFound, map[string]string{"error": "unknown user"}), nil
+	}
+	if denied := requireVisible(inv, "Challenge_Categories"); denied != nil {
+		return denied, nil
+	}
+
+	items, err := loadRange(ctx, tableName, user, from, to)
+	if err != nil {
+		slog.ErrorContext(ctx, "BatchGetItem failed", "region", awsRegion, "table", tableName, "error", err)
+		return httpResponse(http.StatusInternalServerError, map[string]string{"error": "Database lookup failed", "detail": err.Error()}), nil
+	}
+	categories := categorySeries(series(items), inv.QueryParams["category"])
+	if len(categories) == 0 && inv.QueryParams["category"] != "" {
+		return httpResponse(http.StatusNotFound, map[string]string{"error": "unknown category"}), nil
+	}
+	return httpResponse(http.StatusOK, map[string]interface{}{
+		"user":       user,
+		"from":       from.Format("2006-01-02"),
+		"to":         to.Format("2006-01-02"),
+		"categories": categories,
+	}), nil
+}
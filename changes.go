@@ -0,0 +1,223 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Change describes a single stat that moved between two daily snapshots.
+type Change struct {
+	User   string // set when several users are refreshed together
+	Field  string
+	Old    interface{}
+	New    interface{}
+	Image  string // badge artwork, only set for badge changes
+	Detail string // extra context, e.g. the blooded machine
+}
+
+// ChangeEvent is the structured form of a Change handed to downstream
+// consumers such as SNS subscribers. Its contract is schema/events.json;
+// bump changeEventSchemaVersion for anything other than additive fields.
+type ChangeEvent struct {
+	SchemaVersion string      `json:"schema_version"`
+	User          string      `json:"user"`
+	Field         string      `json:"field"`
+	Old           interface{} `json:"old"`
+	New           interface{} `json:"new"`
+	Image         string      `json:"image,omitempty"`
+	Detail        string      `json:"detail,omitempty"`
+	Timestamp     time.Time   `json:"timestamp"`
+}
+
+// changeEventSchemaVersion is the ChangeEvent contract version.
+const changeEventSchemaVersion = "1"
+
+// changeEvents stamps each change with the tracked user and the current time.
+func changeEvents(changes []Change) []ChangeEvent {
+	now := time.Now().UTC()
+	events := make([]ChangeEvent, 0, len(changes))
+	for _, c := range changes {
+		user := c.User
+		if user == "" {
+			user = os.Getenv("USER_ID")
+		}
+		events = append(events, ChangeEvent{
+			SchemaVersion: changeEventSchemaVersion,
+			User:          user,
+			Field:         c.Field,
+			Old:           c.Old,
+			New:           c.New,
+			Image:         c.Image,
+			Detail:        c.Detail,
+			Timestamp:     now,
+		})
+	}
+	return events
+}
+
+// trackedFields lists the stats compared between snapshots, in display order.
+var trackedFields = []string{
+	"Rank",
+	"User_Global_Rank",
+	"Local_Rank",
+	"System_Owns",
+	"User_Owns",
+	"System_Bloods",
+	"User_Bloods",
+	"Challenge_Owns",
+}
+
+// detectChanges compares two snapshots and returns every tracked field whose
+// value differs. Fields missing from either side (e.g. an empty negative‑cache
+// item) are skipped rather than reported as changes.
+func detectChanges(prev, curr map[string]interface{}) []Change {
+	var changes []Change
+	for _, field := range trackedFields {
+		oldV, okOld := prev[field]
+		newV, okNew := curr[field]
+		if !okOld || !okNew || sameValue(oldV, newV) {
+			continue
+		}
+		changes = append(changes, Change{Field: field, Old: oldV, New: newV})
+	}
+	return changes
+}
+
+// sameValue compares two stat values, treating ints from the HTB API and
+// float64s from DynamoDB as equal when they hold the same number.
+func sameValue(a, b interface{}) bool {
+	fa, okA := toFloat(a)
+	fb, okB := toFloat(b)
+	if okA && okB {
+		return fa == fb
+	}
+	return fmt.Sprint(a) == fmt.Sprint(b)
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	case string:
+		f, err := strconv.ParseFloat(n, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// formatValue renders a stat for display, dropping the ".0" DynamoDB adds to
+// whole numbers.
+func formatValue(v interface{}) string {
+	if f, ok := v.(float64); ok && f == float64(int64(f)) {
+		return strconv.FormatInt(int64(f), 10)
+	}
+	return fmt.Sprint(v)
+}
+
+// Label returns the human‑readable name of the changed field in the
+// notification locale.
+func (c Change) Label() string {
+	return fieldLabel(notifyLocale(), c.Field)
+}
+
+// rankTitles lists HTB rank titles from lowest to highest, so title changes
+// can be ordered like numeric stats.
+var rankTitles = []string{"Noob", "Script Kiddie", "Hacker", "Pro Hacker", "Elite Hacker", "Guru", "Omniscient"}
+
+// rankFields are the rank‑style stats; their changes are routed and published
+// as rank events, everything else as stats events.
+var rankFields = map[string]bool{
+	"Rank":             true,
+	"User_Global_Rank": true,
+	"Local_Rank":       true,
+	"Season_Tier":      true,
+	"Season_Rank":      true,
+}
+
+// lowerIsBetter marks the rank‑style fields where a smaller number is an
+// improvement.
+var lowerIsBetter = map[string]bool{"User_Global_Rank": true, "Local_Rank": true, "Season_Rank": true}
+
+// statValue converts a stat to a comparable number, mapping rank titles to
+// their position in rankTitles.
+func statValue(field string, v interface{}) (float64, bool) {
+	var titles []string
+	switch field {
+	case "Rank":
+		titles = rankTitles
+	case "Season_Tier":
+		titles = seasonTiers
+	default:
+		return toFloat(v)
+	}
+	for i, t := range titles {
+		if t == fmt.Sprint(v) {
+			return float64(i), true
+		}
+	}
+	return 0, false
+}
+
+// Improved reports whether the change is a step forward. Ranks improve as they
+// go down, everything else improves as it goes up. ok is false when the
+// values cannot be compared.
+func (c Change) Improved() (improved, ok bool) {
+	oldF, okOld := statValue(c.Field, c.Old)
+	newF, okNew := statValue(c.Field, c.New)
+	if !okOld || !okNew {
+		return false, false
+	}
+	if lowerIsBetter[c.Field] {
+		return newF < oldF, true
+	}
+	return newF > oldF, true
+}
+
+// Arrow returns ▲ for an improvement and ▼ for a regression.
+func (c Change) Arrow() string {
+	improved, ok := c.Improved()
+	switch {
+	case !ok:
+		return "•"
+	case improved:
+		return "▲"
+	}
+	return "▼"
+}
+
+// Summary renders the change as a single line, e.g. "Global rank: 812 → 790 ▲",
+// prefixed with the user when one is set.
+func (c Change) Summary() string {
+	var s string
+	switch c.Field {
+	case badgeField:
+		s = "🏅 " + c.Label() + ": " + formatValue(c.New)
+	case failureField:
+		s = "⚠️ " + c.Label() + ": " + c.Detail
+	case tokenField:
+		s = "🔑 " + c.Label() + ": " + c.Detail
+	case tokenExpiringField:
+		s = "⏳ " + c.Label() + ": " + c.Detail
+	case anomalyField:
+		s = "🚨 " + c.Label() + ": " + c.Detail
+	case milestoneField:
+		s = "🎯 " + c.Label() + ": " + c.Detail
+	case goalField:
+		s = "🏆 " + c.Label() + ": " + c.Detail
+	default:
+		s = fmt.Sprintf("%s: %s → %s %s", c.Label(), formatValue(c.Old), formatValue(c.New), c.Arrow())
+		if c.Detail != "" {
+			s += " (" + c.Detail + ")"
+		}
+	}
+	if c.User != "" {
+		s = "[" + c.User + "] " + s
+	}
+	return s
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// changesKey names the item holding the changes derived from userID’s
+// snapshot for date. Like intraday keys it extends the snapshot’s key, so
+// archival and history don’t take it for a snapshot.
+func changesKey(userID, date string) string {
+	return itemKey(userID, date) + "#changes"
+}
+
+// changesItem is the change marker stored with a snapshot: its changes as
+// ChangeEvent JSON under "events", in the groups they are notified in, the
+// Content_Hash of the snapshot they were derived from and "baseline", the
+// date of the snapshot compared with (empty without one). Notifications are
+// sent from it by sendStoredChanges, which then deletes it; one left behind
+// by an invocation that died first expires with the intraday snapshots.
+func changesItem(key string, snapshot map[string]types.AttributeValue, baseline string, groups [][]Change) (map[string]types.AttributeValue, error) {
+	events := make([][]ChangeEvent, 0, len(groups))
+	for _, changes := range groups {
+		if len(changes) > 0 {
+			events = append(events, changeEvents(changes))
+		}
+	}
+	raw, err := json.Marshal(events)
+	if err != nil {
+		return nil, err
+	}
+	item := map[string]types.AttributeValue{
+		"date":       &types.AttributeValueMemberS{Value: key},
+		"events":     &types.AttributeValueMemberS{Value: string(raw)},
+		"baseline":   &types.AttributeValueMemberS{Value: baseline},
+		"expires_at": &types.AttributeValueMemberN{Value: strconv.FormatInt(time.Now().Add(intradayRetention()).Unix(), 10)},
+	}
+	if hash, ok := snapshot[hashField]; ok {
+		item[hashField] = hash
+	}
+	return item, nil
+}
+
+// hasChanges reports whether any of the groups holds a change.
+func hasChanges(groups [][]Change) bool {
+	for _, changes := range groups {
+		if len(changes) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// storeSnapshot writes a snapshot and its change marker in one transaction,
+// so the snapshot is never stored without the changes derived from it, nor
+// the changes without their snapshot. Without a marker — nothing changed,
+// or nothing is to be notified — the snapshot is written on its own.
+func storeSnapshot(ctx context.Context, tableName string, snapshot, changes map[string]types.AttributeValue) error {
+	if changes == nil {
+		_, err := dynamoClient.PutItem(ctx, &dynamodb.PutItemInput{TableName: aws.String(tableName), Item: snapshot})
+		return err
+	}
+	_, err := dynamoClient.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: []types.TransactWriteItem{
+			{Put: &types.Put{TableName: aws.String(tableName), Item: snapshot}},
+			{Put: &types.Put{TableName: aws.String(tableName), Item: changes}},
+		},
+	})
+	return err
+}
+
+// storedChanges reads the groups of changes in userID’s change marker for
+// date, nil when there is none.
+func storedChanges(ctx context.Context, tableName, userID, date string) ([][]Change, error) {
+	resp, err := dynamoClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(tableName),
+		Key:            map[string]types.AttributeValue{"date": &types.AttributeValueMemberS{Value: changesKey(userID, date)}},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil || resp.Item == nil {
+		return nil, err
+	}
+	raw, _ := resp.Item["events"].(*types.AttributeValueMemberS)
+	if raw == nil {
+		return nil, nil
+	}
+	var events [][]ChangeEvent
+	if err := json.Unmarshal([]byte(raw.Value), &events); err != nil {
+		return nil, err
+	}
+	// tagged with the user only when several are tracked, as snapshotChanges does
+	tagged := len(configuredUsers()) > 1
+	groups := make([][]Change, 0, len(events))
+	for _, group := range events {
+		changes := make([]Change, 0, len(group))
+		for _, e := range group {
+			c := Change{Field: e.Field, Old: e.Old, New: e.New, Image: e.Image, Detail: e.Detail}
+			if tagged {
+				c.User = e.User
+			}
+			changes = append(changes, c)
+		}
+		groups = append(groups, changes)
+	}
+	return groups, nil
+}
+
+// sendStoredChanges notifies the changes in userID’s change marker for date,
+// if one is stored, and deletes it once they are handed to the notifiers.
+// refreshUser calls it after the snapshot’s transaction and, before it,
+// for a marker an earlier invocation stored but died before sending, whose
+// changes would otherwise be overwritten unsent.
+func sendStoredChanges(ctx context.Context, tableName, userID, date string) {
+	groups, err := storedChanges(ctx, tableName, userID, date)
+	if err != nil {
+		slog.ErrorContext(ctx, "reading stored changes failed", "region", awsRegion, "table", tableName, "key", changesKey(userID, date), "error", err)
+		return
+	}
+	if groups == nil {
+		return
+	}
+	notifySnapshot(ctx, groups)
+	_, err = dynamoClient.DeleteItem(context.WithoutCancel(ctx), &dynamodb.DeleteItemInput{
+		TableName: aws.String(tableName),
+		Key:       map[string]types.AttributeValue{"date": &types.AttributeValueMemberS{Value: changesKey(userID, date)}},
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "deleting stored changes failed", "region", awsRegion, "table", tableName, "key", changesKey(userID, date), "error", err)
+	}
+}
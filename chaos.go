@@ -0,0 +1,132 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+// Faults CHAOS can inject, each at its own rate.
+const (
+	chaosHTBTimeout     = "htb_timeout"
+	chaosHTB429         = "htb_429"
+	chaosDynamoThrottle = "dynamo_throttle"
+)
+
+// chaosRate is the fraction of calls that fail with fault, from CHAOS, e.g.
+// "htb_timeout=0.1,htb_429=0.05,dynamo_throttle=0.02". It is 0 without an
+// ENVIRONMENT: fault injection is for test deployments only, never
+// production.
+func chaosRate(fault string) float64 {
+	if environment() == "" {
+		return 0
+	}
+	for _, part := range splitList(os.Getenv("CHAOS")) {
+		name, rate, _ := strings.Cut(part, "=")
+		if strings.TrimSpace(name) != fault {
+			continue
+		}
+		f, err := strconv.ParseFloat(strings.TrimSpace(rate), 64)
+		if err != nil || f <= 0 {
+			return 0
+		}
+		return min(f, 1)
+	}
+	return 0
+}
+
+// injectFault reports, at fault’s rate, whether this call should fail.
+func injectFault(fault string) bool {
+	if rate := chaosRate(fault); rate > 0 && rand.Float64() < rate {
+		slog.Info("chaos: injecting fault", "fault", fault)
+		return true
+	}
+	return false
+}
+
+func checkChaos(s string) error {
+	for _, part := range splitList(s) {
+		name, rate, _ := strings.Cut(part, "=")
+		switch strings.TrimSpace(name) {
+		case chaosHTBTimeout, chaosHTB429, chaosDynamoThrottle:
+		default:
+			return errors.New("unknown fault " + strconv.Quote(name) + ": want htb_timeout, htb_429 or dynamo_throttle")
+		}
+		if f, err := strconv.ParseFloat(strings.TrimSpace(rate), 64); err != nil || f < 0 || f > 1 {
+			return errors.New("rate of " + name + ": want a fraction between 0 and 1")
+		}
+	}
+	return nil
+}
+
+// chaosTimeout is the error an injected HTB timeout fails with, a net.Error
+// like that of a real one.
+type chaosTimeout struct{}
+
+func (chaosTimeout) Error() string   { return "chaos: injected timeout awaiting response headers" }
+func (chaosTimeout) Timeout() bool   { return true }
+func (chaosTimeout) Temporary() bool { return true }
+
+// chaosTransport fails HTB requests at the CHAOS rates — a timeout, or a 429
+// asking to retry after a second — before they leave the container, so
+// retries, rate limiting, the breaker and the fallbacks run as in an
+// incident.
+type chaosTransport struct {
+	next http.RoundTripper
+}
+
+func (t chaosTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if injectFault(chaosHTBTimeout) {
+		return nil, chaosTimeout{}
+	}
+	if injectFault(chaosHTB429) {
+		return &http.Response{
+			Status:     "429 Too Many Requests",
+			StatusCode: http.StatusTooManyRequests,
+			Proto:      "HTTP/1.1",
+			ProtoMajor: 1,
+			ProtoMinor: 1,
+			Header:     http.Header{"Retry-After": {"1"}, "Content-Type": {"application/json"}},
+			Body:       io.NopCloser(strings.NewReader(`{"message":"Too Many Attempts."}`)),
+			Request:    req,
+		}, nil
+	}
+	return t.next.RoundTrip(req)
+}
+
+// chaosDynamo fails DynamoDB calls at the dynamo_throttle rate with the
+// ProvisionedThroughputExceededException DynamoDB throttles with, which the
+// SDK retries as it would a real one.
+type chaosDynamo struct {
+	next dynamodb.HTTPClient
+}
+
+func (c chaosDynamo) Do(req *http.Request) (*http.Response, error) {
+	if !injectFault(chaosDynamoThrottle) {
+		return c.next.Do(req)
+	}
+	const errType = "com.amazonaws.dynamodb.v20120810#ProvisionedThroughputExceededException"
+	return &http.Response{
+		Status:     "400 Bad Request",
+		StatusCode: http.StatusBadRequest,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     http.Header{"Content-Type": {"application/x-amz-json-1.0"}, "X-Amzn-Errortype": {errType}},
+		Body:       io.NopCloser(strings.NewReader(`{"__type":"` + errType + `","message":"chaos: injected throttle"}`)),
+		Request:    req,
+	}, nil
+}
+
+// withDynamoChaos routes the DynamoDB client through chaosDynamo. Rates are
+// read per call, so CHAOS can be changed without a cold start.
+func withDynamoChaos(o *dynamodb.Options) {
+	o.HTTPClient = chaosDynamo{next: o.HTTPClient}
+}
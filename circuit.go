@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// circuitKey holds the breaker state shared by every invocation: the count
+// of consecutive upstream failures and, once open, when it may close.
+const circuitKey = "circuit#htb"
+
+// staleField marks a snapshot served from storage while the breaker is open.
+const staleField = "Stale"
+
+// errCircuitOpen fails a refresh that had nothing stored to fall back on
+// while the breaker is open.
+var errCircuitOpen = errors.New("HTB API unavailable, circuit breaker open")
+
+// circuitThreshold is how many refreshes in a row must fail upstream before
+// the breaker opens, from CIRCUIT_FAILURES (default 5; 0 disables it).
+func circuitThreshold() int {
+	if n, err := strconv.Atoi(os.Getenv("CIRCUIT_FAILURES")); err == nil && n >= 0 {
+		return n
+	}
+	return 5
+}
+
+// circuitCooldown is how long the breaker stays open before one refresh is
+// let through to probe HTB, from CIRCUIT_COOLDOWN (default 5m).
+func circuitCooldown() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("CIRCUIT_COOLDOWN")); err == nil && d > 0 {
+		return d
+	}
+	return 5 * time.Minute
+}
+
+// upstreamFailure reports whether err means HTB itself is unwell — a 5xx, a
+// 429, a maintenance page or challenge, a timeout or a connection error —
+// rather than e.g. a rejected token.
+func upstreamFailure(err error) bool {
+	var se *statusError
+	var ue *url.Error
+	return errors.As(err, &se) && se.code >= 500 || errors.Is(err, errRateLimited) || errors.Is(err, errUnavailable) ||
+		errors.As(err, &ue)
+}
+
+// circuitState reads the breaker: the current failure count and until when
+// it is open (zero when closed). A failed read counts as closed.
+func circuitState(ctx context.Context, tableName string) (failures int, openUntil time.Time) {
+	item, err := loadItem(ctx, tableName, envKey(circuitKey))
+	if err != nil {
+		slog.ErrorContext(ctx, "GetItem failed", "region", awsRegion, "table", tableName, "key", envKey(circuitKey), "error", err)
+		return 0, time.Time{}
+	}
+	n, _ := toFloat(item["failures"])
+	if until, ok := toFloat(item["open_until"]); ok {
+		openUntil = time.Unix(int64(until), 0)
+	}
+	return int(n), openUntil
+}
+
+// circuitProbeWindow is how long the refresh probing a half‑open breaker has
+// to report back before another one is let through.
+const circuitProbeWindow = time.Minute
+
+// circuitOpen reports whether HTB calls should be skipped right now. After
+// the cooldown the breaker is half open: the one refresh that claims the
+// probe goes through, the others keep being skipped, and the probe’s result
+// closes the breaker or reopens it for another cooldown.
+func circuitOpen(ctx context.Context, tableName string) bool {
+	if circuitThreshold() == 0 || tableName == "" {
+		return false
+	}
+	_, until := circuitState(ctx, tableName)
+	if until.IsZero() {
+		return false
+	}
+	if time.Now().Before(until) {
+		return true
+	}
+	return !claimCircuitProbe(ctx, tableName, until)
+}
+
+// claimCircuitProbe moves open_until from until to the end of the probe
+// window, only if no other refresh has done so first, and reports whether
+// this refresh won and should call HTB. A failed write lets it through, as a
+// failed read does.
+func claimCircuitProbe(ctx context.Context, tableName string, until time.Time) bool {
+	_, err := dynamoClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:           aws.String(tableName),
+		Key:                 map[string]types.AttributeValue{"date": &types.AttributeValueMemberS{Value: envKey(circuitKey)}},
+		UpdateExpression:    aws.String("SET open_until = :probe"),
+		ConditionExpression: aws.String("open_until = :until"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":until": &types.AttributeValueMemberN{Value: strconv.FormatInt(until.Unix(), 10)},
+			":probe": &types.AttributeValueMemberN{Value: strconv.FormatInt(time.Now().Add(circuitProbeWindow).Unix(), 10)},
+		},
+	})
+	var condErr *types.ConditionalCheckFailedException
+	if errors.As(err, &condErr) {
+		return false
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "claiming the circuit breaker probe failed", "error", err)
+	}
+	return true
+}
+
+// recordCircuitResult counts consecutive upstream failures, opening the
+// breaker once circuitThreshold is reached, and resets it on any other
+// outcome.
+func recordCircuitResult(ctx context.Context, tableName string, fetchErr error) {
+	if circuitThreshold() == 0 || tableName == "" {
+		return
+	}
+	key := map[string]types.AttributeValue{
+		"date": &types.AttributeValueMemberS{Value: envKey(circuitKey)},
+	}
+	if !upstreamFailure(fetchErr) {
+		// only write when there is a count to clear
+		_, err := dynamoClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+			TableName:                 aws.String(tableName),
+			Key:                       key,
+			UpdateExpression:          aws.String("SET failures = :zero REMOVE open_until"),
+			ConditionExpression:       aws.String("failures > :zero"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{":zero": &types.AttributeValueMemberN{Value: "0"}},
+		})
+		var condErr *types.ConditionalCheckFailedException
+		if err != nil && !errors.As(err, &condErr) {
+			slog.ErrorContext(ctx, "closing circuit breaker failed", "error", err)
+		}
+		return
+	}
+
+	resp, err := dynamoClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                 aws.String(tableName),
+		Key:                       key,
+		UpdateExpression:          aws.String("ADD failures :one"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{":one": &types.AttributeValueMemberN{Value: "1"}},
+		ReturnValues:              types.ReturnValueUpdatedNew,
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "recording upstream failure failed", "error", err)
+		return
+	}
+	failures := 0
+	if n, ok := resp.Attributes["failures"].(*types.AttributeValueMemberN); ok {
+		failures, _ = strconv.Atoi(n.Value)
+	}
+	if failures < circuitThreshold() {
+		return
+	}
+	until := time.Now().Add(circuitCooldown())
+	_, err = dynamoClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                 aws.String(tableName),
+		Key:                       key,
+		UpdateExpression:          aws.String("SET open_until = :until"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{":until": &types.AttributeValueMemberN{Value: strconv.FormatInt(until.Unix(), 10)}},
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "opening circuit breaker failed", "error", err)
+		return
+	}
+	slog.ErrorContext(ctx, "circuit breaker open", "failures", failures, "until", until.Format(time.RFC3339))
+}
+
+// lastKnownGood is what a refresh serves while the breaker is open: the
+// day’s stored stats if there are any, else userID’s newest snapshot of the
+// last three days, marked Stale. Its date tells how old it is.
+func lastKnownGood(ctx context.Context, tableName, userID, date string, existing map[string]interface{}) map[string]interface{} {
+	latest := existing
+	if len(latest) > 1 {
+		latest["date"] = date
+	} else {
+		var err error
+		if latest, _, _, err = latestStats(ctx, tableName, userID, currentDay()); err != nil || latest == nil {
+			return nil
+		}
+	}
+	out := make(map[string]interface{}, len(latest)+1)
+	for k, v := range latest {
+		out[k] = v
+	}
+	out[staleField] = true
+	return out
+}
+
+// staleOnError is for display widgets that would rather show old numbers
+// than none: with STALE_ON_ERROR=true a failed refresh of userID’s stats for
+// today answers with the last known good snapshot instead of err. Without the
+// setting, or without a snapshot to fall back on, err is returned as is.
+func staleOnError(ctx context.Context, tableName, userID string, err error) (map[string]interface{}, error) {
+	if os.Getenv("STALE_ON_ERROR") != "true" {
+		return nil, err
+	}
+	last := lastKnownGood(ctx, tableName, userID, currentDate(), nil)
+	if last == nil {
+		return nil, err
+	}
+	slog.WarnContext(ctx, "serving last known good stats", "user", userID, "error", err)
+	return last, nil
+}
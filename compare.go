@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+)
+
+// compareRow is one stat of a /compare response. Leader is "a", "b", "tie",
+// or empty when the values can’t be compared.
+type compareRow struct {
+	Field  string      `json:"field"`
+	Label  string      `json:"label"`
+	A      interface{} `json:"a"`
+	B      interface{} `json:"b"`
+	Leader string      `json:"leader,omitempty"`
+}
+
+// trackedUser reports whether id is one of the configured users.
+func trackedUser(id string) bool {
+	for _, u := range configuredUsers() {
+		if u == id {
+			return true
+		}
+	}
+	return false
+}
+
+// todaysStats returns userID’s stored snapshot for today, fetching it from
+// HTB (without notifying) when there is none yet — or, with a refresh queue,
+// returning yesterday’s while it is fetched. With STALE_ON_ERROR a failed
+// fetch returns the last known good snapshot.
+func todaysStats(ctx context.Context, tableName, userID string) (map[string]interface{}, error) {
+	today := currentDate()
+	item, err := loadItem(ctx, userTable(userID, tableName), itemKey(userID, today))
+	if err != nil {
+		return nil, &refreshError{msg: "Database lookup failed", cause: err}
+	}
+	if len(item) > 1 && !refreshDue(item) {
+		return item, nil
+	}
+	if len(item) <= 1 {
+		if stale := staleWhileRevalidate(ctx, tableName, userID, today); stale != nil {
+			return stale, nil
+		}
+	}
+	info, err := refreshUser(ctx, tableName, userID, today, false)
+	if err != nil {
+		return staleOnError(ctx, tableName, userID, err)
+	}
+	return info, nil
+}
+
+// compareStats lines up the tracked fields of two snapshots and names the
+// leader of each.
+func compareStats(a, b map[string]interface{}, locale string) []compareRow {
+	var rows []compareRow
+	for _, field := range trackedFields {
+		row := compareRow{Field: field, Label: fieldLabel(locale, field), A: a[field], B: b[field]}
+		if row.A == nil && row.B == nil {
+			continue
+		}
+		// a “change” from b to a tells whether a is ahead
+		switch improved, ok := (Change{Field: field, Old: b[field], New: a[field]}).Improved(); {
+		case !ok:
+		case sameValue(row.A, row.B):
+			row.Leader = "tie"
+		case improved:
+			row.Leader = "a"
+		default:
+			row.Leader = "b"
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// compareHandler serves /compare?a=ID&b=ID: both tracked users’ stats side by
+// side. Field labels follow ?lang= like the stats response.
+func compareHandler(ctx context.Context, inv invocation) (map[string]interface{}, error) {
+	tableName := os.Getenv("TABLE_NAME")
+	if tableName == "" {
+		return httpResponse(http.StatusInternalServerError, map[string]string{"error": "TABLE_NAME not configured"}), nil
+	}
+	a, b := inv.QueryParams["a"], inv.QueryParams["b"]
+	if a == "" || b == "" {
+		return httpResponse(http.StatusBadRequest, map[string]string{"error": "a and b are required"}), nil
+	}
+	if !trackedUser(a) || !trackedUser(b) || !inv.tenant.allows(a) || !inv.tenant.allows(b) {
+		return httpResponse(http.StatusNotFound, map[string]string{"error": "unknown user"}), nil
+	}
+
+	statsA, err := todaysStats(ctx, tableName, a)
+	if err != nil {
+		return refreshFailure(err), nil
+	}
+	statsB, err := todaysStats(ctx, tableName, b)
+	if err != nil {
+		return refreshFailure(err), nil
+	}
+
+	locale := normalizeLocale(inv.QueryParams["lang"])
+	if locale == "" {
+		locale = defaultLocale
+	}
+	return httpResponse(http.StatusOK, map[string]interface{}{
+		"a":      a,
+		"b":      b,
+		"fields": compareStats(statsA, statsB, locale),
+	}), nil
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	configMutex sync.Mutex
+	// configModTime is the modification time of CONFIG_FILE when last read
+	configModTime time.Time
+	// configValues are the variables the file set, with the value it set
+	configValues = map[string]string{}
+)
+
+// loadConfigFile reads the YAML file at CONFIG_FILE (e.g. a config.yaml
+// bundled with the function) as an alternative to setting every variable on
+// the function. Top‑level keys are the usual variable names; values already
+// set in the environment win, so single settings can still be overridden per
+// deployment. A "users" list takes the CONFIG_JSON entries. reloadConfigFile
+// applies later edits in a warm container.
+//
+//	TABLE_NAME: HTBStatsCache
+//	USER_ID: "123456"
+//	SLACK_WEBHOOK_URL: https://hooks.slack.com/services/...
+//	users:
+//	  - user_id: "654321"
+//	    token_ref: env:TOKEN_ALICE
+func loadConfigFile() error {
+	path := os.Getenv("CONFIG_FILE")
+	if path == "" {
+		return nil
+	}
+	configMutex.Lock()
+	defer configMutex.Unlock()
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var file struct {
+		Users    []userConfig           `yaml:"users"`
+		Settings map[string]interface{} `yaml:",inline"`
+	}
+	if err := yaml.Unmarshal(raw, &file); err != nil {
+		return fmt.Errorf("parsing %s: %w", path, err)
+	}
+	values := map[string]string{}
+	for name, value := range file.Settings {
+		switch v := value.(type) {
+		case string, int, float64, bool:
+			values[name] = fmt.Sprint(v)
+		default:
+			// nested values (rules, routes, milestones) stay YAML
+			out, err := yaml.Marshal(v)
+			if err != nil {
+				return fmt.Errorf("%s in %s: %w", name, path, err)
+			}
+			values[name] = string(out)
+		}
+	}
+	for _, c := range file.Users {
+		if err := c.validate(); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	// a variable is the file’s to change while it still holds what the file
+	// set; anything set by the function configuration or SSM is left alone
+	for name, value := range values {
+		old, had := configValues[name]
+		if current, set := os.LookupEnv(name); !set || had && current == old {
+			os.Setenv(name, value)
+			configValues[name] = value
+		}
+	}
+	for name, old := range configValues {
+		if _, kept := values[name]; !kept {
+			if os.Getenv(name) == old {
+				os.Unsetenv(name)
+			}
+			delete(configValues, name)
+		}
+	}
+	usersMutex.Lock()
+	fileUsers = file.Users
+	usersMutex.Unlock()
+	configModTime = info.ModTime()
+	return nil
+}
+
+// configFlag takes a --config path (or --config=path; -config also works)
+// out of args and returns it with the remaining arguments, so the
+// command‑line tools and local runs can name the file as
+// `bootstrap --config config.yaml validate`. It is applied in init, before
+// the file is read, by setting CONFIG_FILE; a flag overrides the variable.
+func configFlag(args []string) (path string, rest []string) {
+	for i := 0; i < len(args); i++ {
+		switch a := args[i]; {
+		case a == "--config" || a == "-config":
+			if i+1 < len(args) {
+				path = args[i+1]
+				i++
+			}
+		case strings.HasPrefix(a, "--config=") || strings.HasPrefix(a, "-config="):
+			_, path, _ = strings.Cut(a, "=")
+		default:
+			rest = append(rest, a)
+		}
+	}
+	return path, rest
+}
+
+// reloadConfigFile runs loadConfigFile again when CONFIG_FILE has changed
+// since it was read, e.g. on a mounted EFS volume, so new users and
+// notifier settings apply without waiting for a cold start. A file that no
+// longer parses is logged and the previous settings stay.
+func reloadConfigFile() {
+	path := os.Getenv("CONFIG_FILE")
+	if path == "" {
+		return
+	}
+	info, err := os.Stat(path)
+	configMutex.Lock()
+	unchanged := err == nil && info.ModTime().Equal(configModTime)
+	configMutex.Unlock()
+	if unchanged {
+		return
+	}
+	if err := loadConfigFile(); err != nil {
+		slog.Error("reloading config file failed, keeping the previous one", "error", err)
+		return
+	}
+	setUserConfigs()
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// settingRule checks the value of one variable when it is set.
+type settingRule struct {
+	name  string
+	check func(string) error
+}
+
+func checkID(s string) error {
+	if n, err := strconv.Atoi(s); err != nil || n <= 0 {
+		return errors.New("want a numeric HTB ID")
+	}
+	return nil
+}
+
+func checkIDList(s string) error {
+	for _, id := range splitList(s) {
+		if checkID(id) != nil {
+			return fmt.Errorf("%q is not a numeric HTB ID", id)
+		}
+	}
+	return nil
+}
+
+func checkDuration(s string) error {
+	if d, err := time.ParseDuration(s); err != nil || d < 0 {
+		return errors.New("want a duration such as 30s or 5m")
+	}
+	return nil
+}
+
+func checkCount(s string) error {
+	if n, err := strconv.Atoi(s); err != nil || n < 0 {
+		return errors.New("want a whole number")
+	}
+	return nil
+}
+
+func checkFraction(s string) error {
+	if f, err := strconv.ParseFloat(s, 64); err != nil || f <= 0 {
+		return errors.New("want a positive number")
+	}
+	return nil
+}
+
+func checkBool(s string) error {
+	if s != "true" && s != "false" {
+		return errors.New("want true or false")
+	}
+	return nil
+}
+
+func checkURL(s string) error {
+	if u, err := url.Parse(s); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("want an http(s) URL")
+	}
+	return nil
+}
+
+func checkARN(s string) error {
+	if !strings.HasPrefix(s, "arn:") {
+		return errors.New("want an ARN")
+	}
+	return nil
+}
+
+// settingSchema lists the variables with a constrained value. Free‑form
+// ones (names, bucket prefixes, e‑mail addresses) aren’t listed.
+var settingSchema = []settingRule{
+	{"USER_ID", checkID},
+	{"USER_IDS", checkIDList},
+	{"TEAM_ID", checkID},
+	{"UNIVERSITY_ID", checkID},
+	{"HTTP_TIMEOUT", checkDuration},
+	{"BACKOFF_BASE", checkDuration},
+	{"CONFIG_SSM_TTL", checkDuration},
+	{"TOKEN_SECRET_TTL", checkDuration},
+	{"CIRCUIT_COOLDOWN", checkDuration},
+	{"FAILURE_TTL", checkDuration},
+	{"HTB_PROBE_TTL", checkDuration},
+	{"CACHE_TTL", checkDuration},
+	{"MAX_RETRIES", checkCount},
+	{"NOTIFY_RETRIES", checkCount},
+	{"RANKED_USERS", checkCount},
+	{"SEASON_TOP_N", checkCount},
+	{"RETENTION_DAYS", checkCount},
+	{"INTRADAY_RETENTION_DAYS", checkCount},
+	{"REPORT_LINK_DAYS", checkCount},
+	{"TOKEN_ALERT_AFTER", checkCount},
+	{"TOKEN_EXPIRY_WARN_DAYS", checkCount},
+	{"UNIVERSITY_MAX_MEMBERS", checkCount},
+	{"CIRCUIT_FAILURES", checkCount},
+	{"COUNTRY_MAX_PAGES", checkCount},
+	{"REFRESH_RETRIES", checkCount},
+	{"PLAUSIBLE_MAX_DROP", checkCount},
+	{"ANOMALY_THRESHOLD", checkFraction},
+	{"HTB_RATE_LIMIT", checkFraction},
+	{"TRACK_SEASON", checkBool},
+	{"FETCH_BLOOD_DETAILS", checkBool},
+	{"ANOMALY_ALERTS", checkBool},
+	{"NOTIFY_BATCH", checkBool},
+	{"NOTIFY_DEDUP", checkBool},
+	{"STAT_METRICS", checkBool},
+	{"STALE_ON_ERROR", checkBool},
+	{"CHAOS", checkChaos},
+	{"LOG_LEVEL", checkLogLevel},
+	{"HTB_API_BASE_URL", checkURL},
+	{"REFRESH_QUEUE_URL", checkURL},
+	{"NOTIFY_DLQ_URL", checkURL},
+	{"SLACK_WEBHOOK_URL", checkURL},
+	{"WEBHOOK_URL", checkURL},
+	{"NTFY_SERVER", checkURL},
+	{"OPSGENIE_API_URL", checkURL},
+	{"REPORT_PDF_URL", checkURL},
+	{"SNS_TOPIC_ARN", checkARN},
+	{"TOKEN_SECRET_ARN", checkARN},
+	{"TIMEZONE", func(s string) error {
+		_, err := time.LoadLocation(s)
+		return err
+	}},
+	{"REFRESH_INTERVAL", func(s string) error {
+		if d, err := time.ParseDuration(s); err != nil || d < time.Hour || d >= 24*time.Hour || d%time.Hour != 0 {
+			return errors.New("want whole hours between 1h and 23h")
+		}
+		return nil
+	}},
+	{"LOCALE", func(s string) error {
+		if normalizeLocale(s) == "" {
+			return errors.New("no translation for this language")
+		}
+		return nil
+	}},
+	{"ENVIRONMENT", func(s string) error {
+		if strings.Contains(s, "#") {
+			return errors.New("must not contain #")
+		}
+		return nil
+	}},
+	{"SKIP_FETCH", func(s string) error {
+		for _, skip := range splitList(s) {
+			known := false
+			for _, call := range skippableFetches {
+				known = known || strings.EqualFold(skip, call)
+			}
+			if !known {
+				return fmt.Errorf("unknown call %q, want one of %s", skip, strings.Join(skippableFetches, ", "))
+			}
+		}
+		return nil
+	}},
+}
+
+// configProblems checks the whole configuration at once — required
+// variables, every value in settingSchema and the structured settings — and
+// returns one line per problem, so a bad deploy is fixed in one go rather
+// than discovered a request at a time.
+func configProblems() []string {
+	var problems []string
+	for _, name := range []string{"TABLE_NAME", "USER_ID"} {
+		if os.Getenv(name) == "" {
+			problems = append(problems, name+" is required")
+		}
+	}
+	for _, rule := range settingSchema {
+		if v := os.Getenv(rule.name); v != "" {
+			if err := rule.check(v); err != nil {
+				problems = append(problems, fmt.Sprintf("%s=%q: %v", rule.name, v, err))
+			}
+		}
+	}
+
+	var routes map[string][]string
+	var rules []Rule
+	var milestones map[string]float64
+	var tenantList []tenant
+	var headers map[string]string
+	for _, setting := range []struct {
+		name   string
+		target interface{}
+	}{
+		{"NOTIFY_ROUTES", &routes},
+		{"NOTIFY_RULES", &rules},
+		{"MILESTONES", &milestones},
+		{"TENANTS", &tenantList},
+		{"HTB_HEADERS", &headers},
+	} {
+		if err := loadYAMLSetting(setting.name, setting.target); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", setting.name, err))
+		}
+	}
+	for _, r := range rules {
+		switch r.When {
+		case "", "changed", "improved", "worsened", "enters_below", "leaves_below", "multiple_of", "min_delta":
+		default:
+			problems = append(problems, fmt.Sprintf("NOTIFY_RULES: unknown condition %q for %s", r.When, r.Field))
+		}
+	}
+	for _, t := range tenantList {
+		if t.Name == "" || len(t.KeySHA256) != 64 || len(t.Users) == 0 || strings.Contains(t.Name, "#") {
+			problems = append(problems, fmt.Sprintf("TENANTS: tenant %q needs a name without #, a hex key_sha256 and at least one user", t.Name))
+		}
+		if err := checkIDList(strings.Join(t.Users, ",")); err != nil {
+			problems = append(problems, fmt.Sprintf("TENANTS: tenant %q: %v", t.Name, err))
+		}
+	}
+	return problems
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// activityMetrics are the daily gains correlated with rank movement.
+var activityMetrics = []string{"System_Owns", "User_Owns", "System_Bloods", "User_Bloods", "Challenge_Owns"}
+
+// correlationResult relates one kind of activity to the global‑rank movement
+// of the following lag days. Correlation is Pearson’s r; PlacesPerUnit is the
+// regression slope, i.e. the places gained per extra own, blood or solve.
+type correlationResult struct {
+	Metric        string  `json:"metric"`
+	ActiveDays    int     `json:"active_days"`
+	Total         int     `json:"total"`
+	Correlation   float64 `json:"correlation"`
+	PlacesPerUnit float64 `json:"places_per_unit"`
+}
+
+// correlationSample is one day’s activity and the rank movement after it.
+type correlationSample struct {
+	gains  map[string]float64
+	places float64
+}
+
+// correlationSamples pairs the gains of every day from from to to with the
+// global places climbed from that day to lag days later. Only days with both
+// neighbours stored are used, so gaps and anomalous snapshots don’t smear
+// activity over several days.
+func correlationSamples(points []map[string]interface{}, from, to time.Time, lag int) []correlationSample {
+	byDate := make(map[string]map[string]interface{}, len(points))
+	for _, p := range points {
+		byDate[p["date"].(string)] = p
+	}
+	var samples []correlationSample
+	for _, p := range points {
+		d, err := time.Parse("2006-01-02", p["date"].(string))
+		if err != nil || d.Before(from) || d.After(to) || p["Anomalies"] != nil {
+			continue
+		}
+		before := byDate[d.AddDate(0, 0, -1).Format("2006-01-02")]
+		after := byDate[d.AddDate(0, 0, lag).Format("2006-01-02")]
+		if before == nil || after == nil || after["Anomalies"] != nil {
+			continue
+		}
+		oldRank, okOld := toFloat(p["User_Global_Rank"])
+		newRank, okNew := toFloat(after["User_Global_Rank"])
+		if !okOld || !okNew || oldRank <= 0 || newRank <= 0 {
+			continue
+		}
+		s := correlationSample{gains: map[string]float64{}, places: oldRank - newRank}
+		for _, m := range activityMetrics {
+			oldV, okOld := toFloat(before[m])
+			newV, okNew := toFloat(p[m])
+			if okOld && okNew {
+				s.gains[m] = math.Max(newV-oldV, 0)
+			}
+		}
+		samples = append(samples, s)
+	}
+	return samples
+}
+
+// correlate computes r and the least‑squares slope of ys on xs.
+func correlate(xs, ys []float64) (r, slope float64) {
+	n := float64(len(xs))
+	if n < 2 {
+		return 0, 0
+	}
+	var sx, sy float64
+	for i := range xs {
+		sx += xs[i]
+		sy += ys[i]
+	}
+	mx, my := sx/n, sy/n
+	var cov, vx, vy float64
+	for i := range xs {
+		dx, dy := xs[i]-mx, ys[i]-my
+		cov += dx * dy
+		vx += dx * dx
+		vy += dy * dy
+	}
+	if vx == 0 {
+		return 0, 0
+	}
+	slope = cov / vx
+	if vy > 0 {
+		r = cov / math.Sqrt(vx*vy)
+	}
+	return math.Round(r*1000) / 1000, math.Round(slope*100) / 100
+}
+
+// correlations relates each activity metric to the rank movement after it,
+// strongest correlation first.
+func correlations(samples []correlationSample) []correlationResult {
+	out := make([]correlationResult, 0, len(activityMetrics))
+	for _, m := range activityMetrics {
+		res := correlationResult{Metric: m}
+		var xs, ys []float64
+		for _, s := range samples {
+			g, ok := s.gains[m]
+			if !ok {
+				continue
+			}
+			xs = append(xs, g)
+			ys = append(ys, s.places)
+			if g > 0 {
+				res.ActiveDays++
+				res.Total += int(g)
+			}
+		}
+		res.Correlation, res.PlacesPerUnit = correlate(xs, ys)
+		out = append(out, res)
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Correlation > out[j].Correlation })
+	return out
+}
+
+// correlationHandler serves /correlation?from=&to=[&lag=N][&user=ID]: how
+// strongly each kind of activity went with global‑rank gains over the next
+// lag days (default 1), from the stored history.
+func correlationHandler(ctx context.Context, inv invocation) (map[string]interface{}, error) {
+	tableName := os.Getenv("TABLE_NAME")
+	if tableName == "" {
+		return httpResponse(http.StatusInternalServerError, map[string]string{"error": "TABLE_NAME not configured"}), nil
+	}
+	from, to, err := dateRange(inv, 180)
+	if err != nil {
+		return httpResponse(http.StatusBadRequest, map[string]string{"error": err.Error()}), nil
+	}
+	lag := 1
+	if s := inv.QueryParams["lag"]; s != "" {
+		if lag, err = strconv.Atoi(s); err != nil || lag < 1 || lag > 30 {
+			return httpResponse(http.StatusBadRequest, map[string]string{"error": "lag must be between 1 and 30 days"}), nil
+		}
+	}
+	user, ok := requestedUser(inv)
+	if !ok {
+		return httpResponse(http.StatusNotFound, map[string]string{"error": "unknown user"}), nil
+	}
+	// private activity metrics are left out
+	if denied := requireVisible(inv, "User_Global_Rank"); denied != nil {
+		return denied, nil
+	}
+
+	// lag days past to so the last days of the range have an outcome
+	items, err := loadRange(ctx, tableName, user, from.AddDate(0, 0, -1), to.AddDate(0, 0, lag))
+	if err != nil {
+		slog.ErrorContext(ctx, "BatchGetItem failed", "region", awsRegion, "table", tableName, "error", err)
+		return httpResponse(http.StatusInternalServerError, map[string]string{"error": "Database lookup failed", "detail": err.Error()}), nil
+	}
+	samples := correlationSamples(visibleSeries(inv, series(items)), from, to, lag)
+	metrics := correlations(samples)
+	public := metrics[:0]
+	for _, m := range metrics {
+		if fieldVisible(inv, m.Metric) {
+			public = append(public, m)
+		}
+	}
+	return httpResponse(http.StatusOK, map[string]interface{}{
+		"user":    user,
+		"from":    from.Format("2006-01-02"),
+		"to":      to.Format("2006-01-02"),
+		"lag":     lag,
+		"samples": len(samples),
+		"metrics": public,
+	}), nil
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Annotations of a countryPoint whose Local_Rank is null.
+const (
+	countryNoSnapshot  = "no_snapshot"      // nothing stored for the day
+	countryFetchFailed = "fetch_failed"     // the day’s HTB refresh failed
+	countryUnavailable = "leaderboard_down" // the country leaderboard call failed
+	countryNotListed   = "not_listed"       // the leaderboard didn’t include the user
+	countrySkipped     = "not_fetched"      // SKIP_FETCH turned the call off
+)
+
+// countryMember is one entry of HTB’s country leaderboard.
+type countryMember struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+	Rank int    `json:"rank"` // plain int
+}
+
+// is reports whether the entry is the user: by ID, or by display name for
+// entries without one, since names needn’t be unique or spelled alike.
+func (m countryMember) is(userID, name string) bool {
+	if m.ID != 0 {
+		return strconv.Itoa(m.ID) == userID
+	}
+	return name != "" && m.Name == name
+}
+
+// countryPages caps how many pages of a country leaderboard a refresh reads
+// looking for the user, from COUNTRY_MAX_PAGES (default 10).
+func countryPages() int {
+	if n, err := strconv.Atoi(os.Getenv("COUNTRY_MAX_PAGES")); err == nil && n > 0 {
+		return n
+	}
+	return 10
+}
+
+// countrySearch looks for the user in a country leaderboard streamed page by
+// page. Only the localNeighbours names read last are kept, not the pages, and
+// reading stops at the user’s entry, so a large country costs little memory.
+type countrySearch struct {
+	userID, name string
+	found        *countryMember
+	above        []interface{} // names of the entries just before, in order
+	count        int           // entries read over all pages
+
+	// of the page read last
+	pageCount, lastPage, total int
+}
+
+// errStopDecoding ends a streamed decode early, once it has what it needs.
+var errStopDecoding = errors.New("stop decoding")
+
+// decodeFrom reads one page, {"data": {"rankings": [...], "last_page",
+// "total"}, "meta": {...}}, stopping at the user’s entry. A failed read
+// leaves the search as it was, so the page can be read again.
+func (s *countrySearch) decodeFrom(r io.Reader) error {
+	above, count := s.above, s.count
+	s.pageCount, s.lastPage, s.total = 0, 0, 0
+	dec := json.NewDecoder(r)
+	counts := func(key string) error {
+		switch key {
+		case "last_page":
+			return decodeMax(dec, &s.lastPage)
+		case "total":
+			return decodeMax(dec, &s.total)
+		}
+		return skipValue(dec)
+	}
+	err := decodeObject(dec, func(key string) error {
+		switch key {
+		case "data":
+			return decodeObject(dec, func(key string) error {
+				if key == "rankings" {
+					return s.readRankings(dec)
+				}
+				return counts(key)
+			})
+		case "meta":
+			return decodeObject(dec, counts)
+		}
+		return skipValue(dec)
+	})
+	if errors.Is(err, errStopDecoding) {
+		return nil
+	}
+	if err != nil {
+		s.above, s.count = above, count
+	}
+	return err
+}
+
+func (s *countrySearch) readRankings(dec *json.Decoder) error {
+	tok, err := dec.Token()
+	if err != nil || tok == nil {
+		return err
+	}
+	if d, ok := tok.(json.Delim); !ok || d != '[' {
+		return fmt.Errorf("rankings: want an array, got %v", tok)
+	}
+	for dec.More() {
+		var m countryMember
+		if err := dec.Decode(&m); err != nil {
+			return err
+		}
+		s.count++
+		s.pageCount++
+		if m.is(s.userID, s.name) {
+			s.found = &m
+			return errStopDecoding
+		}
+		s.above = append(s.above, m.Name)
+		if len(s.above) > localNeighbours {
+			s.above = s.above[1:]
+		}
+	}
+	_, err = dec.Token()
+	return err
+}
+
+// decodeObject reads a JSON object (or null) from dec, calling field for each
+// key; field must consume the value.
+func decodeObject(dec *json.Decoder, field func(key string) error) error {
+	tok, err := dec.Token()
+	if err != nil || tok == nil {
+		return err
+	}
+	if d, ok := tok.(json.Delim); !ok || d != '{' {
+		return fmt.Errorf("want an object, got %v", tok)
+	}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		key, _ := tok.(string)
+		if err := field(key); err != nil {
+			return err
+		}
+	}
+	_, err = dec.Token()
+	return err
+}
+
+// decodeMax raises *n to the number dec reads next, if larger.
+func decodeMax(dec *json.Decoder, n *int) error {
+	var v int
+	if err := dec.Decode(&v); err != nil {
+		return err
+	}
+	*n = max(*n, v)
+	return nil
+}
+
+func skipValue(dec *json.Decoder) error {
+	var raw json.RawMessage
+	return dec.Decode(&raw)
+}
+
+// fetchCountryRanking searches the country leaderboard of code for the user,
+// page by page, until they show up, a page comes back empty or short, HTB
+// reports the last page, or countryPages is reached. It also returns the size
+// of the whole leaderboard, 0 when that isn’t known — HTB didn’t say and the
+// search stopped before the last page.
+func fetchCountryRanking(doGet func(string, interface{}) error, code, userID, name string) (*countrySearch, int, error) {
+	search := &countrySearch{userID: userID, name: name}
+	pageSize := 0
+	for page := 1; page <= countryPages(); page++ {
+		url := htbAPI("/api/v4/rankings/country/" + code + "/members")
+		if page > 1 {
+			url += "?page=" + strconv.Itoa(page)
+		}
+		if err := doGet(url, search); err != nil {
+			return search, 0, err
+		}
+		if search.found != nil {
+			return search, search.total, nil
+		}
+		if page == 1 {
+			pageSize = search.pageCount
+		}
+		if search.pageCount == 0 || search.pageCount < pageSize || search.lastPage > 0 && page >= search.lastPage {
+			return search, max(search.total, search.count), nil
+		}
+	}
+	return search, 0, nil
+}
+
+// countryPoint is one day of the derived country‑rank history.
+type countryPoint struct {
+	Date        string      `json:"date"`
+	LocalRank   interface{} `json:"local_rank"`
+	CountryCode interface{} `json:"country_code,omitempty"`
+	Missing     string      `json:"missing,omitempty"`
+	Moved       bool        `json:"country_changed,omitempty"`
+}
+
+// countrySeries derives one point per day from the stored snapshots,
+// explaining every gap and flagging days the profile changed country.
+func countrySeries(items map[string]map[string]interface{}, from, to time.Time) []countryPoint {
+	var points []countryPoint
+	var lastCode interface{}
+	for d := from; !d.After(to); d = d.AddDate(0, 0, 1) {
+		p := countryPoint{Date: d.Format("2006-01-02")}
+		item, ok := items[p.Date]
+		switch {
+		case !ok:
+			p.Missing = countryNoSnapshot
+		case len(item) <= 1:
+			p.Missing = countryFetchFailed
+		default:
+			p.CountryCode = item["Country_Code"]
+			if rank, ok := toFloat(item["Local_Rank"]); ok && rank > 0 {
+				p.LocalRank = rank
+			} else if item["Country_Unavailable"] == true {
+				p.Missing = countryUnavailable
+			} else if item["Country_Skipped"] == true {
+				p.Missing = countrySkipped
+			} else {
+				p.Missing = countryNotListed
+			}
+			if lastCode != nil && p.CountryCode != nil && !sameValue(lastCode, p.CountryCode) {
+				p.Moved = true
+			}
+			if p.CountryCode != nil {
+				lastCode = p.CountryCode
+			}
+		}
+		points = append(points, p)
+	}
+	return points
+}
+
+// countryHistoryHandler serves /history/country?from=&to=[&user=ID]: the
+// Local_Rank series HTB itself doesn’t keep, derived from the daily
+// snapshots, with every missing day annotated.
+func countryHistoryHandler(ctx context.Context, inv invocation) (map[string]interface{}, error) {
+	tableName := os.Getenv("TABLE_NAME")
+	if tableName == "" {
+		return httpResponse(http.StatusInternalServerError, map[string]string{"error": "TABLE_NAME not configured"}), nil
+	}
+	from, to, err := dateRange(inv, 90)
+	if err != nil {
+		return httpResponse(http.StatusBadRequest, map[string]string{"error": err.Error()}), nil
+	}
+	user, ok := requestedUser(inv)
+	if !ok {
+		return httpResponse(http.StatusNotFound, map[string]string{"error": "unknown user"}), nil
+	}
+	if !fieldVisible(inv, "Local_Rank") {
+		return fieldForbidden("Local_Rank"), nil
+	}
+
+	items, err := loadRange(ctx, tableName, user, from, to)
+	if err != nil {
+		slog.ErrorContext(ctx, "BatchGetItem failed", "region", awsRegion, "table", tableName, "error", err)
+		return httpResponse(http.StatusInternalServerError, map[string]string{"error": "Database lookup failed", "detail": err.Error()}), nil
+	}
+	points := countrySeries(items, from, to)
+	if !fieldVisible(inv, "Country_Code") {
+		for i := range points {
+			points[i].CountryCode, points[i].Moved = nil, false
+		}
+	}
+	return httpResponse(http.StatusOK, map[string]interface{}{
+		"user":   user,
+		"from":   from.Format("2006-01-02"),
+		"to":     to.Format("2006-01-02"),
+		"points": points,
+	}), nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// sentTTL is how long a delivery fingerprint is remembered. The table’s TTL
+// attribute must be set to expires_at for these items to be cleaned up.
+const sentTTL = 7 * 24 * time.Hour
+
+// notificationFingerprint identifies one alert on one channel for one day, so
+// the same changes re‑detected by a retried or concurrent refresh match.
+func notificationFingerprint(channel string, changes []Change) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s|%s", channel, currentDate())
+	for _, c := range changes {
+		fmt.Fprintf(h, "|%s/%s/%s/%s/%s", c.User, c.Field, formatValue(c.Old), formatValue(c.New), c.Detail)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// sendOnce delivers changes through n at most once: a fingerprint item is
+// claimed with a conditional write before sending, and a second claim of the
+// same fingerprint skips the send. The claim is released if delivery fails
+// outright so a later attempt can retry. NOTIFY_DEDUP=false disables this.
+func sendOnce(ctx context.Context, n Notifier, changes []Change) error {
+	tableName := os.Getenv("TABLE_NAME")
+	if tableName == "" || os.Getenv("NOTIFY_DEDUP") == "false" {
+		return notifyWithRetry(ctx, n, changes)
+	}
+
+	key := map[string]types.AttributeValue{
+		"date": &types.AttributeValueMemberS{Value: envKey("sent#" + notificationFingerprint(n.Name(), changes))},
+	}
+	item := map[string]types.AttributeValue{
+		"expires_at": &types.AttributeValueMemberN{Value: strconv.FormatInt(time.Now().Add(sentTTL).Unix(), 10)},
+	}
+	for k, v := range key {
+		item[k] = v
+	}
+	_, err := dynamoClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:                aws.String(tableName),
+		Item:                     item,
+		ConditionExpression:      aws.String("attribute_not_exists(#k)"),
+		ExpressionAttributeNames: map[string]string{"#k": "date"},
+	})
+	var condErr *types.ConditionalCheckFailedException
+	if errors.As(err, &condErr) {
+		slog.InfoContext(ctx, "skipping duplicate notification", "channel", n.Name())
+		return nil
+	}
+	if err != nil {
+		// failing open: a possible duplicate beats a lost alert
+		slog.ErrorContext(ctx, "claiming notification failed", "channel", n.Name(), "error", err)
+		return notifyWithRetry(ctx, n, changes)
+	}
+
+	err = notifyWithRetry(ctx, n, changes)
+	if err != nil && !errors.Is(err, errDeadLettered) {
+		if _, delErr := dynamoClient.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+			TableName: aws.String(tableName),
+			Key:       key,
+		}); delErr != nil {
+			slog.ErrorContext(ctx, "releasing notification claim failed", "channel", n.Name(), "error", delErr)
+		}
+	}
+	return err
+}
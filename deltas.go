@@ -0,0 +1,41 @@
+package main
+
+// dayDeltas returns the day‑over‑day movement shown by widgets as ▲/▼:
+// Rank_Change and Local_Rank_Change are positive when the user climbed,
+// Owns_Change is the number of system and user owns gained. Fields whose
+// previous value is unknown, or a country rank from another country, are
+// left out.
+func dayDeltas(prev, curr map[string]interface{}) map[string]interface{} {
+	deltas := map[string]interface{}{}
+	if len(prev) <= 1 {
+		return deltas
+	}
+	rankDelta := func(field string) (int, bool) {
+		oldV, okOld := toFloat(prev[field])
+		newV, okNew := toFloat(curr[field])
+		if !okOld || !okNew || oldV <= 0 || newV <= 0 {
+			return 0, false
+		}
+		return int(oldV - newV), true
+	}
+	if d, ok := rankDelta("User_Global_Rank"); ok {
+		deltas["Rank_Change"] = d
+	}
+	if d, ok := rankDelta("Local_Rank"); ok && !countryMoved(prev, curr) {
+		deltas["Local_Rank_Change"] = d
+	}
+
+	oldOwns, okOld := totalOwns(prev)
+	newOwns, okNew := totalOwns(curr)
+	if okOld && okNew {
+		deltas["Owns_Change"] = int(newOwns - oldOwns)
+	}
+	return deltas
+}
+
+// totalOwns is the snapshot’s system plus user owns.
+func totalOwns(item map[string]interface{}) (float64, bool) {
+	system, okS := toFloat(item["System_Owns"])
+	user, okU := toFloat(item["User_Owns"])
+	return system + user, okS && okU
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+)
+
+// diffFields are compared by /diff beyond trackedFields, in display order.
+var diffFields = []string{
+	"Points",
+	"Rank_Ownership",
+	"Country_Code",
+	"Season_ID",
+	"Season_Tier",
+	"Season_Rank",
+	"Season_Points",
+	"Season_Machines",
+	"Longest_Streak",
+	"Longest_Week_Streak",
+}
+
+// diffSearchDays is how far back /diff looks for a snapshot when the
+// requested date has none.
+const diffSearchDays = 7
+
+// diffRow is one field that differs between the two snapshots.
+type diffRow struct {
+	Field    string      `json:"field"`
+	Label    string      `json:"label"`
+	Old      interface{} `json:"old"`
+	New      interface{} `json:"new"`
+	Delta    *float64    `json:"delta,omitempty"`
+	Improved *bool       `json:"improved,omitempty"`
+}
+
+// snapshotDiff lists every compared field that differs between a and b, the
+// per‑category challenge gains and the badges earned in between.
+func snapshotDiff(a, b map[string]interface{}, locale string) (rows []diffRow, categories map[string]int, badges []string) {
+	for _, field := range append(append([]string{}, trackedFields...), diffFields...) {
+		oldV, newV := a[field], b[field]
+		if oldV == nil && newV == nil || sameValue(oldV, newV) {
+			continue
+		}
+		row := diffRow{Field: field, Label: fieldLabel(locale, field), Old: oldV, New: newV}
+		oldF, okOld := toFloat(oldV)
+		newF, okNew := toFloat(newV)
+		if okOld && okNew {
+			delta := newF - oldF
+			row.Delta = &delta
+		}
+		if improved, ok := (Change{Field: field, Old: oldV, New: newV}).Improved(); ok {
+			row.Improved = &improved
+		}
+		rows = append(rows, row)
+	}
+
+	categories = map[string]int{}
+	oldCats, _ := a["Challenge_Categories"].(map[string]interface{})
+	newCats, _ := b["Challenge_Categories"].(map[string]interface{})
+	for name, v := range newCats {
+		n, _ := toFloat(v)
+		o, _ := toFloat(oldCats[name])
+		if n != o {
+			categories[name] = int(n - o)
+		}
+	}
+
+	badges = []string{}
+	for _, c := range detectNewBadges(a, b) {
+		badges = append(badges, formatValue(c.New))
+	}
+	return rows, categories, badges
+}
+
+// snapshotNear returns the snapshot stored for day or, failing that, the
+// latest one in the diffSearchDays before it.
+func snapshotNear(ctx context.Context, tableName, userID string, day time.Time) (map[string]interface{}, error) {
+	items, err := loadRange(ctx, tableName, userID, day.AddDate(0, 0, -diffSearchDays), day)
+	if err != nil {
+		return nil, err
+	}
+	points := series(items)
+	if len(points) == 0 {
+		return nil, nil
+	}
+	return points[len(points)-1], nil
+}
+
+// diffHandler serves /diff?from=&to=[&user=ID][&lang=]: the field‑by‑field
+// changes between two stored snapshots. A date without a snapshot uses the
+// latest one from the week before it; the dates actually used are returned.
+func diffHandler(ctx context.Context, inv invocation) (map[string]interface{}, error) {
+	tableName := os.Getenv("TABLE_NAME")
+	if tableName == "" {
+		return httpResponse(http.StatusInternalServerError, map[string]string{"error": "TABLE_NAME not configured"}), nil
+	}
+	if inv.QueryParams["from"] == "" {
+		return httpResponse(http.StatusBadRequest, map[string]string{"error": "from is required"}), nil
+	}
+	from, err := time.Parse("2006-01-02", inv.QueryParams["from"])
+	if err != nil {
+		return httpResponse(http.StatusBadRequest, map[string]string{"error": "invalid from: want YYYY-MM-DD"}), nil
+	}
+	to := currentDay()
+	if s := inv.QueryParams["to"]; s != "" {
+		if to, err = time.Parse("2006-01-02", s); err != nil {
+			return httpResponse(http.StatusBadRequest, map[string]string{"error": "invalid to: want YYYY-MM-DD"}), nil
+		}
+	}
+	if from.After(to) {
+		return httpResponse(http.StatusBadRequest, map[string]string{"error": "from is after to"}), nil
+	}
+	user, ok := requestedUser(inv)
+	if !ok {
+		return httpResponse(http.StatusNotFound, map[string]string{"error": "unknown user"}), nil
+	}
+
+	var snaps [2]map[string]interface{}
+	for i, day := range []time.Time{from, to} {
+		if snaps[i], err = snapshotNear(ctx, tableName, user, day); err != nil {
+			slog.ErrorContext(ctx, "BatchGetItem failed", "region", awsRegion, "table", tableName, "error", err)
+			return httpResponse(http.StatusInternalServerError, map[string]string{"error": "Database lookup failed", "detail": err.Error()}), nil
+		}
+		if snaps[i] == nil {
+			return httpResponse(http.StatusNotFound, map[string]string{"error": "no snapshot in the week before " + day.Format("2006-01-02")}), nil
+		}
+	}
+
+	locale := normalizeLocale(inv.QueryParams["lang"])
+	if locale == "" {
+		locale = defaultLocale
+	}
+	rows, categories, badges := snapshotDiff(snaps[0], snaps[1], locale)
+	return httpResponse(http.StatusOK, map[string]interface{}{
+		"user":       user,
+		"from":       snaps[0]["date"],
+		"to":         snaps[1]["date"],
+		"changes":    rows,
+		"categories": categories,
+		"badges":     badges,
+	}), nil
+}
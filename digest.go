@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"html/template"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2"
+	sestypes "github.com/aws/aws-sdk-go-v2/service/sesv2/types"
+)
+
+var digestTemplate = template.Must(template.New("digest").Funcs(template.FuncMap{
+	"t": func(key string) string { return tr(key) },
+}).Parse(`<html><body style="font-family:sans-serif">
+<h2>{{t "digest.title"}}</h2>
+<p>{{.From}} → {{.To}}</p>
+{{range .Sections}}{{if .User}}<h3>{{.User}}</h3>
+{{end}}{{if .Changes}}<table cellpadding="6" style="border-collapse:collapse">
+<tr><th align="left">{{t "digest.stat"}}</th><th>{{t "digest.start"}}</th><th>{{t "digest.end"}}</th><th></th></tr>
+{{range .Changes}}<tr><td>{{.Label}}</td><td align="center">{{.OldText}}</td><td align="center">{{.NewText}}</td><td>{{.Arrow}}</td></tr>
+{{end}}</table>{{else}}<p>{{t "digest.none"}}</p>{{end}}
+{{end}}</body></html>`))
+
+// digestRow adapts a Change for the HTML template.
+type digestRow struct {
+	Change
+	OldText, NewText string
+}
+
+// digestSection is one tracked user’s part of the digest email; User is
+// only set when several users are tracked.
+type digestSection struct {
+	User    string
+	Changes []digestRow
+}
+
+// weeklyDigest aggregates the last seven days of each tracked user’s
+// snapshots into a set of deltas and sends them to the channels routed for
+// the digest: an SES email to DIGEST_TO for "email", with a section per
+// user, and one regular message for any notifier, its changes tagged with
+// their user like a batch.
+func weeklyDigest(ctx context.Context) (map[string]interface{}, error) {
+	tableName := os.Getenv("TABLE_NAME")
+	if tableName == "" {
+		return map[string]interface{}{"error": "TABLE_NAME not configured"}, nil
+	}
+	sender := os.Getenv("DIGEST_FROM")
+	recipients := splitList(os.Getenv("DIGEST_TO"))
+	email := routed(kindDigest, "email") && sender != "" && len(recipients) > 0
+
+	to := currentDay()
+	from := to.AddDate(0, 0, -7)
+	users := configuredUsers()
+	if len(users) == 0 {
+		return map[string]interface{}{"error": "USER_ID not configured"}, nil
+	}
+	var changes []Change
+	var sections []digestSection
+	failed := 0
+	for _, user := range users {
+		items, err := loadRange(ctx, tableName, user, from, to)
+		if err != nil {
+			slog.ErrorContext(ctx, "BatchGetItem failed", "region", awsRegion, "table", userTable(user, tableName), "user", user, "error", err)
+			failed++
+			continue
+		}
+		first, last := weekBounds(items)
+		section := digestSection{}
+		if len(users) > 1 {
+			section.User = user
+		}
+		for _, c := range detectChanges(first, last) {
+			c.User = section.User
+			changes = append(changes, c)
+			section.Changes = append(section.Changes, digestRow{Change: c, OldText: formatValue(c.Old), NewText: formatValue(c.New)})
+		}
+		sections = append(sections, section)
+	}
+	if failed > 0 && failed == len(users) {
+		return map[string]interface{}{"error": "Database lookup failed"}, nil
+	}
+	res := map[string]interface{}{"changes": len(changes), "users": len(sections)}
+	if failed > 0 {
+		res["failed"] = failed
+	}
+
+	channels := 0
+	for _, n := range configuredNotifiers() {
+		// the "email" route is served by the HTML digest below
+		if n.Name() == "email" || !routed(kindDigest, n.Name()) {
+			continue
+		}
+		var sent []Change
+		for _, c := range changes {
+			if c.User == "" || userChannel(c.User, n.Name()) {
+				sent = append(sent, c)
+			}
+		}
+		if len(sent) == 0 {
+			continue
+		}
+		if err := deliver(ctx, n, sent); err != nil {
+			slog.ErrorContext(ctx, "digest failed", "channel", n.Name(), "error", err)
+			continue
+		}
+		channels++
+	}
+	res["channels"] = channels
+	if !email {
+		return res, nil
+	}
+
+	// NOTIFY_TEMPLATE_DIGEST, or NOTIFY_TEMPLATE, replaces the built‑in table
+	body, custom, err := renderTemplate(ctx, "digest", changes)
+	if err != nil {
+		return map[string]interface{}{"error": err.Error()}, nil
+	}
+	if !custom {
+		var buf bytes.Buffer
+		if err := digestTemplate.Execute(&buf, map[string]interface{}{
+			"From":     from.Format("2006-01-02"),
+			"To":       to.Format("2006-01-02"),
+			"Sections": sections,
+		}); err != nil {
+			return map[string]interface{}{"error": err.Error()}, nil
+		}
+		body = buf.String()
+	}
+
+	if err := sendEmail(ctx, sender, recipients, tr("digest.subject"), body); err != nil {
+		slog.ErrorContext(ctx, "SES SendEmail failed", "error", err)
+		return map[string]interface{}{"error": "Error sending digest", "detail": err.Error()}, nil
+	}
+	res["sent"] = len(recipients)
+	return res, nil
+}
+
+// weekBounds returns the earliest and latest snapshots that actually hold
+// stats, skipping empty negative‑cache items.
+func weekBounds(items map[string]map[string]interface{}) (first, last map[string]interface{}) {
+	dates := make([]string, 0, len(items))
+	for d, item := range items {
+		if len(item) > 1 {
+			dates = append(dates, d)
+		}
+	}
+	if len(dates) == 0 {
+		return nil, nil
+	}
+	sort.Strings(dates)
+	return items[dates[0]], items[dates[len(dates)-1]]
+}
+
+func sendEmail(ctx context.Context, from string, to []string, subject, htmlBody string) error {
+	if len(to) == 0 {
+		return errors.New("no recipients")
+	}
+	client := sesv2.NewFromConfig(awsCfg)
+	_, err := client.SendEmail(ctx, &sesv2.SendEmailInput{
+		FromEmailAddress: aws.String(from),
+		Destination:      &sestypes.Destination{ToAddresses: to},
+		Content: &sestypes.EmailContent{
+			Simple: &sestypes.Message{
+				Subject: &sestypes.Content{Data: aws.String(subject)},
+				Body:    &sestypes.Body{Html: &sestypes.Content{Data: aws.String(htmlBody)}},
+			},
+		},
+	})
+	return err
+}
+
+// splitList parses a comma‑separated env value, dropping blanks.
+func splitList(s string) []string {
+	var out []string
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
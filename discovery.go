@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// discoveryTTL is how long a discovered member list is used before HTB is
+// asked again; membership changes rarely.
+const discoveryTTL = time.Hour
+
+// defaultUniversityMax caps how many university members are tracked when
+// UNIVERSITY_MAX_MEMBERS isn’t set.
+const defaultUniversityMax = 50
+
+// htbMember is an entry of HTB’s team and university member lists.
+type htbMember struct {
+	ID     int    `json:"id"`
+	Name   string `json:"name"`
+	Points int    `json:"points"`
+}
+
+var (
+	discoveryMutex sync.RWMutex
+	// discovered holds the member IDs found per source ("team", "university")
+	// and when they were fetched
+	discovered   = map[string][]string{}
+	discoveredAt = map[string]time.Time{}
+)
+
+// loadTeamMembers discovers the members of the HTB team TEAM_ID so each of
+// them is tracked without listing their IDs. It runs at the start of each
+// invocation and asks HTB again once discoveryTTL has passed; a failed
+// request keeps the members found last.
+func loadTeamMembers(ctx context.Context) {
+	teamID := os.Getenv("TEAM_ID")
+	if teamID == "" {
+		setDiscovered("team", nil)
+		return
+	}
+	if discoveryFresh("team") {
+		return
+	}
+	var members []htbMember
+	err := htbGetter(ctx, os.Getenv("USER_ID"))(htbAPI("/api/v4/team/members/"+teamID), &members)
+	if err != nil {
+		slog.ErrorContext(ctx, "fetching team members failed", "team", teamID, "error", err)
+		return
+	}
+	setDiscovered("team", memberIDs(members))
+}
+
+// loadUniversityMembers does the same for the HTB university UNIVERSITY_ID,
+// whose member list can run into the thousands: only members named (by ID
+// or username) in UNIVERSITY_ALLOWLIST are tracked, when it is set, and at
+// most UNIVERSITY_MAX_MEMBERS of them, highest points first.
+func loadUniversityMembers(ctx context.Context) {
+	universityID := os.Getenv("UNIVERSITY_ID")
+	if universityID == "" {
+		setDiscovered("university", nil)
+		return
+	}
+	if discoveryFresh("university") {
+		return
+	}
+	var members []htbMember
+	err := htbGetter(ctx, os.Getenv("USER_ID"))(htbAPI("/api/v4/university/members/"+universityID), &members)
+	if err != nil {
+		slog.ErrorContext(ctx, "fetching university members failed", "university", universityID, "error", err)
+		return
+	}
+
+	if allow := splitList(os.Getenv("UNIVERSITY_ALLOWLIST")); len(allow) > 0 {
+		allowed := map[string]bool{}
+		for _, a := range allow {
+			allowed[strings.ToLower(a)] = true
+		}
+		kept := members[:0]
+		for _, m := range members {
+			if allowed[strconv.Itoa(m.ID)] || allowed[strings.ToLower(m.Name)] {
+				kept = append(kept, m)
+			}
+		}
+		members = kept
+	}
+	sort.SliceStable(members, func(i, j int) bool { return members[i].Points > members[j].Points })
+	limit, err := strconv.Atoi(os.Getenv("UNIVERSITY_MAX_MEMBERS"))
+	if err != nil || limit <= 0 {
+		limit = defaultUniversityMax
+	}
+	if len(members) > limit {
+		slog.WarnContext(ctx, "too many university members, tracking the top ones", "university", universityID, "members", len(members), "limit", limit)
+		members = members[:limit]
+	}
+	setDiscovered("university", memberIDs(members))
+}
+
+func memberIDs(members []htbMember) []string {
+	ids := make([]string, 0, len(members))
+	for _, m := range members {
+		if m.ID > 0 {
+			ids = append(ids, strconv.Itoa(m.ID))
+		}
+	}
+	return ids
+}
+
+func discoveryFresh(source string) bool {
+	discoveryMutex.RLock()
+	defer discoveryMutex.RUnlock()
+	at, ok := discoveredAt[source]
+	return ok && time.Since(at) < discoveryTTL
+}
+
+// setDiscovered replaces the members found through source; nil forgets them.
+func setDiscovered(source string, ids []string) {
+	discoveryMutex.Lock()
+	defer discoveryMutex.Unlock()
+	if ids == nil {
+		delete(discovered, source)
+		delete(discoveredAt, source)
+		return
+	}
+	discovered[source], discoveredAt[source] = ids, time.Now()
+}
+
+// discoveredUsers lists every discovered member, in source order.
+func discoveredUsers() []string {
+	discoveryMutex.RLock()
+	defer discoveryMutex.RUnlock()
+	var ids []string
+	for _, source := range []string{"team", "university"} {
+		ids = append(ids, discovered[source]...)
+	}
+	return ids
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+// sqsRecord is the part of an SQS event record the worker needs.
+type sqsRecord struct {
+	MessageID string `json:"messageId"`
+	Body      string `json:"body"`
+}
+
+// refreshJob is the message body of one per‑user refresh.
+type refreshJob struct {
+	UserID string `json:"user_id"`
+	Date   string `json:"date"`
+	// Attempt counts the delayed retries after upstream failures
+	Attempt int `json:"attempt,omitempty"`
+}
+
+// dispatchRefreshes enqueues one refresh job per configured user on
+// REFRESH_QUEUE_URL, so each worker invocation only fetches a single user.
+// Nothing is queued while the HTB probe fails.
+func dispatchRefreshes(ctx context.Context) (map[string]interface{}, error) {
+	queueURL := os.Getenv("REFRESH_QUEUE_URL")
+	if queueURL == "" {
+		return map[string]interface{}{"error": "REFRESH_QUEUE_URL not configured"}, nil
+	}
+	today := currentDate()
+	client := sqs.NewFromConfig(awsCfg)
+
+	users := configuredUsers()
+	if _, err := htbHealth(ctx); err != nil {
+		// the next scheduled dispatch tries again
+		slog.WarnContext(ctx, "skipping dispatch", "error", err)
+		return map[string]interface{}{"queued": 0, "users": len(users), "skipped": err.Error()}, nil
+	}
+	queued := 0
+	for start := 0; start < len(users); start += 10 {
+		end := start + 10
+		if end > len(users) {
+			end = len(users)
+		}
+		var entries []sqstypes.SendMessageBatchRequestEntry
+		for i, id := range users[start:end] {
+			body, _ := json.Marshal(refreshJob{UserID: id, Date: today})
+			entries = append(entries, sqstypes.SendMessageBatchRequestEntry{
+				Id:          aws.String(strconv.Itoa(start + i)),
+				MessageBody: aws.String(string(body)),
+			})
+		}
+		resp, err := client.SendMessageBatch(ctx, &sqs.SendMessageBatchInput{
+			QueueUrl: aws.String(queueURL),
+			Entries:  entries,
+		})
+		if err != nil {
+			slog.ErrorContext(ctx, "SendMessageBatch failed", "queue", queueURL, "error", err)
+			return map[string]interface{}{"error": "Error queueing refreshes", "detail": err.Error(), "queued": queued}, nil
+		}
+		for _, f := range resp.Failed {
+			slog.ErrorContext(ctx, "queueing refresh failed", "job", aws.ToString(f.Id), "error", aws.ToString(f.Message))
+		}
+		queued += len(resp.Successful)
+	}
+	return map[string]interface{}{"queued": queued, "users": len(users)}, nil
+}
+
+// enqueueRefresh queues a single refresh job for userID on REFRESH_QUEUE_URL.
+func enqueueRefresh(ctx context.Context, userID, date string) error {
+	body, _ := json.Marshal(refreshJob{UserID: userID, Date: date})
+	_, err := sqs.NewFromConfig(awsCfg).SendMessage(ctx, &sqs.SendMessageInput{
+		QueueUrl:    aws.String(os.Getenv("REFRESH_QUEUE_URL")),
+		MessageBody: aws.String(string(body)),
+	})
+	return err
+}
+
+// refreshWorker processes refresh jobs from SQS. Users whose stats for the
+// day are already stored are skipped; failed jobs are reported back as batch item
+// failures so SQS redelivers only those, unless a delayed retry was queued
+// for them instead. While the HTB probe fails, jobs are put off the same way
+// without calling HTB.
+func refreshWorker(ctx context.Context, records []sqsRecord) (map[string]interface{}, error) {
+	tableName := os.Getenv("TABLE_NAME")
+	if tableName == "" {
+		return map[string]interface{}{"error": "TABLE_NAME not configured"}, nil
+	}
+
+	bctx, batch := withNotifyBatch(ctx)
+	defer batch.flush(ctx)
+
+	failures := []map[string]string{}
+	var invalid []map[string]interface{}
+	skipped := 0
+	for _, r := range records {
+		var job refreshJob
+		err := json.Unmarshal([]byte(r.Body), &job)
+		if err == nil {
+			err = validateJob(job)
+		}
+		if err != nil {
+			// redelivering won’t fix it
+			slog.WarnContext(ctx, "dropping malformed refresh job", "message_id", r.MessageID, "error", err, "body", r.Body)
+			var ve *validationError
+			if !errors.As(err, &ve) {
+				ve = &validationError{problems: []fieldProblem{{Field: "body", Problem: err.Error()}}}
+			}
+			invalid = append(invalid, map[string]interface{}{"messageId": r.MessageID, "problems": ve.problems})
+			continue
+		}
+		if job.Date == "" {
+			job.Date = currentDate()
+		}
+		// an item holding only its key is a failed earlier attempt; retry it
+		existing, err := loadItem(ctx, userTable(job.UserID, tableName), itemKey(job.UserID, job.Date))
+		if err == nil && len(existing) > 1 && !refreshDue(existing) {
+			continue
+		}
+		if _, down := htbHealth(ctx); down != nil {
+			// don’t spend the batch on timeouts: retry later instead
+			if !scheduleRetry(withAttempt(ctx, job.Attempt), tableName, job.UserID, job.Date, down) {
+				failures = append(failures, map[string]string{"itemIdentifier": r.MessageID})
+			}
+			skipped++
+			continue
+		}
+		if _, err := refreshUser(withAttempt(bctx, job.Attempt), tableName, job.UserID, job.Date, true); err != nil {
+			slog.ErrorContext(ctx, "refresh failed", "user", job.UserID, "error", err)
+			var re *refreshError
+			if !errors.As(err, &re) || !re.retryQueued {
+				failures = append(failures, map[string]string{"itemIdentifier": r.MessageID})
+			}
+		}
+	}
+	res := map[string]interface{}{"batchItemFailures": failures}
+	if len(invalid) > 0 {
+		res["invalidJobs"] = invalid
+	}
+	if skipped > 0 {
+		res["skippedHTBDown"] = skipped
+	}
+	return res, nil
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// check results, from best to worst
+const (
+	checkOK   = "ok"
+	checkSkip = "skipped"
+	checkWarn = "warning"
+	checkFail = "failed"
+)
+
+// doctorCheck is one line of the validate report.
+type doctorCheck struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// healthChecker is implemented by notifiers that can verify their
+// credentials and endpoint without sending anything.
+type healthChecker interface {
+	Check(ctx context.Context) error
+}
+
+// errNotCheckable is returned by a Check that has no way to verify the
+// notifier’s current configuration, e.g. a Slack incoming webhook.
+var errNotCheckable = errors.New("cannot be checked without sending")
+
+// doctorProbeKey is read, and conditionally written without ever being
+// stored, to test table access.
+const doctorProbeKey = "doctor#probe"
+
+// runDoctor checks the configuration end to end: each tracked user’s token
+// and whether HTB accepts it, every table the function reads and writes, and
+// every enabled notifier. It never stores an item or sends a notification.
+func runDoctor(ctx context.Context) map[string]interface{} {
+	var checks []doctorCheck
+	add := func(name, status, detail string) {
+		checks = append(checks, doctorCheck{Name: name, Status: status, Detail: detail})
+	}
+
+	users := configuredUsers()
+	if len(users) == 0 {
+		add("users", checkFail, "USER_ID not configured")
+	}
+	for _, user := range users {
+		primary, _, err := userTokens(ctx, user)
+		if err != nil {
+			add("token:"+user, checkFail, err.Error())
+			continue
+		}
+		if exp, ok := tokenExpiry(primary); !ok {
+			add("token:"+user, checkOK, "no expiry in token")
+		} else if days := daysUntil(exp); days < 0 {
+			add("token:"+user, checkFail, "expired "+exp.Format(time.RFC3339))
+		} else if days <= tokenWarnDays() {
+			add("token:"+user, checkWarn, fmt.Sprintf("expires in %d days", days))
+		} else {
+			add("token:"+user, checkOK, "expires "+exp.Format(time.RFC3339))
+		}
+
+		var profile map[string]interface{}
+		err = htbGetter(ctx, user)(htbAPI("/api/v4/user/profile/basic/"+user), &profile)
+		switch {
+		case errors.Is(err, errUnauthorized):
+			detail := err.Error()
+			var ae *authError
+			if errors.As(err, &ae) {
+				detail += ": " + ae.guidance()
+			}
+			add("htb:"+user, checkFail, detail)
+		case err != nil:
+			add("htb:"+user, checkFail, "HTB unreachable: "+err.Error())
+		default:
+			add("htb:"+user, checkOK, "")
+		}
+	}
+
+	for _, problem := range configProblems() {
+		add("config", checkFail, problem)
+	}
+
+	if tableName := os.Getenv("TABLE_NAME"); tableName == "" {
+		add("table", checkFail, "TABLE_NAME not configured")
+	} else {
+		for _, table := range dataTables(tableName) {
+			status, detail := checkTable(ctx, table)
+			add("table:"+table, status, detail)
+		}
+	}
+	if usersTable := os.Getenv("USERS_TABLE"); usersTable != "" {
+		_, err := dynamoClient.Scan(ctx, &dynamodb.ScanInput{TableName: aws.String(usersTable), Limit: aws.Int32(1)})
+		if err != nil {
+			add("table:"+usersTable, checkFail, err.Error())
+		} else {
+			add("table:"+usersTable, checkOK, "")
+		}
+	}
+
+	notifiers := configuredNotifiers()
+	if len(notifiers) == 0 {
+		add("notifiers", checkWarn, "no notifier configured")
+	}
+	for _, n := range notifiers {
+		err := errNotCheckable
+		if hc, ok := n.(healthChecker); ok {
+			err = hc.Check(ctx)
+		}
+		switch {
+		case errors.Is(err, errNotCheckable):
+			add("notifier:"+n.Name(), checkSkip, err.Error())
+		case err != nil:
+			add("notifier:"+n.Name(), checkFail, err.Error())
+		default:
+			add("notifier:"+n.Name(), checkOK, "")
+		}
+	}
+
+	ok := true
+	for _, c := range checks {
+		ok = ok && c.Status != checkFail
+	}
+	return map[string]interface{}{"ok": ok, "checks": checks}
+}
+
+// checkTable reads the probe key, which fails if the table is missing or
+// unreadable, then writes it under a condition that can never hold: DynamoDB
+// checks permissions before the condition, so a conditional‑check failure
+// means writes are allowed, and nothing is stored either way.
+func checkTable(ctx context.Context, table string) (status, detail string) {
+	key := map[string]types.AttributeValue{"date": &types.AttributeValueMemberS{Value: envKey(doctorProbeKey)}}
+	_, err := dynamoClient.GetItem(ctx, &dynamodb.GetItemInput{TableName: aws.String(table), Key: key})
+	var missing *types.ResourceNotFoundException
+	if errors.As(err, &missing) {
+		return checkFail, "table does not exist"
+	}
+	if err != nil {
+		return checkFail, "read: " + err.Error()
+	}
+	_, err = dynamoClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:                aws.String(table),
+		Item:                     key,
+		ConditionExpression:      aws.String("attribute_exists(#d) AND attribute_not_exists(#d)"),
+		ExpressionAttributeNames: map[string]string{"#d": "date"},
+	})
+	var condErr *types.ConditionalCheckFailedException
+	if err != nil && !errors.As(err, &condErr) {
+		return checkFail, "write: " + err.Error()
+	}
+	return checkOK, ""
+}
+
+// runDoctorCLI prints the report for `bootstrap validate` and returns the
+// exit status: 1 if any check failed.
+func runDoctorCLI() int {
+	ctx := context.Background()
+	loadUserConfigs(ctx)
+	loadTeamMembers(ctx)
+	loadUniversityMembers(ctx)
+	report := runDoctor(ctx)
+	out, _ := json.MarshalIndent(report, "", "  ")
+	fmt.Println(string(out))
+	if report["ok"] != true {
+		return 1
+	}
+	return 0
+}
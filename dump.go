@@ -0,0 +1,282 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// dumpInlineMax is the largest dump returned in the response body; Function
+// URL responses are capped at 6 MB, so bigger dumps always go through S3.
+const dumpInlineMax = 5 << 20
+
+// dumpLinkTTL is how long the presigned link to a dump stays valid.
+const dumpLinkTTL = time.Hour
+
+// userStateKinds are the per‑user state items exported with the snapshots.
+// The rest of the table — fetch locks, queued‑retry markers,
+// sent‑notification claims, throttle queues, change markers, the circuit
+// breaker, tenant quotas and token status — is this deployment’s
+// bookkeeping and is left out.
+var userStateKinds = []string{"goals", "streak", "identity"}
+
+// dumpKind classifies a table key for the export: "snapshot" for a daily
+// snapshot, "intraday" for an hourly one and "state" for a user’s goals,
+// streak or identity, with the user it belongs to. ok is false for
+// bookkeeping and other environments’ records.
+func dumpKind(key string) (user, kind string, ok bool) {
+	if user, _, ok := splitItemKey(key); ok {
+		return user, "snapshot", true
+	}
+	if i := strings.LastIndex(key, "#"); i >= 0 && len(key)-i == 3 {
+		if _, err := strconv.Atoi(key[i+1:]); err == nil {
+			if user, _, ok := splitItemKey(key[:i]); ok {
+				return user, "intraday", true
+			}
+		}
+	}
+	for _, user := range configuredUsers() {
+		for _, name := range userStateKinds {
+			if key == userStateKey(name, user) {
+				return user, "state", true
+			}
+		}
+	}
+	return "", "", false
+}
+
+// writeDump writes the snapshots and user state of this environment in the
+// table and the users’ own tables, then every archived snapshot, to w as one
+// JSON object per line, returning the number of records. Table records keep
+// their raw key in "key" and say what they are in "kind"; archived ones are
+// marked "archived": true. When only is set, just that user’s records are
+// written.
+func writeDump(ctx context.Context, tableName, only string, w io.Writer) (int, error) {
+	enc := json.NewEncoder(w)
+	records := 0
+	tables := dataTables(tableName)
+	if only != "" {
+		tables = []string{userTable(only, tableName)}
+	}
+	for _, table := range tables {
+		paginator := dynamodb.NewScanPaginator(dynamoClient, &dynamodb.ScanInput{TableName: aws.String(table)})
+		for paginator.HasMorePages() {
+			page, err := paginator.NextPage(ctx)
+			if err != nil {
+				return records, err
+			}
+			for _, raw := range page.Items {
+				var item map[string]interface{}
+				if err := attributevalue.UnmarshalMap(raw, &item); err != nil {
+					continue
+				}
+				key, _ := item["date"].(string)
+				user, kind, ok := dumpKind(key)
+				if !ok || only != "" && user != only {
+					continue
+				}
+				if _, date, ok := splitItemKey(key); ok {
+					item["date"] = date
+				}
+				item["key"], item["user"], item["kind"] = key, user, kind
+				if err := enc.Encode(item); err != nil {
+					return records, err
+				}
+				records++
+			}
+		}
+	}
+
+	if os.Getenv("ARCHIVE_BUCKET") == "" {
+		return records, nil
+	}
+	client := s3.NewFromConfig(awsCfg)
+	users := configuredUsers()
+	if only != "" {
+		users = []string{only}
+	}
+	for _, user := range users {
+		prefix := strings.TrimSuffix(archiveKey(user, ""), ".json.gz")
+		objects := s3.NewListObjectsV2Paginator(client, &s3.ListObjectsV2Input{
+			Bucket: aws.String(os.Getenv("ARCHIVE_BUCKET")),
+			Prefix: aws.String(prefix),
+		})
+		for objects.HasMorePages() {
+			page, err := objects.NextPage(ctx)
+			if err != nil {
+				return records, err
+			}
+			for _, obj := range page.Contents {
+				items, err := readArchive(ctx, client, aws.ToString(obj.Key))
+				if err != nil {
+					return records, err
+				}
+				for _, item := range items {
+					item["user"], item["kind"], item["archived"] = user, "snapshot", true
+					if err := enc.Encode(item); err != nil {
+						return records, err
+					}
+					records++
+				}
+			}
+		}
+	}
+	return records, nil
+}
+
+// dumpUpload streams a dump into an S3 object through a pipe, so only the
+// uploader’s parts are held in memory, however large the dump.
+type dumpUpload struct {
+	pw   *io.PipeWriter
+	done chan error
+}
+
+func startDumpUpload(ctx context.Context, client *s3.Client, bucket, key string) *dumpUpload {
+	pr, pw := io.Pipe()
+	u := &dumpUpload{pw: pw, done: make(chan error, 1)}
+	go func() {
+		_, err := manager.NewUploader(client).Upload(ctx, &s3.PutObjectInput{
+			Bucket:      aws.String(bucket),
+			Key:         aws.String(key),
+			Body:        pr,
+			ContentType: aws.String("application/x-ndjson"),
+		})
+		pr.CloseWithError(err)
+		u.done <- err
+	}()
+	return u
+}
+
+func (u *dumpUpload) Write(p []byte) (int, error) { return u.pw.Write(p) }
+
+// finish ends the upload, aborting it when the dump failed with err, and
+// returns the first error of the two.
+func (u *dumpUpload) finish(err error) error {
+	if err != nil {
+		u.pw.CloseWithError(err)
+		<-u.done
+		return err
+	}
+	u.pw.Close()
+	return <-u.done
+}
+
+// dumpWriter keeps a dump in memory while it fits in the response body, and
+// once it grows past dumpInlineMax starts an upload through open and streams
+// the rest to it. With no upload possible (open returns nil) it fails with
+// errDumpTooLarge instead of growing.
+type dumpWriter struct {
+	buf    bytes.Buffer
+	open   func() *dumpUpload
+	upload *dumpUpload
+	n      int
+}
+
+var errDumpTooLarge = errors.New("dump too large to return inline and EXPORT_BUCKET not configured")
+
+func (w *dumpWriter) Write(p []byte) (int, error) {
+	if w.upload == nil && w.buf.Len()+len(p) > dumpInlineMax {
+		if w.upload = w.open(); w.upload == nil {
+			return 0, errDumpTooLarge
+		}
+		if _, err := w.upload.Write(w.buf.Bytes()); err != nil {
+			return 0, err
+		}
+		w.buf = bytes.Buffer{}
+	}
+	w.n += len(p)
+	if w.upload != nil {
+		return w.upload.Write(p)
+	}
+	return w.buf.Write(p)
+}
+
+// dumpHandler serves /export[?user=ID]: an authenticated NDJSON dump of the
+// stored snapshots and user state, or of one user’s, so it can be taken
+// elsewhere. Small dumps come back in the body; with ?s3=true, or once the
+// dump outgrows dumpInlineMax, it is streamed to EXPORT_BUCKET and a
+// presigned link is returned instead.
+func dumpHandler(ctx context.Context, inv invocation) (map[string]interface{}, error) {
+	if !hookAuthorized(inv) {
+		return httpResponse(http.StatusUnauthorized, map[string]string{"error": "unauthorized"}), nil
+	}
+	tableName := os.Getenv("TABLE_NAME")
+	if tableName == "" {
+		return httpResponse(http.StatusInternalServerError, map[string]string{"error": "TABLE_NAME not configured"}), nil
+	}
+
+	only := inv.QueryParams["user"]
+	if only != "" && !trackedUser(only) {
+		return httpResponse(http.StatusNotFound, map[string]string{"error": "unknown user"}), nil
+	}
+
+	bucket := os.Getenv("EXPORT_BUCKET")
+	prefix := strings.Trim(os.Getenv("EXPORT_PREFIX"), "/")
+	if prefix == "" {
+		prefix = "htb-history"
+	}
+	key := fmt.Sprintf("%s/dumps/%s.ndjson", prefix, time.Now().UTC().Format("20060102T150405Z"))
+	client := s3.NewFromConfig(awsCfg)
+	w := &dumpWriter{open: func() *dumpUpload {
+		if bucket == "" {
+			return nil
+		}
+		return startDumpUpload(ctx, client, bucket, key)
+	}}
+	if inv.QueryParams["s3"] == "true" {
+		if w.upload = w.open(); w.upload == nil {
+			return httpResponse(http.StatusBadRequest, map[string]string{"error": "EXPORT_BUCKET not configured"}), nil
+		}
+	}
+
+	records, err := writeDump(ctx, tableName, only, w)
+	if w.upload != nil {
+		err = w.upload.finish(err)
+	}
+	if errors.Is(err, errDumpTooLarge) {
+		return httpResponse(http.StatusRequestEntityTooLarge, map[string]string{"error": err.Error()}), nil
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "export failed", "region", awsRegion, "table", tableName, "bucket", bucket, "key", key, "error", err)
+		return httpResponse(http.StatusInternalServerError, map[string]string{"error": "Export failed", "detail": err.Error()}), nil
+	}
+	if w.upload == nil {
+		return map[string]interface{}{
+			"statusCode": http.StatusOK,
+			"headers": map[string]string{
+				"Content-Type":        "application/x-ndjson",
+				"Content-Disposition": `attachment; filename="htb-rankings.ndjson"`,
+			},
+			"body": w.buf.String(),
+		}, nil
+	}
+
+	signed, err := s3.NewPresignClient(client).PresignGetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	}, s3.WithPresignExpires(dumpLinkTTL))
+	if err != nil {
+		return httpResponse(http.StatusInternalServerError, map[string]string{"error": "Error presigning export", "detail": err.Error()}), nil
+	}
+	return httpResponse(http.StatusOK, map[string]interface{}{
+		"records":    records,
+		"bytes":      w.n,
+		"url":        signed.URL,
+		"expires_at": time.Now().Add(dumpLinkTTL).UTC().Format(time.RFC3339),
+	}), nil
+}
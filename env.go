@@ -0,0 +1,32 @@
+package main
+
+import (
+	"os"
+	"strings"
+)
+
+// environment is the ENVIRONMENT name (e.g. "dev"), empty in production. A
+// named environment keeps its records under "<env>#" so a test deployment
+// can share the production table without touching its items.
+func environment() string {
+	return os.Getenv("ENVIRONMENT")
+}
+
+// envKey prefixes a table key with the environment, if one is set.
+func envKey(key string) string {
+	if env := environment(); env != "" {
+		return env + "#" + key
+	}
+	return key
+}
+
+// stripEnvKey reverses envKey, reporting false for keys written by another
+// environment. Without ENVIRONMENT every key counts as this environment’s;
+// splitItemKey tells other environments’ snapshots apart by their prefix.
+func stripEnvKey(key string) (string, bool) {
+	env := environment()
+	if env == "" {
+		return key, true
+	}
+	return strings.CutPrefix(key, env+"#")
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/parquet-go/parquet-go"
+)
+
+// exportRow is the Parquet schema of the S3 export, one row per user and day.
+type exportRow struct {
+	Date          string  `parquet:"date"`
+	User          string  `parquet:"user"`
+	Rank          string  `parquet:"rank"`
+	GlobalRank    int64   `parquet:"global_rank"`
+	LocalRank     int64   `parquet:"local_rank"`
+	CountryCode   string  `parquet:"country_code"`
+	Points        int64   `parquet:"points"`
+	Ownership     float64 `parquet:"rank_ownership"`
+	SystemOwns    int64   `parquet:"system_owns"`
+	UserOwns      int64   `parquet:"user_owns"`
+	SystemBloods  int64   `parquet:"system_bloods"`
+	UserBloods    int64   `parquet:"user_bloods"`
+	ChallengeOwns int64   `parquet:"challenge_owns"`
+	SeasonTier    string  `parquet:"season_tier"`
+	SeasonRank    int64   `parquet:"season_rank"`
+	SeasonPoints  int64   `parquet:"season_points"`
+	Synthesized   bool    `parquet:"synthesized"`
+	Anomaly       bool    `parquet:"anomaly"`
+}
+
+func toExportRow(user string, item map[string]interface{}) exportRow {
+	num := func(field string) int64 {
+		f, _ := toFloat(item[field])
+		return int64(f)
+	}
+	str := func(field string) string {
+		if v, ok := item[field].(string); ok {
+			return v
+		}
+		return ""
+	}
+	ownership, _ := toFloat(item["Rank_Ownership"])
+	synthesized, _ := item["Synthesized"].(bool)
+	return exportRow{
+		Date:          str("date"),
+		User:          user,
+		Rank:          str("Rank"),
+		GlobalRank:    num("User_Global_Rank"),
+		LocalRank:     num("Local_Rank"),
+		CountryCode:   str("Country_Code"),
+		Points:        num("Points"),
+		Ownership:     ownership,
+		SystemOwns:    num("System_Owns"),
+		UserOwns:      num("User_Owns"),
+		SystemBloods:  num("System_Bloods"),
+		UserBloods:    num("User_Bloods"),
+		ChallengeOwns: num("Challenge_Owns"),
+		SeasonTier:    str("Season_Tier"),
+		SeasonRank:    num("Season_Rank"),
+		SeasonPoints:  num("Season_Points"),
+		Synthesized:   synthesized,
+		Anomaly:       item["Anomalies"] != nil,
+	}
+}
+
+// exportParquet writes the history of every tracked user to EXPORT_BUCKET as
+// Hive‑partitioned Parquet, one file per user and month:
+//
+//	<EXPORT_PREFIX>/user=<id>/month=YYYY-MM/history.parquet
+//
+// Each run rewrites the months touched by the last {"days": N} days (default
+// 35, i.e. this month and last), so it can be scheduled daily with
+// {"action": "export_parquet"}.
+func exportParquet(ctx context.Context, inv invocation) (map[string]interface{}, error) {
+	tableName := os.Getenv("TABLE_NAME")
+	bucket := os.Getenv("EXPORT_BUCKET")
+	if tableName == "" || bucket == "" {
+		return map[string]interface{}{"error": "TABLE_NAME or EXPORT_BUCKET not configured"}, nil
+	}
+	prefix := strings.Trim(os.Getenv("EXPORT_PREFIX"), "/")
+	if prefix == "" {
+		prefix = "htb-history"
+	}
+	days := inv.Days
+	if days <= 0 {
+		days = 35
+	}
+
+	to := currentDay()
+	// start at the first of the month so every file covers a whole month
+	start := to.AddDate(0, 0, -days)
+	from := time.Date(start.Year(), start.Month(), 1, 0, 0, 0, 0, time.UTC)
+	client := s3.NewFromConfig(awsCfg)
+
+	files := 0
+	for _, user := range configuredUsers() {
+		items, err := loadRange(ctx, tableName, user, from, to)
+		if err != nil {
+			slog.ErrorContext(ctx, "BatchGetItem failed", "region", awsRegion, "table", tableName, "error", err)
+			return map[string]interface{}{"error": "Database lookup failed", "detail": err.Error(), "files": files}, nil
+		}
+		months := map[string][]exportRow{}
+		for _, item := range series(items) {
+			row := toExportRow(user, item)
+			months[row.Date[:7]] = append(months[row.Date[:7]], row)
+		}
+
+		keys := make([]string, 0, len(months))
+		for m := range months {
+			keys = append(keys, m)
+		}
+		sort.Strings(keys)
+		for _, month := range keys {
+			var buf bytes.Buffer
+			if err := parquet.Write(&buf, months[month]); err != nil {
+				return map[string]interface{}{"error": "Error encoding Parquet", "detail": err.Error(), "files": files}, nil
+			}
+			key := fmt.Sprintf("%s/user=%s/month=%s/history.parquet", prefix, user, month)
+			if _, err := client.PutObject(ctx, &s3.PutObjectInput{
+				Bucket: aws.String(bucket),
+				Key:    aws.String(key),
+				Body:   bytes.NewReader(buf.Bytes()),
+			}); err != nil {
+				slog.ErrorContext(ctx, "PutObject failed", "bucket", bucket, "key", key, "error", err)
+				return map[string]interface{}{"error": "Error writing to S3", "detail": err.Error(), "files": files}, nil
+			}
+			files++
+		}
+	}
+	return map[string]interface{}{"files": files}, nil
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// fetchLockTTL bounds how long a claimed fetch holds off others, should its
+// invocation die before releasing it; fetchLockWait is how long another
+// invocation waits for the winner’s item before giving up.
+const (
+	fetchLockTTL  = 2 * time.Minute
+	fetchLockWait = 15 * time.Second
+	fetchLockPoll = 500 * time.Millisecond
+)
+
+// errFetchInProgress fails a refresh that waited for a concurrent one to
+// store the day’s stats in vain.
+var errFetchInProgress = errors.New("another refresh of these stats is in progress")
+
+// fetchLockKey names the lock on userID’s fetch for date.
+func fetchLockKey(userID, date string) string {
+	return envKey("lock#" + userID + "#" + date)
+}
+
+// claimFetch takes the lock on userID’s fetch for date with a conditional
+// write, so that of several invocations refreshing at once — simultaneous
+// cold starts, say — only one calls HTB. A lock left behind expires after
+// fetchLockTTL. It returns whether the lock was won and the func releasing
+// it; when DynamoDB can’t be reached it fails open, as a second fetch beats
+// none.
+func claimFetch(ctx context.Context, tableName, userID, date string) (release func(), won bool) {
+	if tableName == "" {
+		return func() {}, true
+	}
+	owner := make([]byte, 8)
+	_, _ = rand.Read(owner)
+	me := &types.AttributeValueMemberS{Value: hex.EncodeToString(owner)}
+	now := time.Now()
+
+	key := map[string]types.AttributeValue{
+		"date": &types.AttributeValueMemberS{Value: fetchLockKey(userID, date)},
+	}
+	_, err := dynamoClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(tableName),
+		Item: map[string]types.AttributeValue{
+			"date":       key["date"],
+			"owner":      me,
+			"expires_at": &types.AttributeValueMemberN{Value: strconv.FormatInt(now.Add(fetchLockTTL).Unix(), 10)},
+		},
+		ConditionExpression:       aws.String("attribute_not_exists(#k) OR expires_at < :now"),
+		ExpressionAttributeNames:  map[string]string{"#k": "date"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{":now": &types.AttributeValueMemberN{Value: strconv.FormatInt(now.Unix(), 10)}},
+	})
+	var condErr *types.ConditionalCheckFailedException
+	if errors.As(err, &condErr) {
+		return func() {}, false
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "claiming the fetch failed", "user", userID, "error", err)
+		return func() {}, true
+	}
+
+	return func() {
+		// only our own lock: after fetchLockTTL it may be someone else’s
+		_, err := dynamoClient.DeleteItem(context.WithoutCancel(ctx), &dynamodb.DeleteItemInput{
+			TableName:                 aws.String(tableName),
+			Key:                       key,
+			ConditionExpression:       aws.String("#o = :me"),
+			ExpressionAttributeNames:  map[string]string{"#o": "owner"},
+			ExpressionAttributeValues: map[string]types.AttributeValue{":me": me},
+		})
+		if err != nil && !errors.As(err, &condErr) {
+			slog.ErrorContext(ctx, "releasing the fetch failed", "user", userID, "error", err)
+		}
+	}, true
+}
+
+// awaitFetch waits, up to fetchLockWait, for the invocation holding the lock
+// on userID’s fetch for date to release it, then reads the stats it stored.
+// Errors are *refreshError.
+func awaitFetch(ctx context.Context, tableName, userID, date string) (map[string]interface{}, error) {
+	dataTable := userTable(userID, tableName)
+	deadline := time.Now().Add(fetchLockWait)
+	for time.Now().Before(deadline) {
+		select {
+		case <-ctx.Done():
+			return nil, &refreshError{msg: "Refresh in progress", cause: errFetchInProgress}
+		case <-time.After(fetchLockPoll):
+		}
+		lock, err := loadItem(ctx, tableName, fetchLockKey(userID, date))
+		if err != nil {
+			return nil, &refreshError{msg: "Database lookup failed", cause: err}
+		}
+		if until, ok := toFloat(lock["expires_at"]); lock != nil && ok && time.Now().Unix() <= int64(until) {
+			continue
+		}
+		item, err := loadItem(ctx, dataTable, itemKey(userID, date))
+		if err != nil {
+			return nil, &refreshError{msg: "Database lookup failed", cause: err}
+		}
+		if len(item) <= 1 {
+			// the winner’s fetch failed and left its marker
+			return nil, &refreshError{msg: "HTB fetch failed in a concurrent refresh"}
+		}
+		return item, nil
+	}
+	return nil, &refreshError{msg: "Refresh in progress", cause: errFetchInProgress}
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// goalField is the Change.Field used for reached goals.
+const goalField = "Goal"
+
+// goal is a user‑defined target, e.g. {"field": "Rank", "target": "Guru",
+// "by": "2025-07-01"} or {"field": "User_Owns", "target": 300}. Rank titles
+// and season tiers take a title as target, every other stat a number.
+type goal struct {
+	ID      string      `json:"id"`
+	Field   string      `json:"field"`
+	Target  interface{} `json:"target"`
+	By      string      `json:"by,omitempty"`
+	Reached string      `json:"reached,omitempty"`
+}
+
+// goalProgress is a goal as served by /goals.
+type goalProgress struct {
+	goal
+	Current  interface{} `json:"current"`
+	Percent  float64     `json:"percent"`
+	DaysLeft *int        `json:"days_left,omitempty"`
+	Overdue  bool        `json:"overdue,omitempty"`
+}
+
+func goalsKey(userID string) string {
+	return userStateKey("goals", userID)
+}
+
+// loadGoals reads userID’s goals from the "goals#<user>" item.
+func loadGoals(ctx context.Context, tableName, userID string) ([]goal, error) {
+	item, err := loadItem(ctx, userTable(userID, tableName), goalsKey(userID))
+	if err != nil {
+		return nil, err
+	}
+	var goals []goal
+	if raw, ok := item["state"].(string); ok {
+		if err := json.Unmarshal([]byte(raw), &goals); err != nil {
+			return nil, fmt.Errorf("decoding goals: %w", err)
+		}
+	}
+	return goals, nil
+}
+
+func saveGoals(ctx context.Context, tableName, userID string, goals []goal) error {
+	raw, err := json.Marshal(goals)
+	if err != nil {
+		return fmt.Errorf("encoding goals: %w", err)
+	}
+	_, err = dynamoClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(userTable(userID, tableName)),
+		Item: map[string]types.AttributeValue{
+			"date":  &types.AttributeValueMemberS{Value: goalsKey(userID)},
+			"state": &types.AttributeValueMemberS{Value: string(raw)},
+		},
+	})
+	return err
+}
+
+// validate checks the field and target of a goal submitted through /goals.
+func (g goal) validate() error {
+	if g.Field == "Rank" || g.Field == "Season_Tier" {
+		if _, ok := statValue(g.Field, g.Target); !ok {
+			return fmt.Errorf("unknown %s %v", g.Field, g.Target)
+		}
+	} else if _, ok := toFloat(g.Target); !ok {
+		return fmt.Errorf("target of %s must be a number", g.Field)
+	} else if fieldLabel("en", g.Field) == g.Field {
+		return fmt.Errorf("unknown field %q", g.Field)
+	}
+	if g.By != "" {
+		if _, err := time.Parse("2006-01-02", g.By); err != nil {
+			return fmt.Errorf("invalid by %q: want YYYY-MM-DD", g.By)
+		}
+	}
+	return nil
+}
+
+// percent measures how far item is towards the goal, from 0 to 100. Rank
+// titles are measured by ownership against the title’s requirement, other
+// rank‑style stats by how close the current rank is to the target.
+func (g goal) percent(item map[string]interface{}) float64 {
+	target, okT := statValue(g.Field, g.Target)
+	current, okC := statValue(g.Field, item[g.Field])
+	if !okT || !okC {
+		return 0
+	}
+	var p float64
+	switch {
+	case g.Field == "Rank":
+		if current >= target {
+			return 100
+		}
+		ownership, _ := toFloat(item["Rank_Ownership"])
+		if req := rankRequirements[formatValue(g.Target)]; req > 0 {
+			p = ownership / req * 100
+		}
+	case g.Field == "Season_Tier":
+		if current >= target {
+			return 100
+		}
+		p = current / target * 100
+	case lowerIsBetter[g.Field]:
+		if current > 0 && current <= target {
+			return 100
+		}
+		if current > 0 {
+			p = target / current * 100
+		}
+	default:
+		if target <= 0 || current >= target {
+			return 100
+		}
+		p = current / target * 100
+	}
+	return math.Min(math.Round(p*10)/10, 99.9)
+}
+
+// text describes the goal in the notification locale, e.g. "Rank: Guru".
+func (g goal) text() string {
+	s := fieldLabel(notifyLocale(), g.Field) + ": " + formatValue(g.Target)
+	if g.By != "" {
+		s += " (" + g.By + ")"
+	}
+	return s
+}
+
+// progress computes the /goals view of g as of day.
+func (g goal) progress(item map[string]interface{}, day time.Time) goalProgress {
+	p := goalProgress{goal: g, Current: item[g.Field], Percent: g.percent(item)}
+	if g.By != "" && g.Reached == "" {
+		by, _ := time.Parse("2006-01-02", g.By)
+		left := int(by.Sub(day).Hours() / 24)
+		p.DaysLeft = &left
+		p.Overdue = left < 0
+	}
+	return p
+}
+
+// checkGoals marks the goals curr reaches for the first time and returns a
+// goal Change for each, to go into the notification pipeline.
+func checkGoals(ctx context.Context, tableName, userID, date string, curr map[string]interface{}) []Change {
+	goals, err := loadGoals(ctx, tableName, userID)
+	if err != nil {
+		slog.ErrorContext(ctx, "loading goals failed", "user", userID, "error", err)
+		return nil
+	}
+	var changes []Change
+	for i, g := range goals {
+		if g.Reached != "" || g.percent(curr) < 100 {
+			continue
+		}
+		goals[i].Reached = date
+		changes = append(changes, Change{Field: goalField, New: g.Target, Detail: g.text()})
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+	if err := saveGoals(ctx, tableName, userID, goals); err != nil {
+		slog.ErrorContext(ctx, "saving goals failed", "user", userID, "error", err)
+	}
+	return changes
+}
+
+// goalsHandler serves /goals[?user=ID]. GET lists the goals with their
+// progress against the latest snapshot; POST adds the goal in the body and
+// DELETE ?id= removes one, both authenticated like /hooks/refresh.
+func goalsHandler(ctx context.Context, inv invocation) (map[string]interface{}, error) {
+	tableName := os.Getenv("TABLE_NAME")
+	if tableName == "" {
+		return httpResponse(http.StatusInternalServerError, map[string]string{"error": "TABLE_NAME not configured"}), nil
+	}
+	user, ok := requestedUser(inv)
+	if !ok {
+		return httpResponse(http.StatusNotFound, map[string]string{"error": "unknown user"}), nil
+	}
+	method := inv.RequestContext.HTTP.Method
+	if method != "" && method != http.MethodGet && !hookAuthorized(inv) {
+		return httpResponse(http.StatusUnauthorized, map[string]string{"error": "unauthorized"}), nil
+	}
+
+	goals, err := loadGoals(ctx, tableName, user)
+	if err != nil {
+		slog.ErrorContext(ctx, "loading goals failed", "user", user, "error", err)
+		return httpResponse(http.StatusInternalServerError, map[string]string{"error": "Database lookup failed", "detail": err.Error()}), nil
+	}
+
+	switch method {
+	case http.MethodPost:
+		body := []byte(inv.Body)
+		if inv.IsBase64Encoded {
+			if body, err = base64.StdEncoding.DecodeString(inv.Body); err != nil {
+				return httpResponse(http.StatusBadRequest, map[string]string{"error": "invalid body encoding"}), nil
+			}
+		}
+		var g goal
+		if err := json.Unmarshal(body, &g); err != nil {
+			return httpResponse(http.StatusBadRequest, map[string]string{"error": "invalid goal: " + err.Error()}), nil
+		}
+		if err := g.validate(); err != nil {
+			return httpResponse(http.StatusBadRequest, map[string]string{"error": err.Error()}), nil
+		}
+		id := make([]byte, 4)
+		_, _ = rand.Read(id)
+		g.ID, g.Reached = hex.EncodeToString(id), ""
+		goals = append(goals, g)
+	case http.MethodDelete:
+		kept := goals[:0]
+		for _, g := range goals {
+			if g.ID != inv.QueryParams["id"] {
+				kept = append(kept, g)
+			}
+		}
+		if len(kept) == len(goals) {
+			return httpResponse(http.StatusNotFound, map[string]string{"error": "unknown goal"}), nil
+		}
+		goals = kept
+	}
+	if method == http.MethodPost || method == http.MethodDelete {
+		if err := saveGoals(ctx, tableName, user, goals); err != nil {
+			slog.ErrorContext(ctx, "saving goals failed", "user", user, "error", err)
+			return httpResponse(http.StatusInternalServerError, map[string]string{"error": "Database write failed", "detail": err.Error()}), nil
+		}
+	}
+
+	today := currentDay()
+	latest, _, _, err := latestStats(ctx, tableName, user, today)
+	if err != nil {
+		slog.ErrorContext(ctx, "BatchGetItem failed", "region", awsRegion, "table", tableName, "error", err)
+		return httpResponse(http.StatusInternalServerError, map[string]string{"error": "Database lookup failed", "detail": err.Error()}), nil
+	}
+	out := make([]goalProgress, 0, len(goals))
+	for _, g := range goals {
+		out = append(out, g.progress(latest, today))
+	}
+	return httpResponse(http.StatusOK, map[string]interface{}{"user": user, "goals": out}), nil
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// maxHistoryDays bounds a single history query (one BatchGetItem key per day).
+const maxHistoryDays = 366
+
+// dateRange parses ?from= and ?to= (YYYY-MM-DD). to defaults to today and from
+// to defaultDays before it.
+func dateRange(inv invocation, defaultDays int) (from, to time.Time, err error) {
+	to = currentDay()
+	if s := inv.QueryParams["to"]; s != "" {
+		if to, err = time.Parse("2006-01-02", s); err != nil {
+			return from, to, fmt.Errorf("invalid to %q: want YYYY-MM-DD", s)
+		}
+	}
+	from = to.AddDate(0, 0, -defaultDays)
+	if s := inv.QueryParams["from"]; s != "" {
+		if from, err = time.Parse("2006-01-02", s); err != nil {
+			return from, to, fmt.Errorf("invalid from %q: want YYYY-MM-DD", s)
+		}
+	}
+	if from.After(to) {
+		return from, to, fmt.Errorf("from %s is after to %s", from.Format("2006-01-02"), to.Format("2006-01-02"))
+	}
+	if to.Sub(from) > maxHistoryDays*24*time.Hour {
+		return from, to, fmt.Errorf("range is longer than %d days", maxHistoryDays)
+	}
+	return from, to, nil
+}
+
+// requestedUser returns ?user= if it is one of the tracked users the
+// request’s tenant may read, or when it is absent the tenant’s first user or
+// else the primary USER_ID.
+func requestedUser(inv invocation) (string, bool) {
+	user := inv.QueryParams["user"]
+	if user == "" && inv.tenant != nil {
+		return inv.tenant.Users[0], true
+	}
+	if user == "" {
+		return os.Getenv("USER_ID"), true
+	}
+	return user, trackedUser(user) && inv.tenant.allows(user)
+}
+
+// series returns the snapshots holding stats in date order, skipping empty
+// negative‑cache items.
+func series(items map[string]map[string]interface{}) []map[string]interface{} {
+	dates := make([]string, 0, len(items))
+	for d, item := range items {
+		if len(item) > 1 {
+			dates = append(dates, d)
+		}
+	}
+	sort.Strings(dates)
+	out := make([]map[string]interface{}, 0, len(dates))
+	for _, d := range dates {
+		item := items[d]
+		item["date"] = d
+		out = append(out, item)
+	}
+	return out
+}
+
+// downsample keeps the latest snapshot in every step‑day bucket counted from
+// from, so a long range can be charted with fewer points.
+func downsample(points []map[string]interface{}, from time.Time, step int) []map[string]interface{} {
+	if step <= 1 {
+		return points
+	}
+	var out []map[string]interface{}
+	last := -1
+	for _, p := range points {
+		d, err := time.Parse("2006-01-02", p["date"].(string))
+		if err != nil {
+			continue
+		}
+		bucket := int(d.Sub(from).Hours()/24) / step
+		if bucket == last {
+			out[len(out)-1] = p
+			continue
+		}
+		out = append(out, p)
+		last = bucket
+	}
+	return out
+}
+
+// historyHandler serves /history?from=&to=[&step=N][&user=ID]: the stored
+// daily snapshots in the range, optionally downsampled to one per N days.
+func historyHandler(ctx context.Context, inv invocation) (map[string]interface{}, error) {
+	tableName := os.Getenv("TABLE_NAME")
+	if tableName == "" {
+		return httpResponse(http.StatusInternalServerError, map[string]string{"error": "TABLE_NAME not configured"}), nil
+	}
+	from, to, err := dateRange(inv, 30)
+	if err != nil {
+		return httpResponse(http.StatusBadRequest, map[string]string{"error": err.Error()}), nil
+	}
+	step := 1
+	if s := inv.QueryParams["step"]; s != "" {
+		if step, err = strconv.Atoi(s); err != nil || step < 1 {
+			return httpResponse(http.StatusBadRequest, map[string]string{"error": "step must be a positive number of days"}), nil
+		}
+	}
+	user, ok := requestedUser(inv)
+	if !ok {
+		return httpResponse(http.StatusNotFound, map[string]string{"error": "unknown user"}), nil
+	}
+
+	items, err := loadRange(ctx, tableName, user, from, to)
+	if err != nil {
+		slog.ErrorContext(ctx, "BatchGetItem failed", "region", awsRegion, "table", tableName, "error", err)
+		return httpResponse(http.StatusInternalServerError, map[string]string{"error": "Database lookup failed", "detail": err.Error()}), nil
+	}
+	return httpResponse(http.StatusOK, map[string]interface{}{
+		"user":  user,
+		"from":  from.Format("2006-01-02"),
+		"to":    to.Format("2006-01-02"),
+		"step":  step,
+		"items": downsample(series(items), from, step),
+	}), nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// httpResponse builds a Function URL response with an explicit status code
+// and a JSON body.
+func httpResponse(status int, body interface{}) map[string]interface{} {
+	raw, _ := json.Marshal(body)
+	return map[string]interface{}{
+		"statusCode": status,
+		"headers":    map[string]string{"Content-Type": "application/json"},
+		"body":       string(raw),
+	}
+}
+
+// hookAuthorized checks the request’s bearer token, or its ?token= parameter
+// for clients that can only open a URL, against REFRESH_HOOK_SECRET.
+func hookAuthorized(inv invocation) bool {
+	secret := os.Getenv("REFRESH_HOOK_SECRET")
+	if secret == "" {
+		return false
+	}
+	given := inv.QueryParams["token"]
+	if auth := inv.Headers["authorization"]; strings.HasPrefix(auth, "Bearer ") {
+		given = strings.TrimPrefix(auth, "Bearer ")
+	}
+	return subtle.ConstantTimeCompare([]byte(given), []byte(secret)) == 1
+}
+
+// refreshHook serves /hooks/refresh: an authenticated, on‑demand refresh of
+// today’s stats that bypasses every cache. Notifications for whatever changed
+// since the last snapshot are sent unless ?notify=false.
+func refreshHook(ctx context.Context, inv invocation) (map[string]interface{}, error) {
+	if !hookAuthorized(inv) {
+		return httpResponse(http.StatusUnauthorized, map[string]string{"error": "unauthorized"}), nil
+	}
+	tableName := os.Getenv("TABLE_NAME")
+	if tableName == "" {
+		return httpResponse(http.StatusInternalServerError, map[string]string{"error": "TABLE_NAME not configured"}), nil
+	}
+
+	notify := inv.QueryParams["notify"] != "false"
+	today := currentDate()
+	bctx, batch := withNotifyBatch(ctx)
+	info, err := refreshUser(bctx, tableName, os.Getenv("USER_ID"), today, notify)
+	batch.flush(ctx)
+	if err != nil {
+		return refreshFailure(err), nil
+	}
+
+	if info[staleField] == true {
+		return httpResponse(http.StatusServiceUnavailable, info), nil
+	}
+	storeCache(info, today)
+	return httpResponse(http.StatusOK, info), nil
+}
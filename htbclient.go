@@ -0,0 +1,306 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// skippableFetches are the optional HTB calls of a refresh that SKIP_FETCH
+// can turn off; the profile call always runs.
+var skippableFetches = []string{"country", "challenges", "badges"}
+
+// fetchEnabled reports whether the optional call isn’t listed in the
+// comma‑separated SKIP_FETCH.
+func fetchEnabled(call string) bool {
+	for _, skip := range splitList(os.Getenv("SKIP_FETCH")) {
+		if strings.EqualFold(skip, call) {
+			return false
+		}
+	}
+	return true
+}
+
+// defaultUserAgent is sent to HTB unless HTB_USER_AGENT says otherwise.
+const defaultUserAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64)"
+
+var (
+	headersMutex  sync.Mutex
+	headersSource *string
+	extraHeaders  map[string]string
+)
+
+// loadHTBHeaders parses HTB_HEADERS or HTB_HEADERS_FILE, a map of header
+// name to value added to every HTB API request, again whenever either
+// changes.
+func loadHTBHeaders() map[string]string {
+	headersMutex.Lock()
+	defer headersMutex.Unlock()
+	if src := settingSource("HTB_HEADERS"); headersSource == nil || *headersSource != src {
+		headersSource, extraHeaders = &src, nil
+		if err := loadYAMLSetting("HTB_HEADERS", &extraHeaders); err != nil {
+			slog.Error("loading HTB headers failed", "error", err)
+			extraHeaders = nil
+		}
+	}
+	return extraHeaders
+}
+
+// setHTBHeaders adds the configured headers and User-Agent to req. It runs
+// before the app token is set, so Authorization can’t be overridden.
+func setHTBHeaders(req *http.Request) {
+	req.Header.Set("User-Agent", defaultUserAgent)
+	if ua := os.Getenv("HTB_USER_AGENT"); ua != "" {
+		req.Header.Set("User-Agent", ua)
+	}
+	for name, value := range loadHTBHeaders() {
+		req.Header.Set(name, value)
+	}
+}
+
+// htbTimeout bounds each HTB request, from HTTP_TIMEOUT (default 10s).
+func htbTimeout() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("HTTP_TIMEOUT")); err == nil && d > 0 {
+		return d
+	}
+	return 10 * time.Second
+}
+
+// htbRetries is how many extra attempts a failed HTB request gets, from
+// MAX_RETRIES (default 2, at most maxHTBRetries).
+func htbRetries() int {
+	if n, err := strconv.Atoi(os.Getenv("MAX_RETRIES")); err == nil && n >= 0 {
+		return min(n, maxHTBRetries)
+	}
+	return 2
+}
+
+// maxHTBRetries caps MAX_RETRIES, and maxHTBBackoff any single wait, so a
+// misconfiguration can’t keep a refresh retrying for the whole invocation.
+const (
+	maxHTBRetries = 10
+	maxHTBBackoff = 30 * time.Second
+)
+
+// htbBackoff is the wait before the first retry, doubled for each one after,
+// from BACKOFF_BASE (default 1s).
+func htbBackoff() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("BACKOFF_BASE")); err == nil && d >= 0 {
+		return d
+	}
+	return time.Second
+}
+
+// htbWait is the pause before retry n (from 0): BACKOFF_BASE doubled n
+// times, capped at maxHTBBackoff, of which a random half is jitter so
+// several users’ refreshes failing together don’t retry in lockstep.
+func htbWait(n int) time.Duration {
+	d := min(htbBackoff()<<n, maxHTBBackoff)
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + rand.N(d/2+1)
+}
+
+// withHTBRetries runs attempt, retrying transport errors (including
+// timeouts), 429s — no sooner than their Retry-After — 5xx, maintenance pages
+// and Cloudflare challenges with jittered exponential backoff, as long as the invocation has time left for
+// another attempt. A rejected token, other
+// client errors and undecodable responses fail straight away.
+func withHTBRetries(ctx context.Context, attempt func() error) error {
+	retries := htbRetries()
+	for n := 0; ; n++ {
+		err := attempt()
+		var se *statusError
+		var ue *url.Error
+		var rl *rateLimitError
+		var be *blockedError
+		retryable := errors.As(err, &se) && se.code >= 500 || errors.As(err, &rl) || errors.As(err, &be) ||
+			errors.As(err, &ue) && ctx.Err() == nil
+		if err == nil || !retryable || n == retries {
+			return err
+		}
+		wait := htbWait(n)
+		if rl != nil {
+			wait = max(wait, rl.retryAfter)
+		}
+		if be != nil {
+			wait = blockedWait(n, be)
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait+htbTimeout() {
+			return err
+		}
+		slog.WarnContext(ctx, "retrying HTB request", "attempt", n+1, "wait", wait.String(), "error", err)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(wait):
+		}
+	}
+}
+
+// errRateLimited is matched by every error caused by HTB answering 429.
+var errRateLimited = errors.New("rate limited by HTB")
+
+// rateLimitError is a 429 from HTB with the wait its Retry-After asked for,
+// zero when it gave none.
+type rateLimitError struct {
+	retryAfter time.Duration
+}
+
+func (e *rateLimitError) Error() string {
+	if e.retryAfter > 0 {
+		return fmt.Sprintf("%v (429), retry after %s", errRateLimited, e.retryAfter)
+	}
+	return errRateLimited.Error() + " (429)"
+}
+
+func (e *rateLimitError) Is(target error) bool { return target == errRateLimited }
+
+// retryAfter parses a Retry-After header, in seconds or as an HTTP date.
+func retryAfter(header string) time.Duration {
+	if secs, err := strconv.Atoi(header); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if at, err := http.ParseTime(header); err == nil {
+		return max(time.Until(at), 0)
+	}
+	return 0
+}
+
+var (
+	rateMutex   sync.Mutex
+	nextRequest time.Time
+)
+
+// htbRateLimit is how many HTB requests per second this container may start,
+// from HTB_RATE_LIMIT (e.g. 2 or 0.5); 0, the default, doesn’t limit.
+func htbRateLimit() float64 {
+	if f, err := strconv.ParseFloat(os.Getenv("HTB_RATE_LIMIT"), 64); err == nil && f > 0 {
+		return f
+	}
+	return 0
+}
+
+// waitForHTB blocks until the next HTB request may start: requests are
+// spaced by HTB_RATE_LIMIT, and none start before a Retry-After HTB asked for
+// has passed. It gives up, returning the wait it needed, if ctx would expire
+// first. A slot is only reserved once the caller will wait for it, and is
+// given back when ctx is cancelled meanwhile, unless a later caller has
+// already queued behind it, so abandoned calls don’t push others back.
+func waitForHTB(ctx context.Context) error {
+	var interval time.Duration
+	if rate := htbRateLimit(); rate > 0 {
+		interval = time.Duration(float64(time.Second) / rate)
+	}
+	rateMutex.Lock()
+	at := time.Now()
+	if nextRequest.After(at) {
+		at = nextRequest
+	}
+	wait := time.Until(at)
+	if deadline, ok := ctx.Deadline(); ok && wait > 0 && time.Until(deadline) < wait {
+		rateMutex.Unlock()
+		return &rateLimitError{retryAfter: wait}
+	}
+	reserved := at.Add(interval)
+	nextRequest = reserved
+	rateMutex.Unlock()
+
+	if wait <= 0 {
+		return nil
+	}
+	select {
+	case <-ctx.Done():
+		rateMutex.Lock()
+		if nextRequest.Equal(reserved) {
+			nextRequest = at
+		}
+		rateMutex.Unlock()
+		return ctx.Err()
+	case <-time.After(wait):
+		return nil
+	}
+}
+
+// holdHTB keeps every request of this container from starting for d, after
+// HTB asked for it with a Retry-After.
+func holdHTB(d time.Duration) {
+	rateMutex.Lock()
+	if until := time.Now().Add(d); until.After(nextRequest) {
+		nextRequest = until
+	}
+	rateMutex.Unlock()
+}
+
+// errUnavailable is matched by every error caused by HTB answering with a
+// maintenance page or a Cloudflare challenge instead of its API.
+var errUnavailable = errors.New("HTB API unavailable")
+
+// blockedError is a response that isn’t HTB’s API at all: kind is
+// "maintenance" for a maintenance or error page, "challenge" for Cloudflare’s
+// bot check. Both are retried, with a longer backoff than other failures.
+type blockedError struct {
+	kind       string
+	code       int
+	retryAfter time.Duration
+}
+
+func (e *blockedError) Error() string {
+	if e.kind == "challenge" {
+		return fmt.Sprintf("%v: Cloudflare challenge (%d)", errUnavailable, e.code)
+	}
+	return fmt.Sprintf("%v: maintenance page (%d)", errUnavailable, e.code)
+}
+
+func (e *blockedError) Is(target error) bool { return target == errUnavailable }
+
+// blockedResponse classifies resp as a Cloudflare challenge — flagged by
+// cf-mitigated, or an HTML page from Cloudflare’s bot check — or a
+// maintenance page, any other HTML answer. It returns nil for anything that
+// may be HTB’s API, JSON or not. Only HTML bodies are read, and only their
+// start.
+func blockedResponse(resp *http.Response) *blockedError {
+	if strings.EqualFold(resp.Header.Get("Cf-Mitigated"), "challenge") {
+		return &blockedError{kind: "challenge", code: resp.StatusCode}
+	}
+	if !strings.Contains(strings.ToLower(resp.Header.Get("Content-Type")), "text/html") {
+		return nil
+	}
+	head, _ := io.ReadAll(io.LimitReader(resp.Body, 16<<10))
+	page := strings.ToLower(string(head))
+	for _, marker := range []string{"challenge-platform", "cf-chl", "just a moment", "attention required"} {
+		if strings.Contains(page, marker) {
+			return &blockedError{kind: "challenge", code: resp.StatusCode}
+		}
+	}
+	return &blockedError{kind: "maintenance", code: resp.StatusCode, retryAfter: retryAfter(resp.Header.Get("Retry-After"))}
+}
+
+// blockedWait is the pause before retry n after a blocked response: four
+// times the usual backoff, capped at maxHTBBackoff, and no sooner than a
+// maintenance page’s Retry-After. Neither clears within seconds.
+func blockedWait(n int, e *blockedError) time.Duration {
+	return max(min(4*htbWait(n), maxHTBBackoff), e.retryAfter)
+}
+
+// maxHTBResponse caps the body read from any HTB response, so an unexpected
+// or hostile one can’t exhaust a 128 MB Lambda; larger bodies fail to decode.
+const maxHTBResponse = 8 << 20
+
+// streamDecoder is implemented by targets that decode a response as it is
+// read, e.g. to stop as soon as they have what they need, rather than
+// unmarshalling all of it.
+type streamDecoder interface {
+	decodeFrom(r io.Reader) error
+}
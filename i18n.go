@@ -0,0 +1,380 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// defaultLocale is used when LOCALE is unset or names an unknown language.
+const defaultLocale = "en"
+
+// messages holds the translated text for each supported locale. Keys are
+// "label.<Field>" for field names, "noun.<Field>" for milestone units and
+// plain ids for headlines and details. Missing keys fall back to English.
+var messages = map[string]map[string]string{
+	"en": {
+		"label.Rank":             "Rank",
+		"label.User_Global_Rank": "Global rank",
+		"label.Local_Rank":       "Country rank",
+		"label.System_Owns":      "System owns",
+		"label.User_Owns":        "User owns",
+		"label.System_Bloods":    "System bloods",
+		"label.User_Bloods":      "User bloods",
+		"label.Challenge_Owns":   "Challenges solved",
+		"label.Badge":            "New badge",
+		"label.Season_Tier":      "Season tier",
+		"label.Season_Rank":      "Season rank",
+		"label.Season_Points":    "Season points",
+		"label.Fetch_Failed":     "HTB refresh failed",
+		"label.Token_Invalid":    "HTB token rejected",
+		"label.Token_Expiring":   "HTB token expiring",
+		"label.Milestone":        "Milestone",
+		"label.Goal":             "Goal reached",
+		"label.Anomaly":          "Suspicious data",
+		"label.Points":           "Points",
+		"label.Name":             "Display name",
+		"label.Country_Code":     "Country",
+
+		"noun.User_Owns":      "user own",
+		"noun.System_Owns":    "root own",
+		"noun.Challenge_Owns": "challenge solved",
+		"noun.System_Bloods":  "system blood",
+		"noun.User_Bloods":    "user blood",
+
+		"headline.stats":     "📈 Hack The Box stats changed",
+		"headline.blood":     "🩸 Hack The Box first blood!",
+		"headline.token":     "🔑 Hack The Box token stopped working",
+		"headline.expiring":  "⏳ Hack The Box token expires soon",
+		"headline.failure":   "⚠️ Hack The Box refresh failed",
+		"headline.badge":     "🏅 New Hack The Box badge",
+		"headline.milestone": "🎯 Hack The Box milestone reached",
+		"headline.goal":      "🏆 Hack The Box goal reached",
+		"headline.anomaly":   "🚨 Hack The Box data looks wrong",
+
+		"overtaken_by":   "overtaken by %s",
+		"overtaken_in":   "in %s, overtaken by %s",
+		"entered_top":    "entered top %d",
+		"left_top":       "left top %d",
+		"country_moved":  "moved from %s to %s",
+		"token_rejected": "%d consecutive refreshes got 401/403: %s",
+		"auth.expired":   "token expired — regenerate it at HTB → Profile Settings → App Tokens and update TOKEN or its secret",
+		"auth.invalid":   "token invalid or revoked — create a new one at HTB → Profile Settings → App Tokens and update TOKEN or its secret",
+		"auth.forbidden": "token not allowed to read this profile — check it belongs to the tracked account, or create a new one at HTB → Profile Settings → App Tokens",
+		"token_expiring": "the HTB app token expires in %d days (%s) — generate a new one",
+		"anomaly_jump":   "%s jumped from %s to %s (%+d%%)",
+		"anomaly_drop":   "%s fell from %s to %s",
+		"implausible":    "fetch rejected, previous stats kept: %s",
+		"snapshot_for":   "Snapshot for %s",
+
+		"digest.subject": "Your Hack The Box week",
+		"digest.title":   "Hack The Box weekly digest",
+		"digest.stat":    "Stat",
+		"digest.start":   "Start",
+		"digest.end":     "End",
+		"digest.none":    "No movement this week.",
+
+		"review.summary":   "%d on Hack The Box: %d owns, %d bloods, %d challenges solved and %d badges earned.",
+		"review.best_rank": "Best global rank: #%d.",
+		"review.busiest":   "Busiest month: %s (%d owns).",
+
+		"report.title":  "Hack The Box monthly report",
+		"report.days":   "days tracked",
+		"report.none":   "No movement this month.",
+		"report.badges": "Badges earned",
+		"report.ready":  "Your Hack The Box report for %s is ready:",
+	},
+	"de": {
+		"label.Rank":             "Rang",
+		"label.User_Global_Rank": "Globaler Rang",
+		"label.Local_Rank":       "Landesrang",
+		"label.System_Owns":      "System-Owns",
+		"label.User_Owns":        "User-Owns",
+		"label.System_Bloods":    "System-Bloods",
+		"label.User_Bloods":      "User-Bloods",
+		"label.Challenge_Owns":   "Gelöste Challenges",
+		"label.Badge":            "Neues Abzeichen",
+		"label.Season_Tier":      "Saison-Stufe",
+		"label.Season_Rank":      "Saison-Rang",
+		"label.Season_Points":    "Saisonpunkte",
+		"label.Fetch_Failed":     "HTB-Aktualisierung fehlgeschlagen",
+		"label.Token_Invalid":    "HTB-Token abgelehnt",
+		"label.Token_Expiring":   "HTB-Token läuft ab",
+		"label.Milestone":        "Meilenstein",
+		"label.Goal":             "Ziel erreicht",
+		"label.Anomaly":          "Verdächtige Daten",
+		"label.Points":           "Punkte",
+		"label.Name":             "Anzeigename",
+		"label.Country_Code":     "Land",
+
+		"noun.User_Owns":      "User-Own",
+		"noun.System_Owns":    "Root-Own",
+		"noun.Challenge_Owns": "gelöste Challenge",
+		"noun.System_Bloods":  "System-Blood",
+		"noun.User_Bloods":    "User-Blood",
+
+		"headline.stats":     "📈 Hack The Box Statistiken geändert",
+		"headline.blood":     "🩸 Hack The Box First Blood!",
+		"headline.token":     "🔑 Hack The Box Token funktioniert nicht mehr",
+		"headline.expiring":  "⏳ Hack The Box Token läuft bald ab",
+		"headline.failure":   "⚠️ Hack The Box Aktualisierung fehlgeschlagen",
+		"headline.badge":     "🏅 Neues Hack The Box Abzeichen",
+		"headline.milestone": "🎯 Hack The Box Meilenstein erreicht",
+		"headline.goal":      "🏆 Hack The Box Ziel erreicht",
+		"headline.anomaly":   "🚨 Hack The Box Daten sehen falsch aus",
+
+		"overtaken_by":   "überholt von %s",
+		"overtaken_in":   "in %s überholt von %s",
+		"entered_top":    "in die Top %d aufgestiegen",
+		"left_top":       "aus den Top %d gefallen",
+		"country_moved":  "von %s nach %s umgezogen",
+		"token_rejected": "%d Aktualisierungen in Folge mit 401/403: %s",
+		"auth.expired":   "Token abgelaufen — unter HTB → Profile Settings → App Tokens neu erzeugen und TOKEN oder das Secret aktualisieren",
+		"auth.invalid":   "Token ungültig oder widerrufen — unter HTB → Profile Settings → App Tokens einen neuen erzeugen und TOKEN oder das Secret aktualisieren",
+		"auth.forbidden": "Token darf dieses Profil nicht lesen — prüfen, ob er zum verfolgten Konto gehört, oder unter HTB → Profile Settings → App Tokens einen neuen erzeugen",
+		"token_expiring": "der HTB-App-Token läuft in %d Tagen ab (%s) — neuen Token erzeugen",
+		"anomaly_jump":   "%s sprang von %s auf %s (%+d %%)",
+		"anomaly_drop":   "%s fiel von %s auf %s",
+		"implausible":    "Abruf verworfen, bisherige Werte behalten: %s",
+		"snapshot_for":   "Stand vom %s",
+
+		"digest.subject": "Deine Hack The Box Woche",
+		"digest.title":   "Hack The Box Wochenrückblick",
+		"digest.stat":    "Wert",
+		"digest.start":   "Anfang",
+		"digest.end":     "Ende",
+		"digest.none":    "Keine Veränderung diese Woche.",
+
+		"review.summary":   "%d auf Hack The Box: %d Owns, %d Bloods, %d gelöste Challenges und %d neue Abzeichen.",
+		"review.best_rank": "Bester globaler Rang: #%d.",
+		"review.busiest":   "Aktivster Monat: %s (%d Owns).",
+
+		"report.title":  "Hack The Box Monatsbericht",
+		"report.days":   "erfasste Tage",
+		"report.none":   "Keine Veränderung diesen Monat.",
+		"report.badges": "Neue Abzeichen",
+		"report.ready":  "Dein Hack The Box Bericht für %s ist fertig:",
+	},
+	"fr": {
+		"label.Rank":             "Rang",
+		"label.User_Global_Rank": "Classement mondial",
+		"label.Local_Rank":       "Classement national",
+		"label.System_Owns":      "Owns système",
+		"label.User_Owns":        "Owns utilisateur",
+		"label.System_Bloods":    "Bloods système",
+		"label.User_Bloods":      "Bloods utilisateur",
+		"label.Challenge_Owns":   "Challenges résolus",
+		"label.Badge":            "Nouveau badge",
+		"label.Season_Tier":      "Palier de saison",
+		"label.Season_Rank":      "Classement de saison",
+		"label.Season_Points":    "Points de saison",
+		"label.Fetch_Failed":     "Échec de l’actualisation HTB",
+		"label.Token_Invalid":    "Jeton HTB refusé",
+		"label.Token_Expiring":   "Jeton HTB bientôt expiré",
+		"label.Milestone":        "Palier",
+		"label.Goal":             "Objectif atteint",
+		"label.Anomaly":          "Données suspectes",
+		"label.Points":           "Points",
+		"label.Name":             "Nom affiché",
+		"label.Country_Code":     "Pays",
+
+		"noun.User_Owns":      "own utilisateur",
+		"noun.System_Owns":    "own root",
+		"noun.Challenge_Owns": "challenge résolu",
+		"noun.System_Bloods":  "blood système",
+		"noun.User_Bloods":    "blood utilisateur",
+
+		"headline.stats":     "📈 Statistiques Hack The Box modifiées",
+		"headline.blood":     "🩸 First blood sur Hack The Box !",
+		"headline.token":     "🔑 Le jeton Hack The Box ne fonctionne plus",
+		"headline.expiring":  "⏳ Le jeton Hack The Box expire bientôt",
+		"headline.failure":   "⚠️ Échec de l’actualisation Hack The Box",
+		"headline.badge":     "🏅 Nouveau badge Hack The Box",
+		"headline.milestone": "🎯 Palier Hack The Box atteint",
+		"headline.goal":      "🏆 Objectif Hack The Box atteint",
+		"headline.anomaly":   "🚨 Les données Hack The Box semblent erronées",
+
+		"overtaken_by":   "dépassé par %s",
+		"overtaken_in":   "en %s, dépassé par %s",
+		"entered_top":    "entré dans le top %d",
+		"left_top":       "sorti du top %d",
+		"country_moved":  "passé de %s à %s",
+		"token_rejected": "%d actualisations consécutives en 401/403 : %s",
+		"auth.expired":   "jeton expiré — régénérez-le dans HTB → Profile Settings → App Tokens et mettez à jour TOKEN ou son secret",
+		"auth.invalid":   "jeton invalide ou révoqué — créez-en un nouveau dans HTB → Profile Settings → App Tokens et mettez à jour TOKEN ou son secret",
+		"auth.forbidden": "jeton non autorisé à lire ce profil — vérifiez qu’il appartient au compte suivi, ou créez-en un nouveau dans HTB → Profile Settings → App Tokens",
+		"token_expiring": "le jeton d’application HTB expire dans %d jours (%s) — générez-en un nouveau",
+		"anomaly_jump":   "%s est passé de %s à %s (%+d %%)",
+		"anomaly_drop":   "%s a baissé de %s à %s",
+		"implausible":    "données rejetées, statistiques précédentes conservées : %s",
+		"snapshot_for":   "Relevé du %s",
+
+		"digest.subject": "Votre semaine sur Hack The Box",
+		"digest.title":   "Résumé hebdomadaire Hack The Box",
+		"digest.stat":    "Statistique",
+		"digest.start":   "Début",
+		"digest.end":     "Fin",
+		"digest.none":    "Aucun changement cette semaine.",
+
+		"review.summary":   "%d sur Hack The Box : %d owns, %d bloods, %d challenges résolus et %d badges obtenus.",
+		"review.best_rank": "Meilleur classement mondial : #%d.",
+		"review.busiest":   "Mois le plus actif : %s (%d owns).",
+
+		"report.title":  "Rapport mensuel Hack The Box",
+		"report.days":   "jours suivis",
+		"report.none":   "Aucun changement ce mois-ci.",
+		"report.badges": "Badges obtenus",
+		"report.ready":  "Votre rapport Hack The Box pour %s est prêt :",
+	},
+	"es": {
+		"label.Rank":             "Rango",
+		"label.User_Global_Rank": "Ranking global",
+		"label.Local_Rank":       "Ranking nacional",
+		"label.System_Owns":      "Owns de sistema",
+		"label.User_Owns":        "Owns de usuario",
+		"label.System_Bloods":    "Bloods de sistema",
+		"label.User_Bloods":      "Bloods de usuario",
+		"label.Challenge_Owns":   "Retos resueltos",
+		"label.Badge":            "Nueva insignia",
+		"label.Season_Tier":      "Nivel de temporada",
+		"label.Season_Rank":      "Ranking de temporada",
+		"label.Season_Points":    "Puntos de temporada",
+		"label.Fetch_Failed":     "Falló la actualización de HTB",
+		"label.Token_Invalid":    "Token de HTB rechazado",
+		"label.Token_Expiring":   "Token de HTB a punto de caducar",
+		"label.Milestone":        "Hito",
+		"label.Goal":             "Objetivo alcanzado",
+		"label.Anomaly":          "Datos sospechosos",
+		"label.Points":           "Puntos",
+		"label.Name":             "Nombre visible",
+		"label.Country_Code":     "País",
+
+		"noun.User_Owns":      "own de usuario",
+		"noun.System_Owns":    "own de root",
+		"noun.Challenge_Owns": "reto resuelto",
+		"noun.System_Bloods":  "blood de sistema",
+		"noun.User_Bloods":    "blood de usuario",
+
+		"headline.stats":     "📈 Cambios en las estadísticas de Hack The Box",
+		"headline.blood":     "🩸 ¡First blood en Hack The Box!",
+		"headline.token":     "🔑 El token de Hack The Box ha dejado de funcionar",
+		"headline.expiring":  "⏳ El token de Hack The Box caduca pronto",
+		"headline.failure":   "⚠️ Falló la actualización de Hack The Box",
+		"headline.badge":     "🏅 Nueva insignia de Hack The Box",
+		"headline.milestone": "🎯 Hito de Hack The Box alcanzado",
+		"headline.goal":      "🏆 Objetivo de Hack The Box alcanzado",
+		"headline.anomaly":   "🚨 Los datos de Hack The Box parecen erróneos",
+
+		"overtaken_by":   "superado por %s",
+		"overtaken_in":   "en %s, superado por %s",
+		"entered_top":    "entró en el top %d",
+		"left_top":       "salió del top %d",
+		"country_moved":  "cambió de %s a %s",
+		"token_rejected": "%d actualizaciones seguidas con 401/403: %s",
+		"auth.expired":   "token caducado — regénéralo en HTB → Profile Settings → App Tokens y actualiza TOKEN o su secreto",
+		"auth.invalid":   "token no válido o revocado — crea uno nuevo en HTB → Profile Settings → App Tokens y actualiza TOKEN o su secreto",
+		"auth.forbidden": "el token no puede leer este perfil — comprueba que pertenece a la cuenta seguida o crea uno nuevo en HTB → Profile Settings → App Tokens",
+		"token_expiring": "el token de la app de HTB caduca en %d días (%s) — genera uno nuevo",
+		"anomaly_jump":   "%s saltó de %s a %s (%+d %%)",
+		"anomaly_drop":   "%s bajó de %s a %s",
+		"implausible":    "datos rechazados, se mantienen las estadísticas anteriores: %s",
+		"snapshot_for":   "Datos del %s",
+
+		"digest.subject": "Tu semana en Hack The Box",
+		"digest.title":   "Resumen semanal de Hack The Box",
+		"digest.stat":    "Estadística",
+		"digest.start":   "Inicio",
+		"digest.end":     "Fin",
+		"digest.none":    "Sin cambios esta semana.",
+
+		"review.summary":   "%d en Hack The Box: %d owns, %d bloods, %d retos resueltos y %d insignias conseguidas.",
+		"review.best_rank": "Mejor ranking global: #%d.",
+		"review.busiest":   "Mes más activo: %s (%d owns).",
+
+		"report.title":  "Informe mensual de Hack The Box",
+		"report.days":   "días registrados",
+		"report.none":   "Sin cambios este mes.",
+		"report.badges": "Insignias conseguidas",
+		"report.ready":  "Tu informe de Hack The Box de %s está listo:",
+	},
+}
+
+// normalizeLocale reduces a tag such as "de-DE" or "fr_CA" to a supported
+// language, or returns "" when there is no bundle for it.
+func normalizeLocale(tag string) string {
+	lang := strings.ToLower(strings.TrimSpace(tag))
+	if i := strings.IndexAny(lang, "-_"); i >= 0 {
+		lang = lang[:i]
+	}
+	if _, ok := messages[lang]; ok {
+		return lang
+	}
+	return ""
+}
+
+// notifyLocale is the language notifications are written in, from LOCALE.
+func notifyLocale() string {
+	if l := normalizeLocale(os.Getenv("LOCALE")); l != "" {
+		return l
+	}
+	return defaultLocale
+}
+
+// translate looks up key in locale, falling back to English and then to the
+// key itself, and formats it with args when given.
+func translate(locale, key string, args ...interface{}) string {
+	msg, ok := messages[locale][key]
+	if !ok {
+		if msg, ok = messages[defaultLocale][key]; !ok {
+			msg = key
+		}
+	}
+	if len(args) > 0 {
+		return fmt.Sprintf(msg, args...)
+	}
+	return msg
+}
+
+// tr translates key into the notification locale.
+func tr(key string, args ...interface{}) string {
+	return translate(notifyLocale(), key, args...)
+}
+
+// fieldLabel returns the human‑readable name of field in locale, or the raw
+// field name when it has none.
+func fieldLabel(locale, field string) string {
+	if l := translate(locale, "label."+field); l != "label."+field {
+		return l
+	}
+	return field
+}
+
+// responseLabels maps every labelled field to its name in locale, so clients
+// can render a stats response in the visitor’s language.
+func responseLabels(locale string) map[string]interface{} {
+	labels := map[string]interface{}{}
+	for key := range messages[defaultLocale] {
+		if field, ok := strings.CutPrefix(key, "label."); ok {
+			labels[field] = fieldLabel(locale, field)
+		}
+	}
+	return labels
+}
+
+// withLabels adds a "Labels" map to a stats response when the request asks for
+// a language with ?lang=. The response is copied so the cache stays untouched.
+func withLabels(res map[string]interface{}, lang string) map[string]interface{} {
+	locale := normalizeLocale(lang)
+	if lang == "" || res == nil || res["error"] != nil {
+		return res
+	}
+	if locale == "" {
+		locale = defaultLocale
+	}
+	out := make(map[string]interface{}, len(res)+1)
+	for k, v := range res {
+		out[k] = v
+	}
+	out["Labels"] = responseLabels(locale)
+	return out
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// previousNameField and previousCountryField note on a snapshot the display
+// name and country the user had before it, on the day HTB reports a change.
+const (
+	previousNameField    = "Previous_Name"
+	previousCountryField = "Previous_Country_Code"
+)
+
+func identityKey(userID string) string {
+	return userStateKey("identity", userID)
+}
+
+// identity is the "identity#<user>" item: the name and country userID was
+// last fetched with and the date they were first seen with them.
+type identity struct {
+	Key             string `dynamodbav:"date"`
+	Name            string `dynamodbav:"Name"`
+	CountryCode     string `dynamodbav:"Country_Code"`
+	Since           string `dynamodbav:"Since"`
+	PreviousName    string `dynamodbav:"Previous_Name,omitempty"`
+	PreviousCountry string `dynamodbav:"Previous_Country_Code,omitempty"`
+}
+
+// reconcileIdentity compares the name and country in info, fetched for date,
+// with the ones stored for userID. A change is recorded, on the stored
+// identity and as Previous_Name or Previous_Country_Code on info, so the
+// history shows one user who was renamed or moved rather than two. Later
+// refreshes of that day carry the note over; snapshots without a fresh
+// profile and refreshes of days before the last change leave it alone.
+func reconcileIdentity(ctx context.Context, tableName, userID, date string, info map[string]interface{}) {
+	name, _ := info["Name"].(string)
+	code, _ := info["Country_Code"].(string)
+	if tableName == "" || !fetchOK(info, "profile") || name == "" || code == "" {
+		return
+	}
+	dataTable := userTable(userID, tableName)
+	resp, err := dynamoClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(dataTable),
+		Key:       map[string]types.AttributeValue{"date": &types.AttributeValueMemberS{Value: identityKey(userID)}},
+	})
+	var last identity
+	if err == nil && resp.Item != nil {
+		err = attributevalue.UnmarshalMap(resp.Item, &last)
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "reading the identity failed", "user", userID, "error", err)
+		return
+	}
+	if last.Since > date {
+		return
+	}
+
+	next := identity{Key: identityKey(userID), Name: name, CountryCode: code, Since: date}
+	switch {
+	case last.Name == name && last.CountryCode == code:
+		if last.Since != date {
+			return
+		}
+		next = last
+	case last.Name == "":
+		// first sighting: nothing to compare with
+	default:
+		if last.Since == date {
+			// changed again the same day: compare with the day before
+			next.PreviousName, next.PreviousCountry = last.PreviousName, last.PreviousCountry
+		}
+		if next.PreviousName == "" && last.Name != name {
+			next.PreviousName = last.Name
+		}
+		if next.PreviousCountry == "" && last.CountryCode != code {
+			next.PreviousCountry = last.CountryCode
+		}
+		slog.InfoContext(ctx, "identity changed", "user", userID, "name", name, "country", code, "previous_name", last.Name, "previous_country", last.CountryCode)
+	}
+	if next.PreviousName != "" && next.PreviousName != name {
+		info[previousNameField] = next.PreviousName
+	}
+	if next.PreviousCountry != "" && next.PreviousCountry != code {
+		info[previousCountryField] = next.PreviousCountry
+	}
+	if next == last {
+		return
+	}
+	av, err := attributevalue.MarshalMap(next)
+	if err == nil {
+		_, err = dynamoClient.PutItem(ctx, &dynamodb.PutItemInput{
+			TableName: aws.String(dataTable),
+			Item:      av,
+		})
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "storing the identity failed", "user", userID, "error", err)
+	}
+}
+
+// countryMoved reports whether prev and curr were fetched under different
+// countries, so their Local_Rank, Local_Above and country totals belong to
+// different leaderboards and don’t compare.
+func countryMoved(prev, curr map[string]interface{}) bool {
+	oldCode, _ := prev["Country_Code"].(string)
+	newCode, _ := curr["Country_Code"].(string)
+	return oldCode != "" && newCode != "" && oldCode != newCode
+}
+
+// detectIdentityChanges reports a new display name or country between two
+// snapshots.
+func detectIdentityChanges(prev, curr map[string]interface{}) []Change {
+	var changes []Change
+	for _, field := range []string{"Name", "Country_Code"} {
+		oldV, _ := prev[field].(string)
+		newV, _ := curr[field].(string)
+		if oldV != "" && newV != "" && oldV != newV {
+			changes = append(changes, Change{Field: field, Old: oldV, New: newV})
+		}
+	}
+	return changes
+}
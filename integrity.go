@@ -0,0 +1,74 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// hashField holds a snapshot’s content hash, written with it and checked on
+// every read; integrityField flags a snapshot whose content no longer
+// matches, after corruption or an edit made to the table by hand.
+const (
+	hashField      = "Content_Hash"
+	integrityField = "Integrity_Failed"
+)
+
+// unhashedFields are left out of the hash: the key, which archives and
+// dumps rewrite, and the bookkeeping updated in place after the write.
+var unhashedFields = map[string]bool{
+	"date":         true,
+	"expires_at":   true,
+	hashField:      true,
+	integrityField: true,
+	intradayField:  true,
+	failedField:    true,
+}
+
+// contentHash is the hex SHA‑256 of item’s JSON, without unhashedFields.
+// item must be in the form read back from DynamoDB (numbers as float64), so
+// a hash taken on write matches one taken on read.
+func contentHash(item map[string]interface{}) string {
+	content := make(map[string]interface{}, len(item))
+	for k, v := range item {
+		if !unhashedFields[k] {
+			content[k] = v
+		}
+	}
+	raw, _ := json.Marshal(content) // keys are sorted, so this is canonical
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// withContentHash adds the hash of av, a snapshot about to be written.
+func withContentHash(av map[string]types.AttributeValue) map[string]types.AttributeValue {
+	var item map[string]interface{}
+	if err := attributevalue.UnmarshalMap(av, &item); err != nil {
+		slog.Error("hashing snapshot failed", "key", av["date"], "error", err)
+		return av
+	}
+	av[hashField] = &types.AttributeValueMemberS{Value: contentHash(item)}
+	return av
+}
+
+// verifyContent checks a stored snapshot against its hash, which it drops
+// from the item. On a mismatch the item is marked "Integrity_Failed": true,
+// so responses and history show it can’t be trusted, logged and counted in
+// the IntegrityFailures metric. Items written before hashes pass as they are.
+func verifyContent(item map[string]interface{}) map[string]interface{} {
+	want, ok := item[hashField].(string)
+	if !ok {
+		return item
+	}
+	delete(item, hashField)
+	if contentHash(item) != want {
+		slog.Error("stored item doesn’t match its content hash", "key", item["date"])
+		emitMetric("IntegrityFailures", 1, nil)
+		item[integrityField] = true
+	}
+	return item
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+// intradayField records on a snapshot which slot of the day it was taken in.
+const intradayField = "Snapshot_Hour"
+
+// refreshInterval is REFRESH_INTERVAL, a whole number of hours below a day
+// (e.g. "1h", "6h"). Zero, the default, keeps one snapshot per day.
+func refreshInterval() time.Duration {
+	s := os.Getenv("REFRESH_INTERVAL")
+	if s == "" {
+		return 0
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < time.Hour || d >= 24*time.Hour || d%time.Hour != 0 {
+		slog.Warn("invalid REFRESH_INTERVAL: want whole hours between 1h and 23h", "value", s)
+		return 0
+	}
+	return d
+}
+
+// intradayRetention is how long intraday snapshots are kept before DynamoDB
+// TTL removes them, from INTRADAY_RETENTION_DAYS (default 30).
+func intradayRetention() time.Duration {
+	days, _ := strconv.Atoi(os.Getenv("INTRADAY_RETENTION_DAYS"))
+	if days <= 0 {
+		days = 30
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// currentSlot is the first hour of the refresh interval we are in, in
+// dateLocation, or -1 without REFRESH_INTERVAL.
+func currentSlot() int {
+	interval := int(refreshInterval() / time.Hour)
+	if interval == 0 {
+		return -1
+	}
+	hour := time.Now().In(dateLocation()).Hour()
+	return hour - hour%interval
+}
+
+// intradayKey is the key of userID’s snapshot taken in the slot starting at
+// hour on date: the daily key with "#HH" appended. splitItemKey doesn’t read
+// it as a daily snapshot, so history, archival and the roll‑up ignore it.
+func intradayKey(userID, date string, hour int) string {
+	return fmt.Sprintf("%s#%02d", itemKey(userID, date), hour)
+}
+
+// intradayDue reports whether today’s stored item is from an earlier slot
+// and should be refreshed. Items without stats (failed fetches) aren’t due,
+// as before, so a failing HTB isn’t retried on every request.
+func intradayDue(item map[string]interface{}) bool {
+	slot := currentSlot()
+	if slot < 0 || len(item) <= 1 {
+		return false
+	}
+	hour, ok := toFloat(item[intradayField])
+	return !ok || int(hour) != slot
+}
+
+// storeIntraday writes a copy of the daily item as the snapshot of the
+// current slot, expiring after intradayRetention. The daily item itself stays
+// the roll‑up: the latest snapshot of the day.
+func storeIntraday(ctx context.Context, tableName, userID, date string, item map[string]interface{}) {
+	hour, ok := toFloat(item[intradayField])
+	if !ok {
+		return
+	}
+	key := intradayKey(userID, date, int(hour))
+	snapshot := map[string]interface{}{
+		"date":       key,
+		"expires_at": time.Now().Add(intradayRetention()).Unix(),
+	}
+	for k, v := range item {
+		if k != "date" {
+			snapshot[k] = v
+		}
+	}
+	av, err := attributevalue.MarshalMap(snapshot)
+	if err == nil {
+		_, err = dynamoClient.PutItem(ctx, &dynamodb.PutItemInput{
+			TableName: aws.String(tableName),
+			Item:      av,
+		})
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "PutItem failed", "region", awsRegion, "table", tableName, "key", key, "error", err)
+	}
+}
+
+// intradayHandler serves /history/intraday?date=YYYY-MM-DD[&user=ID]: the
+// snapshots taken through the day (today by default), in order, plus the
+// daily roll‑up.
+func intradayHandler(ctx context.Context, inv invocation) (map[string]interface{}, error) {
+	tableName := os.Getenv("TABLE_NAME")
+	if tableName == "" {
+		return httpResponse(http.StatusInternalServerError, map[string]string{"error": "TABLE_NAME not configured"}), nil
+	}
+	date := inv.QueryParams["date"]
+	if date == "" {
+		date = currentDate()
+	} else if _, err := time.Parse("2006-01-02", date); err != nil {
+		return httpResponse(http.StatusBadRequest, map[string]string{"error": "invalid date: want YYYY-MM-DD"}), nil
+	}
+	user, ok := requestedUser(inv)
+	if !ok {
+		return httpResponse(http.StatusNotFound, map[string]string{"error": "unknown user"}), nil
+	}
+
+	table := userTable(user, tableName)
+	points := []map[string]interface{}{}
+	for hour := 0; hour < 24; hour++ {
+		item, err := loadItem(ctx, table, intradayKey(user, date, hour))
+		if err != nil {
+			slog.ErrorContext(ctx, "GetItem failed", "region", awsRegion, "table", table, "error", err)
+			return httpResponse(http.StatusInternalServerError, map[string]string{"error": "Database lookup failed", "detail": err.Error()}), nil
+		}
+		if len(item) > 1 {
+			delete(item, "expires_at")
+			item["date"] = date
+			points = append(points, item)
+		}
+	}
+	daily, err := loadItem(ctx, table, itemKey(user, date))
+	if err != nil {
+		slog.ErrorContext(ctx, "GetItem failed", "region", awsRegion, "table", table, "error", err)
+		return httpResponse(http.StatusInternalServerError, map[string]string{"error": "Database lookup failed", "detail": err.Error()}), nil
+	}
+	if daily != nil {
+		daily["date"] = date
+	}
+	return httpResponse(http.StatusOK, map[string]interface{}{
+		"user":      user,
+		"date":      date,
+		"snapshots": points,
+		"daily":     daily,
+	}), nil
+}
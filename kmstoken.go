@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+)
+
+// tokenContext binds an encrypted token to its user: KMS refuses to decrypt
+// a ciphertext copied onto another user’s item.
+func tokenContext(userID string) map[string]string {
+	return map[string]string{"user_id": userID}
+}
+
+// decryptUserToken decrypts userID’s encrypted_token with KMS. It runs once
+// per fetch, on the fetch’s first HTB request, rather than caching the
+// plaintext across refreshes, so the token only exists in memory while a
+// fetch needs it; errors never include it.
+func decryptUserToken(ctx context.Context, userID, encrypted string) (string, error) {
+	blob, err := base64.StdEncoding.DecodeString(encrypted)
+	if err != nil {
+		return "", fmt.Errorf("user %s: encrypted_token is not base64", userID)
+	}
+	resp, err := kms.NewFromConfig(awsCfg).Decrypt(ctx, &kms.DecryptInput{
+		CiphertextBlob:    blob,
+		EncryptionContext: tokenContext(userID),
+	})
+	if err != nil {
+		return "", fmt.Errorf("decrypting token of user %s: %w", userID, err)
+	}
+	token := strings.TrimSpace(string(resp.Plaintext))
+	if token == "" {
+		return "", fmt.Errorf("encrypted token of user %s is empty", userID)
+	}
+	return token, nil
+}
+
+// runSetTokenCLI serves `bootstrap set-token <user_id>`: it reads the user’s
+// HTB token from standard input, encrypts it with TOKEN_KMS_KEY_ID and
+// stores it on the user’s USERS_TABLE item in place of any token or
+// token_ref, so the token never passes through an environment variable or a
+// log. It returns the exit status.
+func runSetTokenCLI(args []string) int {
+	if len(args) != 1 || args[0] == "" {
+		fmt.Fprintln(os.Stderr, "usage: bootstrap set-token <user_id> < token")
+		return 2
+	}
+	if err := setUserToken(context.Background(), args[0], os.Stdin); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Printf("stored encrypted token for user %s\n", args[0])
+	return 0
+}
+
+// setUserToken encrypts the first line of in as userID’s token and stores it.
+func setUserToken(ctx context.Context, userID string, in *os.File) error {
+	tableName, keyID := os.Getenv("USERS_TABLE"), os.Getenv("TOKEN_KMS_KEY_ID")
+	if tableName == "" || keyID == "" {
+		return errors.New("USERS_TABLE and TOKEN_KMS_KEY_ID must be set")
+	}
+	token, err := bufio.NewReader(in).ReadString('\n')
+	token = strings.TrimSpace(token)
+	if token == "" {
+		if err != nil {
+			return fmt.Errorf("reading token: %w", err)
+		}
+		return errors.New("no token on standard input")
+	}
+
+	resp, err := kms.NewFromConfig(awsCfg).Encrypt(ctx, &kms.EncryptInput{
+		KeyId:             aws.String(keyID),
+		Plaintext:         []byte(token),
+		EncryptionContext: tokenContext(userID),
+	})
+	if err != nil {
+		return fmt.Errorf("encrypting token: %w", err)
+	}
+	_, err = dynamoClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(tableName),
+		Key: map[string]types.AttributeValue{
+			"user_id": &types.AttributeValueMemberS{Value: userID},
+		},
+		UpdateExpression:         aws.String("SET encrypted_token = :t REMOVE #token, token_ref"),
+		ExpressionAttributeNames: map[string]string{"#token": "token"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":t": &types.AttributeValueMemberS{Value: base64.StdEncoding.EncodeToString(resp.CiphertextBlob)},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("UpdateItem failed (region=%s, table=%s): %w", awsRegion, tableName, err)
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"os"
+	"sort"
+	"time"
+)
+
+// leaderboardEntry is one user of the /leaderboard response. Movement is the
+// number of places gained in the group since yesterday.
+type leaderboardEntry struct {
+	Position   int         `json:"position"`
+	User       string      `json:"user"`
+	Name       interface{} `json:"name,omitempty"`
+	Points     interface{} `json:"points"`
+	GlobalRank interface{} `json:"global_rank"`
+	RankChange interface{} `json:"rank_change,omitempty"`
+	Movement   int         `json:"movement"`
+	Date       string      `json:"date"`
+
+	stats map[string]interface{}
+}
+
+// rankGroup sorts entries by points (highest first) or by global rank
+// (lowest first), and numbers their positions.
+func rankGroup(entries []*leaderboardEntry, by string) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		if by == "rank" {
+			ri, okI := toFloat(entries[i].stats["User_Global_Rank"])
+			rj, okJ := toFloat(entries[j].stats["User_Global_Rank"])
+			if okI && ri > 0 && okJ && rj > 0 {
+				return ri < rj
+			}
+			return okI && ri > 0
+		}
+		pi, _ := toFloat(entries[i].stats["Points"])
+		pj, _ := toFloat(entries[j].stats["Points"])
+		return pi > pj
+	})
+	for i, e := range entries {
+		e.Position = i + 1
+	}
+}
+
+// latestStats returns userID’s newest snapshot from the last three days, and
+// the one before it for movement.
+func latestStats(ctx context.Context, tableName, userID string, today time.Time) (latest, previous map[string]interface{}, date string, err error) {
+	items, err := loadRange(ctx, tableName, userID, today.AddDate(0, 0, -2), today)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	points := series(items)
+	if len(points) == 0 {
+		return nil, nil, "", nil
+	}
+	latest = points[len(points)-1]
+	if len(points) > 1 {
+		previous = points[len(points)-2]
+	}
+	return latest, previous, latest["date"].(string), nil
+}
+
+// leaderboardHandler serves /leaderboard[?by=points|rank]: every tracked user
+// (USER_ID and USER_IDS), or every user of the request’s tenant, ordered by
+// their latest stored snapshot, with the places each one moved in the group
+// since the previous day.
+func leaderboardHandler(ctx context.Context, inv invocation) (map[string]interface{}, error) {
+	tableName := os.Getenv("TABLE_NAME")
+	if tableName == "" {
+		return httpResponse(http.StatusInternalServerError, map[string]string{"error": "TABLE_NAME not configured"}), nil
+	}
+	by := inv.QueryParams["by"]
+	if by == "" {
+		by = "points"
+	}
+	if by != "points" && by != "rank" {
+		return httpResponse(http.StatusBadRequest, map[string]string{"error": "by must be points or rank"}), nil
+	}
+
+	today := currentDay()
+	var current, before []*leaderboardEntry
+	for _, user := range configuredUsers() {
+		if !inv.tenant.allows(user) {
+			continue
+		}
+		latest, previous, date, err := latestStats(ctx, tableName, user, today)
+		if err != nil {
+			slog.ErrorContext(ctx, "BatchGetItem failed", "region", awsRegion, "table", tableName, "error", err)
+			return httpResponse(http.StatusInternalServerError, map[string]string{"error": "Database lookup failed", "detail": err.Error()}), nil
+		}
+		if latest == nil {
+			continue
+		}
+		current = append(current, &leaderboardEntry{
+			User:       user,
+			Name:       visible(inv, latest, "Name"),
+			Points:     visible(inv, latest, "Points"),
+			GlobalRank: visible(inv, latest, "User_Global_Rank"),
+			RankChange: visible(inv, latest, "Rank_Change"),
+			Date:       date,
+			stats:      latest,
+		})
+		if previous != nil {
+			before = append(before, &leaderboardEntry{User: user, stats: previous})
+		}
+	}
+
+	rankGroup(current, by)
+	rankGroup(before, by)
+	yesterday := map[string]int{}
+	for _, e := range before {
+		yesterday[e.User] = e.Position
+	}
+	for _, e := range current {
+		if pos, ok := yesterday[e.User]; ok {
+			e.Movement = pos - e.Position
+		}
+	}
+	return httpResponse(http.StatusOK, map[string]interface{}{"by": by, "users": current}), nil
+}
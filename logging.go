@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/url"
+	"os"
+	"strings"
+	"sync/atomic"
+
+	"github.com/aws/aws-lambda-go/lambdacontext"
+)
+
+// logLevel is the lowest level logged, from LOG_LEVEL: debug, info
+// (default), warn or error. It is re‑read on every invocation, so the level
+// can be raised from SSM or the config file without a cold start.
+var logLevel = new(slog.LevelVar)
+
+func parseLogLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	err := level.UnmarshalText([]byte(strings.TrimSpace(s)))
+	return level, err
+}
+
+func checkLogLevel(s string) error {
+	_, err := parseLogLevel(s)
+	return err
+}
+
+// setLogLevel applies LOG_LEVEL, falling back to info when it’s unset or
+// invalid (configProblems reports the latter).
+func setLogLevel() {
+	level, err := parseLogLevel(os.Getenv("LOG_LEVEL"))
+	if err != nil {
+		level = slog.LevelInfo
+	}
+	logLevel.Set(level)
+}
+
+// requestID is the current invocation’s Lambda request ID. A container
+// serves one invocation at a time, so lines logged without a context are
+// still attributed to it.
+var requestID atomic.Value
+
+// startInvocation records ctx’s Lambda request ID for the lines logged
+// during the invocation.
+func startInvocation(ctx context.Context) {
+	id := ""
+	if lc, ok := lambdacontext.FromContext(ctx); ok {
+		id = lc.AwsRequestID
+	}
+	requestID.Store(id)
+	setLogLevel()
+}
+
+type logAttrsKey struct{}
+
+// withLogAttrs returns ctx with key/value pairs, such as the user being
+// refreshed or the HTB endpoint being called, added to every line logged
+// with it.
+func withLogAttrs(ctx context.Context, args ...any) context.Context {
+	attrs, _ := ctx.Value(logAttrsKey{}).([]slog.Attr)
+	attrs = append(attrs[:len(attrs):len(attrs)], argsToAttrs(args)...)
+	return context.WithValue(ctx, logAttrsKey{}, attrs)
+}
+
+func argsToAttrs(args []any) []slog.Attr {
+	var r slog.Record
+	r.Add(args...)
+	attrs := make([]slog.Attr, 0, r.NumAttrs())
+	r.Attrs(func(a slog.Attr) bool {
+		attrs = append(attrs, a)
+		return true
+	})
+	return attrs
+}
+
+// logEndpoint is the path of an HTB API URL, logged without the host or the
+// query string.
+func logEndpoint(rawURL string) string {
+	if u, err := url.Parse(rawURL); err == nil {
+		return u.Path
+	}
+	return rawURL
+}
+
+// contextHandler adds request_id, environment and the attributes set with
+// withLogAttrs to every record, unless the call already gave them.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	given := map[string]bool{}
+	r.Attrs(func(a slog.Attr) bool {
+		given[a.Key] = true
+		return true
+	})
+	add := func(a slog.Attr) {
+		if !given[a.Key] {
+			given[a.Key] = true
+			r.AddAttrs(a)
+		}
+	}
+	if ctx != nil {
+		if lc, ok := lambdacontext.FromContext(ctx); ok {
+			add(slog.String("request_id", lc.AwsRequestID))
+		}
+		attrs, _ := ctx.Value(logAttrsKey{}).([]slog.Attr)
+		for _, a := range attrs {
+			add(a)
+		}
+	}
+	if id, _ := requestID.Load().(string); id != "" {
+		add(slog.String("request_id", id))
+	}
+	if env := environment(); env != "" {
+		add(slog.String("environment", env))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+// setupLogging makes slog log JSON lines to stderr, where the Lambda runtime
+// ships them to CloudWatch Logs; the standard log package, used by the SDKs,
+// goes through it at info level. Metrics stay on stdout in their own format.
+func setupLogging() {
+	setLogLevel()
+	slog.SetDefault(slog.New(contextHandler{slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: logLevel})}))
+}
+
+// fatal logs an error that leaves the container unable to serve and exits.
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
@@ -4,9 +4,11 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -19,205 +21,864 @@ import (
 )
 
 var (
-	// in‑memory cache and its mutex
+	// in‑memory cache (of the date key cacheDate, stored at cachedAt) and
+	// its mutex
 	dataCache    map[string]interface{}
+	cacheDate    string
+	cachedAt     time.Time
 	cacheMutex   sync.RWMutex
 	dynamoClient *dynamodb.Client
 	awsRegion    string
+	awsCfg       aws.Config
 )
 
 func init() {
+	setupLogging()
+	if path, rest := configFlag(os.Args[1:]); path != "" {
+		os.Setenv("CONFIG_FILE", path)
+		os.Args = append(os.Args[:1], rest...)
+	}
 	// load AWS config once (reads AWS_REGION env var, profile, etc.)
 	cfg, err := awsconfig.LoadDefaultConfig(context.Background())
 	if err != nil {
-		log.Fatalf("unable to load AWS SDK config: %v", err)
+		fatal("unable to load AWS SDK config", "error", err)
 	}
+	setupTracing(&cfg)
+	awsCfg = cfg
 	awsRegion = cfg.Region
-	dynamoClient = dynamodb.NewFromConfig(cfg)
+	dynamoClient = dynamodb.NewFromConfig(cfg, withDynamoChaos)
 	dataCache = make(map[string]interface{})
+	if err := loadConfigFile(); err != nil {
+		fatal("invalid config file", "error", err)
+	}
+	loadSSMConfig(context.Background())
+	setLogLevel()
+	if err := loadStaticUsers(context.Background()); err != nil {
+		fatal("invalid user config", "error", err)
+	}
+	// the command‑line tools report problems themselves, or need less
+	if problems := configProblems(); len(problems) > 0 && len(os.Args) <= 1 {
+		fatal("invalid configuration", "problems", problems)
+	}
+	logTokenExpiry(context.Background())
+}
+
+// invocation holds the fields used to route an incoming event. Function URL
+// requests carry no action and are served today’s stats; scheduled rules set
+// a constant {"action": "..."} input; SQS deliveries carry Records.
+type invocation struct {
+	Action  string      `json:"action"`
+	Records []sqsRecord `json:"Records"`
+
+	// backfill, export and report options
+	User  string `json:"user"`
+	Days  int    `json:"days"`
+	Month string `json:"month"`
+
+	// Function URL request fields
+	RawPath         string            `json:"rawPath"`
+	Headers         map[string]string `json:"headers"`
+	QueryParams     map[string]string `json:"queryStringParameters"`
+	Body            string            `json:"body"`
+	IsBase64Encoded bool              `json:"isBase64Encoded"`
+	RequestContext  struct {
+		HTTP struct {
+			Method string `json:"method"`
+		} `json:"http"`
+	} `json:"requestContext"`
+
+	// the tenant whose API key authorized the request, if any
+	tenant *tenant
 }
 
-func handler(ctx context.Context) (map[string]interface{}, error) {
-	// return cached if present
-	cacheMutex.RLock()
-	if len(dataCache) != 0 {
-		res := make(map[string]interface{}, len(dataCache))
-		for k, v := range dataCache {
-			res[k] = v
+func handler(ctx context.Context, event json.RawMessage) (map[string]interface{}, error) {
+	reloadConfigFile()
+	loadSSMConfig(ctx)
+	startInvocation(ctx)
+	loadUserConfigs(ctx)
+	loadTeamMembers(ctx)
+	loadUniversityMembers(ctx)
+	inv, err := decodeInvocation(event)
+	if err != nil {
+		slog.WarnContext(ctx, "rejected event", "error", err)
+		if inv.RawPath != "" {
+			return errorResponse(err), nil
 		}
-		cacheMutex.RUnlock()
-		return res, nil
+		return nil, err
+	}
+	switch inv.Action {
+	case "weekly_digest":
+		return actionResult(weeklyDigest(ctx))
+	case "flush_notifications":
+		return actionResult(flushNotifications(ctx))
+	case "dispatch":
+		return actionResult(dispatchRefreshes(ctx))
+	case "backfill":
+		return actionResult(backfill(ctx, inv))
+	case "export_parquet":
+		return actionResult(exportParquet(ctx, inv))
+	case "archive":
+		return actionResult(archiveSnapshots(ctx))
+	case "monthly_report":
+		return actionResult(monthlyReport(ctx, inv))
+	case "validate", "doctor":
+		return runDoctor(ctx), nil
+	}
+	if inv.Records != nil {
+		return actionResult(refreshWorker(ctx, inv.Records))
+	}
+	t, denied := authorizeTenant(ctx, inv)
+	if denied != nil {
+		return denied, nil
 	}
-	cacheMutex.RUnlock()
+	inv.tenant = t
+	res, err := serveRequest(ctx, inv)
+	if err != nil && inv.RawPath != "" {
+		// Function URL requests get a status code and an error body;
+		// direct invocations fail with the error itself
+		res, err = errorResponse(err), nil
+	}
+	return redactResponse(inv, res), err
+}
 
+// serveRequest routes a Function URL request by path.
+func serveRequest(ctx context.Context, inv invocation) (map[string]interface{}, error) {
+	switch inv.RawPath {
+	case "/hooks/refresh":
+		return refreshHook(ctx, inv)
+	case "/schema/events.json":
+		return schemaResponse(), nil
+	case "/history":
+		return historyHandler(ctx, inv)
+	case "/history/aggregate":
+		return aggregateHandler(ctx, inv)
+	case "/history/country":
+		return countryHistoryHandler(ctx, inv)
+	case "/history/categories":
+		return categoryHistoryHandler(ctx, inv)
+	case "/history/intraday":
+		return intradayHandler(ctx, inv)
+	case "/trend":
+		return trendHandler(ctx, inv)
+	case "/projection":
+		return projectionHandler(ctx, inv)
+	case "/compare":
+		return compareHandler(ctx, inv)
+	case "/leaderboard":
+		return leaderboardHandler(ctx, inv)
+	case "/goals":
+		return goalsHandler(ctx, inv)
+	case "/correlation":
+		return correlationHandler(ctx, inv)
+	case "/diff":
+		return diffHandler(ctx, inv)
+	case "/export":
+		return dumpHandler(ctx, inv)
+	case "/status":
+		return statusHandler(ctx, inv)
+	case "/readyz":
+		return readyHandler(ctx)
+	case "/admin/config":
+		return adminConfigHandler(ctx, inv)
+	}
+	if strings.HasPrefix(inv.RawPath, "/review/") {
+		return reviewHandler(ctx, inv)
+	}
+	if strings.HasPrefix(inv.RawPath, "/season/") {
+		return seasonHandler(ctx, inv)
+	}
+	if inv.tenant != nil {
+		res, err := tenantStats(ctx, inv)
+		return withLabels(res, inv.QueryParams["lang"]), err
+	}
+	res, err := statsHandler(ctx)
+	return withLabels(res, inv.QueryParams["lang"]), err
+}
+
+func statsHandler(ctx context.Context) (map[string]interface{}, error) {
 	// today’s date key
-	today := time.Now().Format("2006-01-02")
+	today := currentDate()
+
+	// return cached if present, fresh and still today’s; a warm container
+	// crossing midnight in TIMEZONE moves on to the new day’s item
+	if res := cachedStats(today); res != nil {
+		return res, nil
+	}
 
 	// table name from env
 	tableName := os.Getenv("TABLE_NAME")
 	if tableName == "" {
-		return map[string]interface{}{"error": "TABLE_NAME not configured"}, nil
+		return nil, &apiError{code: http.StatusInternalServerError, msg: "TABLE_NAME not configured"}
 	}
 
 	// attempt to read from DynamoDB
+	stored := false
+	key := itemKey(os.Getenv("USER_ID"), today)
 	getResp, err := dynamoClient.GetItem(ctx, &dynamodb.GetItemInput{
-		TableName: aws.String(tableName),
+		TableName: aws.String(userTable(os.Getenv("USER_ID"), tableName)),
 		Key: map[string]types.AttributeValue{
-			"date": &types.AttributeValueMemberS{Value: today},
+			"date": &types.AttributeValueMemberS{Value: key},
 		},
 	})
 	if err != nil {
-		log.Printf("⛔ GetItem failed (region=%s, table=%s, key=%s): %v",
-			awsRegion, tableName, today, err)
-		return map[string]interface{}{
-			"error":  "Database lookup failed",
-			"detail": err.Error(),
-		}, nil
+		slog.ErrorContext(ctx, "GetItem failed", "region", awsRegion, "table", tableName, "key", key, "error", err)
+		return nil, &apiError{code: http.StatusInternalServerError, msg: "Database lookup failed", detail: err.Error()}
 	}
 	if getResp.Item != nil {
 		var item map[string]interface{}
 		if err := attributevalue.UnmarshalMap(getResp.Item, &item); err == nil {
-			cacheMutex.Lock()
-			dataCache = item
-			cacheMutex.Unlock()
-			return item, nil
+			item = verifyContent(item)
+			if until, ok := failedUntil(item); ok {
+				return staleOnError(ctx, tableName, os.Getenv("USER_ID"), &apiError{code: http.StatusServiceUnavailable, msg: "HTB fetch failed, retrying after " + until.UTC().Format(time.RFC3339), retryAt: until})
+			}
+			stored = len(stripFailure(item)) > 1
+			if stored && !refreshDue(item) {
+				storeCache(item, today)
+				return item, nil
+			}
+		}
+	}
+
+	// nothing stored for today yet: with a refresh queue, answer with
+	// yesterday’s stats while the worker fetches today’s
+	if !stored {
+		if stale := staleWhileRevalidate(ctx, tableName, os.Getenv("USER_ID"), today); stale != nil {
+			return stale, nil
 		}
 	}
 
-	// no existing item → fetch from HTB API
-	info, err := getRankingsFromHTB(ctx)
+	// no existing item, a lapsed failure marker, or one from an earlier
+	// REFRESH_INTERVAL slot → fetch from HTB API
+	bctx, batch := withNotifyBatch(ctx)
+	info, err := refreshUser(bctx, tableName, os.Getenv("USER_ID"), today, true)
+	batch.flush(ctx)
 	if err != nil {
-		// write an empty item so we don’t hammer the API
-		_, _ = dynamoClient.PutItem(ctx, &dynamodb.PutItemInput{
-			TableName: aws.String(tableName),
-			Item: map[string]types.AttributeValue{
-				"date": &types.AttributeValueMemberS{Value: today},
-			},
-		})
-		return map[string]interface{}{"error": err.Error()}, nil
+		return staleOnError(ctx, tableName, os.Getenv("USER_ID"), err)
+	}
+
+	// update cache, unless HTB is down and this is a stored fallback, and
+	// return
+	if info[staleField] != true {
+		storeCache(info, today)
+	}
+	return info, nil
+}
+
+// refreshError is a failed refresh, carrying the message returned to callers
+// and the underlying cause. rateLimited marks one HTB turned away with a 429,
+// reported apart from other failures so callers know to back off;
+// retryQueued one that will be retried from REFRESH_QUEUE_URL. guidance,
+// set when HTB rejected the token, says how to fix it.
+type refreshError struct {
+	msg         string
+	cause       error
+	rateLimited bool
+	retryQueued bool
+	guidance    string
+}
+
+func (e *refreshError) Error() string {
+	if e.cause == nil {
+		return e.msg
+	}
+	return e.msg + ": " + e.cause.Error()
+}
+
+func (e *refreshError) response() map[string]interface{} {
+	res := map[string]interface{}{"error": e.msg}
+	if e.cause != nil {
+		res["detail"] = e.cause.Error()
+	}
+	if e.rateLimited {
+		res["rate_limited"] = true
+	}
+	if e.retryQueued {
+		res["retry_queued"] = true
+	}
+	if e.guidance != "" {
+		res["auth_failed"] = true
+		res["guidance"] = e.guidance
+	}
+	return res
+}
+
+// status is the HTTP status for the failure: 429 when HTB rate limited the
+// refresh, 503 when a concurrent one didn’t finish in time, 502 otherwise.
+func (e *refreshError) status() int {
+	if e.rateLimited {
+		return http.StatusTooManyRequests
+	}
+	if errors.Is(e.cause, errFetchInProgress) {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusBadGateway
+}
+
+// refreshFailure is the HTTP response for err from a refresh: its status
+// and body for a *refreshError, a generic 500 for anything else.
+func refreshFailure(err error) map[string]interface{} {
+	var re *refreshError
+	if !errors.As(err, &re) {
+		return httpResponse(http.StatusInternalServerError, map[string]string{"error": "Refresh failed", "detail": err.Error()})
+	}
+	return httpResponse(re.status(), re.response())
+}
+
+// itemKey is the table key for userID’s snapshot on date. The primary
+// USER_ID keeps plain date keys; other users are namespaced as "<id>#<date>",
+// or "<key_prefix>#<date>" when their config sets one. All of them sit under
+// the ENVIRONMENT prefix, if any.
+func itemKey(userID, date string) string {
+	if c, ok := userSettings(userID); ok && c.KeyPrefix != "" {
+		return envKey(c.KeyPrefix + "#" + date)
+	}
+	if userID == "" || userID == os.Getenv("USER_ID") {
+		return envKey(date)
+	}
+	return envKey(userID + "#" + date)
+}
+
+// refreshUser fetches fresh stats for userID from HTB, stores them for date
+// and, if notify is set, notifies on changes since the last snapshot: an
+// earlier one from the same day (a forced refresh) or else the previous
+// day’s. Token state stays in tableName; the user’s own data goes to their
+// table, if they have one. Errors are *refreshError.
+func refreshUser(ctx context.Context, tableName, userID, date string, notify bool) (map[string]interface{}, error) {
+	ctx = withLogAttrs(ctx, "user", userID)
+	ctx = withNotifyUser(ctx, userID)
+	dataTable := userTable(userID, tableName)
+	key := itemKey(userID, date)
+	existing, _ := loadItem(ctx, dataTable, key)
+	if circuitOpen(ctx, tableName) {
+		// HTB has been failing: serve what we have instead of waiting on it,
+		// and leave the day’s item alone so it is fetched once HTB is back
+		if last := lastKnownGood(ctx, tableName, userID, date, existing); last != nil {
+			if len(existing) <= 1 {
+				scheduleRetry(ctx, tableName, userID, date, errCircuitOpen)
+			}
+			return last, nil
+		}
+		return nil, &refreshError{msg: errCircuitOpen.Error(), retryQueued: scheduleRetry(ctx, tableName, userID, date, errCircuitOpen)}
+	}
+	// one invocation fetches, the others wait for its item
+	release, won := claimFetch(ctx, tableName, userID, date)
+	if !won {
+		return awaitFetch(ctx, tableName, userID, date)
+	}
+	defer release()
+	fetchCtx, cancel := fetchContext(ctx)
+	info, err := getRankingsFromHTB(fetchCtx, userID)
+	cutShort := fetchCtx.Err() != nil && ctx.Err() == nil
+	cancel()
+	recordTokenResult(ctx, tableName, err)
+	recordCircuitResult(ctx, tableName, err)
+	checkTokenExpiry(ctx, tableName)
+	if errors.Is(err, errRateLimited) {
+		// nothing is marked as attempted: the next call, once the
+		// limit has passed, should fetch again
+		slog.WarnContext(ctx, "refresh rate limited by HTB", "error", err)
+		return nil, &refreshError{msg: err.Error(), rateLimited: true, retryQueued: scheduleRetry(ctx, tableName, userID, date, err)}
+	}
+	// yesterday’s snapshot gives the day‑over‑day deltas and, without an
+	// earlier one today, the baseline broken data is spotted against
+	day, _ := time.Parse("2006-01-02", date)
+	prevKey := itemKey(userID, day.AddDate(0, 0, -1).Format("2006-01-02"))
+	prev, prevErr := loadItem(ctx, dataTable, prevKey)
+	if prevErr != nil {
+		slog.ErrorContext(ctx, "GetItem failed", "region", awsRegion, "table", dataTable, "key", prevKey, "error", prevErr)
+	}
+	var implausibleErr *implausibleError
+	if err == nil {
+		base := existing
+		if len(base) <= 1 {
+			base = prev
+		}
+		if problems := implausible(base, info); len(problems) > 0 {
+			implausibleErr = &implausibleError{problems: problems}
+			reportImplausible(ctx, userID, implausibleErr)
+			err = implausibleErr
+		}
+	}
+	if err != nil {
+		// remember the failure for FAILURE_TTL so we don’t hammer the
+		// API, unless that would clobber stats already stored for the day
+		if len(existing) <= 1 {
+			_, _ = dynamoClient.PutItem(ctx, &dynamodb.PutItemInput{
+				TableName: aws.String(dataTable),
+				Item:      failureMarker(key),
+			})
+		} else if slot := currentSlot(); slot >= 0 && date == currentDate() {
+			// likewise count this REFRESH_INTERVAL slot as attempted
+			_, _ = dynamoClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+				TableName:                 aws.String(dataTable),
+				Key:                       map[string]types.AttributeValue{"date": &types.AttributeValueMemberS{Value: key}},
+				UpdateExpression:          aws.String("SET " + intradayField + " = :h"),
+				ExpressionAttributeValues: map[string]types.AttributeValue{":h": &types.AttributeValueMemberN{Value: strconv.Itoa(slot)}},
+			})
+		}
+		if implausibleErr != nil {
+			// keep serving the day’s earlier stats rather than garbage
+			if len(existing) > 1 {
+				return lastKnownGood(ctx, tableName, userID, date, existing), nil
+			}
+			return nil, &refreshError{msg: err.Error(), cause: err}
+		}
+		var ae *authError
+		if errors.As(err, &ae) {
+			// not a generic failure: recordTokenResult alerts the operator
+			return nil, &refreshError{msg: err.Error(), guidance: ae.guidance()}
+		}
+		notifyFailure(ctx, err)
+		return nil, &refreshError{msg: err.Error(), retryQueued: scheduleRetry(ctx, tableName, userID, date, err)}
+	}
+
+	// a partial fetch keeps what an earlier one today already had
+	mergePartial(existing, info)
+	// a renamed or moved profile is noted, not taken for a new user
+	reconcileIdentity(ctx, tableName, userID, date, info)
+	if cutShort && info[partialField] == true {
+		// the invocation ran out of time: store what we have and let the
+		// queue complete it
+		slog.WarnContext(ctx, "refresh hit the invocation deadline, storing a partial snapshot")
+		scheduleRetry(ctx, tableName, userID, date, context.DeadlineExceeded)
+	}
+
+	for k, v := range dayDeltas(prev, info) {
+		info[k] = v
+	}
+	markAnomalies(prev, info)
+	for k, v := range paceFields(ctx, dataTable, userID, day, info) {
+		info[k] = v
+	}
+	for k, v := range updateStreaks(ctx, dataTable, userID, day, prev, info) {
+		info[k] = v
+	}
+	if slot := currentSlot(); slot >= 0 && date == currentDate() {
+		info[intradayField] = slot
+	}
+
+	// the changes since the last snapshot — an earlier one today, else
+	// yesterday’s — are derived before the write, to be stored with it
+	var groups [][]Change
+	baseline := ""
+	switch {
+	case len(existing) > 1:
+		groups, baseline = snapshotChanges(userID, existing, info), date
+	case prevErr == nil:
+		groups = snapshotChanges(userID, prev, info)
+		if len(prev) > 1 {
+			baseline = day.AddDate(0, 0, -1).Format("2006-01-02")
+		}
 	}
 
 	// prepare full item for DynamoDB
-	itemToStore := map[string]interface{}{"date": today}
+	itemToStore := map[string]interface{}{"date": key}
 	for k, v := range info {
 		itemToStore[k] = v
 	}
 	av, err := attributevalue.MarshalMap(itemToStore)
 	if err != nil {
-		return map[string]interface{}{"error": "Error marshalling item"}, nil
+		return nil, &refreshError{msg: "Error marshalling item"}
+	}
+	av = withContentHash(av)
+	var marker map[string]types.AttributeValue
+	if notify && hasChanges(groups) {
+		if marker, err = changesItem(changesKey(userID, date), av, baseline, groups); err != nil {
+			return nil, &refreshError{msg: "Error marshalling changes", cause: err}
+		}
+		// changes a crashed earlier refresh stored are sent, not overwritten
+		sendStoredChanges(ctx, dataTable, userID, date)
 	}
 
-	// write to DynamoDB
-	if _, err := dynamoClient.PutItem(ctx, &dynamodb.PutItemInput{
-		TableName: aws.String(tableName),
-		Item:      av,
-	}); err != nil {
-		log.Printf("⛔ PutItem failed (region=%s, table=%s, key=%s): %v",
-			awsRegion, tableName, today, err)
-		return map[string]interface{}{
-			"error":  "Error writing item to DynamoDB",
-			"detail": err.Error(),
-		}, nil
-	}
-
-	// update cache and return
-	cacheMutex.Lock()
-	dataCache = info
-	cacheMutex.Unlock()
+	// write to DynamoDB, the snapshot and its changes together
+	if err := storeSnapshot(ctx, dataTable, av, marker); err != nil {
+		slog.ErrorContext(ctx, "TransactWriteItems failed", "region", awsRegion, "table", dataTable, "key", key, "error", err)
+		return nil, &refreshError{msg: "Error writing item to DynamoDB", cause: err}
+	}
+	storeIntraday(ctx, dataTable, userID, date, info)
+
+	emitStatMetrics(userID, info)
+
+	if !notify {
+		return info, nil
+	}
+	// goals are only marked reached when the news can go out
+	reached := checkGoals(ctx, dataTable, userID, date, info)
+	if len(configuredUsers()) > 1 {
+		for i := range reached {
+			reached[i].User = userID
+		}
+	}
+	notifyChanges(ctx, reached)
+
+	// notify on any movement since the last snapshot, as stored with it
+	sendStoredChanges(ctx, dataTable, userID, date)
 	return info, nil
 }
 
-func getRankingsFromHTB(ctx context.Context) (map[string]interface{}, error) {
-	userID := os.Getenv("USER_ID")
-	appToken := os.Getenv("TOKEN")
-	if userID == "" || appToken == "" {
-		return nil, errors.New("USER_ID or TOKEN not configured")
+// loadItem reads the stored snapshot for date, returning nil if none exists.
+func loadItem(ctx context.Context, tableName, date string) (map[string]interface{}, error) {
+	resp, err := dynamoClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(tableName),
+		Key: map[string]types.AttributeValue{
+			"date": &types.AttributeValueMemberS{Value: date},
+		},
+	})
+	if err != nil || resp.Item == nil {
+		return nil, err
 	}
+	var item map[string]interface{}
+	if err := attributevalue.UnmarshalMap(resp.Item, &item); err != nil {
+		return nil, err
+	}
+	return stripFailure(verifyContent(item)), nil
+}
 
-	client := &http.Client{Timeout: 10 * time.Second}
-	headers := map[string]string{
-		"Authorization": "Bearer " + appToken,
-		"User-Agent":    "Mozilla/5.0 (Windows NT 10.0; Win64; x64)",
+// loadRange reads every stored snapshot of userID between from and to
+// (inclusive), keyed by date, including archived ones. Days without an item
+// are simply absent from the result.
+func loadRange(ctx context.Context, tableName, userID string, from, to time.Time) (map[string]map[string]interface{}, error) {
+	tableName = userTable(userID, tableName)
+	var keys []map[string]types.AttributeValue
+	dates := map[string]string{}
+	for d := from; !d.After(to); d = d.AddDate(0, 0, 1) {
+		key := itemKey(userID, d.Format("2006-01-02"))
+		dates[key] = d.Format("2006-01-02")
+		keys = append(keys, map[string]types.AttributeValue{
+			"date": &types.AttributeValueMemberS{Value: key},
+		})
 	}
 
-	doGet := func(url string, target interface{}) error {
-		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
-		for k, v := range headers {
-			req.Header.Set(k, v)
+	items := make(map[string]map[string]interface{})
+	for len(keys) > 0 {
+		// BatchGetItem accepts at most 100 keys per call
+		n := len(keys)
+		if n > 100 {
+			n = 100
 		}
-		resp, err := client.Do(req)
+		pending := map[string]types.KeysAndAttributes{tableName: {Keys: keys[:n]}}
+		keys = keys[n:]
+		for len(pending) > 0 {
+			resp, err := dynamoClient.BatchGetItem(ctx, &dynamodb.BatchGetItemInput{RequestItems: pending})
+			if err != nil {
+				return nil, err
+			}
+			for _, raw := range resp.Responses[tableName] {
+				var item map[string]interface{}
+				if err := attributevalue.UnmarshalMap(raw, &item); err != nil {
+					return nil, err
+				}
+				if key, ok := item["date"].(string); ok {
+					items[dates[key]] = stripFailure(verifyContent(item))
+				}
+			}
+			pending = resp.UnprocessedKeys
+		}
+	}
+
+	// days past the retention period live in the S3 archive
+	if cutoff := archiveCutoff(); archiveEnabled() && from.Before(cutoff) {
+		archived, err := loadArchived(ctx, userID, from, minTime(to, cutoff.AddDate(0, 0, -1)))
 		if err != nil {
-			return err
+			return nil, err
+		}
+		for date, item := range archived {
+			if _, ok := items[date]; !ok {
+				items[date] = verifyContent(item)
+			}
+		}
+	}
+	return items, nil
+}
+
+// htbAPI is the URL of an HTB API path under HTB_API_BASE_URL, by default
+// https://labs.hackthebox.com, so requests can go through an egress proxy or
+// to a mock server.
+func htbAPI(path string) string {
+	base := strings.TrimRight(os.Getenv("HTB_API_BASE_URL"), "/")
+	if base == "" {
+		base = "https://labs.hackthebox.com"
+	}
+	return base + path
+}
+
+// htbGetter returns a function that GETs an HTB API URL with userID’s app
+// token and decodes the JSON response into target. 401/403 become an *authError.
+func htbGetter(ctx context.Context, userID string) func(url string, target interface{}) error {
+	get, _ := htbGetterUsing(ctx, userID)
+	return get
+}
+
+// htbGetterUsing is htbGetter with secondary‑token fallback: when HTB rejects
+// the primary token and a secondary one is configured, the request is retried
+// with it and the secondary is kept for the rest of the fetch. used names the
+// token that was last sent, "primary" or "secondary".
+func htbGetterUsing(ctx context.Context, userID string) (get func(url string, target interface{}) error, used *string) {
+	client := &http.Client{Timeout: htbTimeout(), Transport: tracedTransport(chaosTransport{next: http.DefaultTransport})}
+	which := "primary"
+	fetch := func(url, token string, target interface{}) error {
+		ctx := withLogAttrs(ctx, "endpoint", logEndpoint(url))
+		return traceHTBCall(ctx, url, func(ctx context.Context) error {
+			return withHTBRetries(ctx, func() error {
+				if err := waitForHTB(ctx); err != nil {
+					return err
+				}
+				req, _ := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+				setHTBHeaders(req)
+				req.Header.Set("Authorization", "Bearer "+token)
+				start := time.Now()
+				resp, err := client.Do(req)
+				if err != nil {
+					return err
+				}
+				defer resp.Body.Close()
+				slog.DebugContext(ctx, "HTB request", "status", resp.StatusCode, "duration_ms", time.Since(start).Milliseconds())
+				// checked first: a challenge comes as a 403 and must not
+				// count against the token
+				if blocked := blockedResponse(resp); blocked != nil {
+					emitMetric("HTBUnavailable", 1, map[string]string{"Kind": blocked.kind})
+					return blocked
+				}
+				if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+					return rejectedToken(resp.StatusCode, token)
+				}
+				if resp.StatusCode == http.StatusTooManyRequests {
+					wait := retryAfter(resp.Header.Get("Retry-After"))
+					holdHTB(wait)
+					emitMetric("HTBRateLimited", 1, nil)
+					return &rateLimitError{retryAfter: wait}
+				}
+				if resp.StatusCode != http.StatusOK {
+					return &statusError{code: resp.StatusCode}
+				}
+				body := http.MaxBytesReader(nil, resp.Body, maxHTBResponse)
+				if sd, ok := target.(streamDecoder); ok {
+					return sd.decodeFrom(body)
+				}
+				return json.NewDecoder(body).Decode(target)
+			})
+		})
+	}
+	// the tokens are resolved on the first request and kept for the whole
+	// fetch: an encrypted token costs a KMS Decrypt
+	var primary, secondary string
+	var tokenErr error
+	resolved := false
+	return func(url string, target interface{}) error {
+		if !resolved {
+			primary, secondary, tokenErr = userTokens(ctx, userID)
+			resolved = true
+		}
+		if tokenErr != nil {
+			return tokenErr
+		}
+		token := primary
+		if which == "secondary" && secondary != "" {
+			token = secondary
+		}
+		err := fetch(url, token, target)
+		if errors.Is(err, errUnauthorized) && token == primary && secondary != "" {
+			slog.WarnContext(ctx, "HTB rejected the primary token, retrying with the secondary", "endpoint", logEndpoint(url))
+			which = "secondary"
+			err = fetch(url, secondary, target)
 		}
-		defer resp.Body.Close()
-		if resp.StatusCode != http.StatusOK {
-			return errors.New("non-200 response")
+		if errors.Is(err, errUnauthorized) {
+			forgetToken()
 		}
-		return json.NewDecoder(resp.Body).Decode(target)
+		return err
+	}, &which
+}
+
+func getRankingsFromHTB(ctx context.Context, userID string) (map[string]interface{}, error) {
+	if userID == "" {
+		return nil, errors.New("USER_ID not configured")
 	}
+	doGet, tokenUsed := htbGetterUsing(ctx, userID)
 
 	// 1) basic profile
 	var profileResp struct {
 		Profile struct {
-			Name         string `json:"name"`
-			CountryCode  string `json:"country_code"`
-			SystemOwns   int    `json:"system_owns"`  // now plain int
-			UserOwns     int    `json:"user_owns"`
-			SystemBloods int    `json:"system_bloods"`
-			UserBloods   int    `json:"user_bloods"`
-			Rank         string `json:"rank"`         // kept as string
-			Ranking      int    `json:"ranking"`
+			Name         string  `json:"name"`
+			CountryCode  string  `json:"country_code"`
+			SystemOwns   int     `json:"system_owns"`  // now plain int
+			UserOwns     int     `json:"user_owns"`
+			SystemBloods int     `json:"system_bloods"`
+			UserBloods   int     `json:"user_bloods"`
+			Rank         string  `json:"rank"`         // kept as string
+			Ranking      int     `json:"ranking"`
+			Points       int     `json:"points"`
+			NextRank     string  `json:"next_rank"`
+			Ownership    float64 `json:"rank_ownership"`
+			Requirement  float64 `json:"rank_requirement"`
 		} `json:"profile"`
 	}
-	if err := doGet("https://labs.hackthebox.com/api/v4/user/profile/basic/"+userID, &profileResp); err != nil {
-		return nil, err
+	// a failed profile call no longer discards the other calls’ data, unless
+	// the token is rejected or HTB asks to slow down: then the others would
+	// fail the same way
+	status := map[string]interface{}{}
+	info := map[string]interface{}{}
+	profileErr := doGet(htbAPI("/api/v4/user/profile/basic/"+userID), &profileResp)
+	if errors.Is(profileErr, errUnauthorized) || errors.Is(profileErr, errRateLimited) {
+		return nil, profileErr
 	}
 	name := profileResp.Profile.Name
 	code := profileResp.Profile.CountryCode
-	if name == "" || code == "" {
-		return nil, errors.New("Could not retrieve user profile")
+	if profileErr == nil && (name == "" || code == "") {
+		profileErr = errors.New("Could not retrieve user profile")
 	}
-
-	info := map[string]interface{}{
-		"System_Owns":      profileResp.Profile.SystemOwns,
-		"User_Owns":        profileResp.Profile.UserOwns,
-		"System_Bloods":    profileResp.Profile.SystemBloods,
-		"User_Bloods":      profileResp.Profile.UserBloods,
-		"Rank":             profileResp.Profile.Rank,
-		"User_Global_Rank": profileResp.Profile.Ranking,
+	status["profile"] = callStatus(profileErr)
+	if profileErr == nil {
+		info["Name"] = name
+		info["Country_Code"] = code
+		info["System_Owns"] = profileResp.Profile.SystemOwns
+		info["User_Owns"] = profileResp.Profile.UserOwns
+		info["System_Bloods"] = profileResp.Profile.SystemBloods
+		info["User_Bloods"] = profileResp.Profile.UserBloods
+		info["Rank"] = profileResp.Profile.Rank
+		info["User_Global_Rank"] = profileResp.Profile.Ranking
+		info["Points"] = profileResp.Profile.Points
+		info["Rank_Ownership"] = profileResp.Profile.Ownership
+		if next := profileResp.Profile.NextRank; next != "" {
+			info["Next_Rank"] = next
+			info["Rank_Requirement"] = profileResp.Profile.Requirement
+		}
 	}
 
-	// 2) local rankings
-	var localResp struct {
-		Data struct {
-			Rankings []struct {
-				Name string `json:"name"`
-				Rank int    `json:"rank"`  // plain int
-			} `json:"rankings"`
-		} `json:"data"`
-	}
-	_ = doGet("https://labs.hackthebox.com/api/v4/rankings/country/"+code+"/members", &localResp)
-	for _, r := range localResp.Data.Rankings {
-		if r.Name == name {
-			info["Local_Rank"] = r.Rank
-			break
+	// 2) local rankings, which need the profile’s name and country
+	countryTotal := 0
+	switch {
+	case !fetchEnabled("country"):
+		info["Country_Skipped"] = true
+		status["country"] = "skipped"
+	case profileErr != nil:
+		info["Country_Unavailable"] = true
+		status["country"] = "failed"
+	default:
+		search, total, err := fetchCountryRanking(doGet, code, userID, name)
+		if err != nil {
+			// remembered so the country‑rank history can tell a gap from a drop‑out
+			info["Country_Unavailable"] = true
+		}
+		status["country"] = callStatus(err)
+		countryTotal = total
+		if search.found != nil {
+			info["Local_Rank"] = search.found.Rank
+			// remember who sits just above us so overtakes can be named later
+			info["Local_Above"] = search.above
 		}
 	}
 
+	addPercentiles(info, countryTotal)
+
 	// 3) challenge progress
 	var challResp struct {
 		Profile struct {
 			ChallengeOwns struct {
 				Solved int `json:"solved"`  // plain int
 			} `json:"challenge_owns"`
+			Categories []struct {
+				Name  string `json:"name"`
+				Owned int    `json:"owned_flags"`
+			} `json:"challenge_categories"`
 		} `json:"profile"`
 	}
-	_ = doGet("https://labs.hackthebox.com/api/v4/user/profile/progress/challenges/"+userID, &challResp)
-	info["Challenge_Owns"] = challResp.Profile.ChallengeOwns.Solved
+	status["challenges"] = "skipped"
+	if fetchEnabled("challenges") {
+		err := doGet(htbAPI("/api/v4/user/profile/progress/challenges/"+userID), &challResp)
+		status["challenges"] = callStatus(err)
+		if err == nil {
+			info["Challenge_Owns"] = challResp.Profile.ChallengeOwns.Solved
+			if len(challResp.Profile.Categories) > 0 {
+				categories := make(map[string]interface{}, len(challResp.Profile.Categories))
+				for _, c := range challResp.Profile.Categories {
+					categories[c.Name] = c.Owned
+				}
+				info["Challenge_Categories"] = categories
+			}
+		}
+	}
+
+	// 4) badges (stored as plain maps so fresh and DynamoDB values compare alike)
+	var badgeResp struct {
+		Badges []struct {
+			ID   int    `json:"id"`
+			Name string `json:"name"`
+			Icon string `json:"icon"`
+		} `json:"badges"`
+	}
+	status["badges"] = "skipped"
+	if fetchEnabled("badges") {
+		err := doGet(htbAPI("/api/v4/user/profile/badges/"+userID), &badgeResp)
+		status["badges"] = callStatus(err)
+		if err == nil {
+			badges := make([]interface{}, 0, len(badgeResp.Badges))
+			for _, b := range badgeResp.Badges {
+				badges = append(badges, map[string]interface{}{
+					"id":   b.ID,
+					"name": b.Name,
+					"icon": badgeIconURL(b.Icon),
+				})
+			}
+			info["Badges"] = badges
+		}
+	}
+
+	// 5) optional season standing
+	status["season"] = "skipped"
+	if seasonTrackingEnabled() {
+		// only the token owner’s standing is served: "skipped" for the rest
+		if err := fetchSeason(doGet, userID, info); !errors.Is(err, errNotTokenOwner) {
+			status["season"] = callStatus(err)
+		}
+	}
 
+	// 6) optional blood details, newest first, used to name blooded machines
+	status["bloods"] = "skipped"
+	if bloodDetailsEnabled() {
+		var activityResp struct {
+			Profile struct {
+				Activity []htbActivity `json:"activity"`
+			} `json:"profile"`
+		}
+		err := doGet(htbAPI("/api/v4/user/profile/activity/"+userID), &activityResp)
+		status["bloods"] = callStatus(err)
+		if err == nil {
+			bloods := []interface{}{}
+			for _, a := range activityResp.Profile.Activity {
+				if a.FirstBlood {
+					bloods = append(bloods, map[string]interface{}{
+						"date": a.Date,
+						"type": a.Type,
+						"name": a.Name,
+					})
+				}
+			}
+			info["Recent_Bloods"] = bloods
+		}
+	}
+
+	// nothing came through at all (the profile, at least, failed): fail as a
+	// whole
+	ok := false
+	for _, st := range status {
+		ok = ok || st == "ok"
+	}
+	if !ok {
+		return nil, profileErr
+	}
+	setFetchStatus(info, status)
+
+	// which token got through, so a pending rotation shows up in the data
+	info["Token_Used"] = *tokenUsed
 	return info, nil
 }
 
 func main() {
-	lambda.Start(handler)
+	if len(os.Args) > 1 && os.Args[1] == "validate" {
+		os.Exit(runDoctorCLI())
+	}
+	if len(os.Args) > 1 && os.Args[1] == "set-token" {
+		os.Exit(runSetTokenCLI(os.Args[2:]))
+	}
+	lambda.StartWithOptions(handler, lambda.WithEnableSIGTERM(onShutdown))
 }
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// metricNamespace is the CloudWatch namespace for metrics emitted by this service.
+const metricNamespace = "HTBRankings"
+
+// emitMetric writes a CloudWatch Embedded Metric Format line to stdout, which
+// Lambda turns into a custom metric without any extra API calls. Metrics get
+// an Environment dimension when ENVIRONMENT is set.
+func emitMetric(name string, value float64, dims map[string]string) {
+	keys := make([]string, 0, len(dims)+1)
+	doc := map[string]interface{}{name: value}
+	for k, v := range dims {
+		keys = append(keys, k)
+		doc[k] = v
+	}
+	if env := environment(); env != "" {
+		keys = append(keys, "Environment")
+		doc["Environment"] = env
+	}
+	doc["_aws"] = map[string]interface{}{
+		"Timestamp": time.Now().UnixMilli(),
+		"CloudWatchMetrics": []map[string]interface{}{{
+			"Namespace":  metricNamespace,
+			"Dimensions": [][]string{keys},
+			"Metrics":    []map[string]string{{"Name": name, "Unit": "Count"}},
+		}},
+	}
+	line, err := json.Marshal(doc)
+	if err != nil {
+		return
+	}
+	fmt.Println(string(line))
+}
+
+// statMetrics maps snapshot fields to the metric names published per refresh.
+var statMetrics = []struct{ field, metric string }{
+	{"User_Global_Rank", "GlobalRank"},
+	{"Local_Rank", "LocalRank"},
+	{"User_Owns", "UserOwns"},
+	{"System_Owns", "SystemOwns"},
+	{"Challenge_Owns", "ChallengeOwns"},
+	{"Points", "Points"},
+}
+
+// emitStatMetrics publishes the refreshed stats as custom metrics with a User
+// dimension, unless STAT_METRICS=false.
+func emitStatMetrics(userID string, info map[string]interface{}) {
+	if os.Getenv("STAT_METRICS") == "false" {
+		return
+	}
+	for _, m := range statMetrics {
+		if v, ok := toFloat(info[m.field]); ok {
+			emitMetric(m.metric, v, map[string]string{"User": userID})
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"log/slog"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// milestoneField is the Change.Field used for round‑number achievements.
+const milestoneField = "Milestone"
+
+// defaultMilestones maps each stat to the step at which it is celebrated.
+// Override with MILESTONES (inline JSON/YAML) or MILESTONES_FILE.
+var defaultMilestones = map[string]float64{
+	"User_Owns":      100,
+	"System_Owns":    50,
+	"Challenge_Owns": 50,
+	"System_Bloods":  10,
+	"User_Bloods":    10,
+	"Season_Points":  1000,
+}
+
+var (
+	milestonesMutex  sync.Mutex
+	milestonesSource *string
+	milestoneSteps   map[string]float64
+)
+
+func loadMilestones() map[string]float64 {
+	milestonesMutex.Lock()
+	defer milestonesMutex.Unlock()
+	if src := settingSource("MILESTONES"); milestonesSource == nil || *milestonesSource != src {
+		milestonesSource, milestoneSteps = &src, defaultMilestones
+		var custom map[string]float64
+		if err := loadYAMLSetting("MILESTONES", &custom); err != nil {
+			slog.Error("loading milestones failed", "error", err)
+		} else if custom != nil {
+			milestoneSteps = custom
+		}
+	}
+	return milestoneSteps
+}
+
+// detectMilestones returns one milestone Change for every step a stat passed
+// between prev and curr, e.g. "100th user own". Season points only count
+// within the same season.
+func detectMilestones(prev, curr map[string]interface{}) []Change {
+	steps := loadMilestones()
+	fields := make([]string, 0, len(steps))
+	for field := range steps {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	var changes []Change
+	for _, field := range fields {
+		step := steps[field]
+		if step <= 0 {
+			continue
+		}
+		if field == "Season_Points" && !sameValue(prev["Season_ID"], curr["Season_ID"]) {
+			continue
+		}
+		oldV, okOld := toFloat(prev[field])
+		newV, okNew := toFloat(curr[field])
+		if !okOld || !okNew || newV <= oldV {
+			continue
+		}
+		for m := (math.Floor(oldV/step) + 1) * step; m <= newV; m += step {
+			changes = append(changes, Change{
+				Field:  milestoneField,
+				New:    m,
+				Detail: milestoneText(field, int(m)),
+			})
+		}
+	}
+	return changes
+}
+
+// milestoneText reads "100th user own" for countable stats and
+// "1000 season points" for everything else, in the notification locale.
+func milestoneText(field string, n int) string {
+	locale := notifyLocale()
+	if noun := translate(locale, "noun."+field); noun != "noun."+field {
+		return ordinal(locale, n) + " " + noun
+	}
+	label := fieldLabel(locale, field)
+	if locale != "de" {
+		// German keeps its nouns capitalised
+		label = strings.ToLower(label)
+	}
+	return strconv.Itoa(n) + " " + label
+}
+
+// ordinal renders 1 → "1st", 22 → "22nd", 113 → "113th" in English, and the
+// numeric ordinal forms of the other locales ("100.", "100e", "100.º").
+func ordinal(locale string, n int) string {
+	switch locale {
+	case "de":
+		return strconv.Itoa(n) + "."
+	case "fr":
+		if n == 1 {
+			return "1er"
+		}
+		return strconv.Itoa(n) + "e"
+	case "es":
+		return strconv.Itoa(n) + ".º"
+	}
+	suffix := "th"
+	switch n % 100 {
+	case 11, 12, 13:
+	default:
+		switch n % 10 {
+		case 1:
+			suffix = "st"
+		case 2:
+			suffix = "nd"
+		case 3:
+			suffix = "rd"
+		}
+	}
+	return strconv.Itoa(n) + suffix
+}
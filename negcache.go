@@ -0,0 +1,55 @@
+package main
+
+import (
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// failedField marks the item written for a day whose fetch failed: until
+// that Unix time, requests answer with the failure instead of calling HTB
+// again; after it the day is fetched anew. expires_at, set to the same time,
+// lets DynamoDB TTL remove the marker.
+const failedField = "failed_until"
+
+// failureTTL is how long a failed fetch is remembered, from FAILURE_TTL
+// (default 15m).
+func failureTTL() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("FAILURE_TTL")); err == nil && d > 0 {
+		return d
+	}
+	return 15 * time.Minute
+}
+
+// failureMarker is the item stored under key after a failed fetch.
+func failureMarker(key string) map[string]types.AttributeValue {
+	until := &types.AttributeValueMemberN{Value: strconv.FormatInt(time.Now().Add(failureTTL()).Unix(), 10)}
+	return map[string]types.AttributeValue{
+		"date":       &types.AttributeValueMemberS{Value: key},
+		failedField:  until,
+		"expires_at": until,
+	}
+}
+
+// failedUntil reports until when item, a failure marker, holds off new
+// fetches; ok is false for any other item and for a lapsed marker.
+func failedUntil(item map[string]interface{}) (until time.Time, ok bool) {
+	n, isMarker := toFloat(item[failedField])
+	if !isMarker {
+		return time.Time{}, false
+	}
+	until = time.Unix(int64(n), 0)
+	return until, time.Now().Before(until)
+}
+
+// stripFailure drops the marker fields from item, so that to everything
+// but statsHandler a failure marker reads as a day without stats.
+func stripFailure(item map[string]interface{}) map[string]interface{} {
+	if _, isMarker := item[failedField]; isMarker {
+		delete(item, failedField)
+		delete(item, "expires_at")
+	}
+	return item
+}
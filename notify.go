@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// Notifier delivers a set of detected changes to an external channel.
+type Notifier interface {
+	Name() string
+	Notify(ctx context.Context, changes []Change) error
+}
+
+var notifyClient = &http.Client{Timeout: 10 * time.Second}
+
+// configuredNotifiers returns every notifier enabled through the environment.
+func configuredNotifiers() []Notifier {
+	var notifiers []Notifier
+	if n := slackNotifierFromEnv(); n != nil {
+		notifiers = append(notifiers, n)
+	}
+	if n := telegramNotifierFromEnv(); n != nil {
+		notifiers = append(notifiers, n)
+	}
+	if n := snsNotifierFromEnv(); n != nil {
+		notifiers = append(notifiers, n)
+	}
+	if n := ntfyNotifierFromEnv(); n != nil {
+		notifiers = append(notifiers, n)
+	}
+	if n := pushoverNotifierFromEnv(); n != nil {
+		notifiers = append(notifiers, n)
+	}
+	if n := webhookNotifierFromEnv(); n != nil {
+		notifiers = append(notifiers, n)
+	}
+	if n := eventBridgeNotifierFromEnv(); n != nil {
+		notifiers = append(notifiers, n)
+	}
+	if n := pagerDutyNotifierFromEnv(); n != nil {
+		notifiers = append(notifiers, n)
+	}
+	if n := opsgenieNotifierFromEnv(); n != nil {
+		notifiers = append(notifiers, n)
+	}
+	if n := emailNotifierFromEnv(); n != nil {
+		notifiers = append(notifiers, n)
+	}
+	return notifiers
+}
+
+// snapshotChanges derives the notifications for userID’s fresh snapshot
+// from prev, one group per message: anomaly notices, bloods as their own
+// high‑priority alert, then the remaining stat changes, then dedicated
+// messages for newly earned badges and milestones. Changes are tagged with
+// the user when several users are tracked.
+func snapshotChanges(userID string, prev, curr map[string]interface{}) [][]Change {
+	tag := func(changes []Change) []Change {
+		if len(configuredUsers()) > 1 {
+			for i := range changes {
+				changes[i].User = userID
+			}
+		}
+		return changes
+	}
+	changes, anomalies := withoutAnomalies(detectChanges(prev, curr), detectAnomalies(prev, curr))
+	bloods, rest := splitBloods(changes)
+	rest = append(annotateOvertakes(rest, prev, curr), detectSeasonChanges(prev, curr)...)
+	rest = append(rest, detectIdentityChanges(prev, curr)...)
+	return [][]Change{
+		tag(anomalies),
+		tag(annotateBloods(bloods, prev, curr)),
+		tag(rest),
+		tag(detectNewBadges(prev, curr)),
+		tag(detectMilestones(prev, curr)),
+	}
+}
+
+// notifySnapshot sends the groups of changes derived by snapshotChanges.
+func notifySnapshot(ctx context.Context, groups [][]Change) {
+	for _, changes := range groups {
+		notifyChanges(ctx, changes)
+	}
+}
+
+// notifyChanges fans the changes that pass the notification rules out to the
+// configured notifiers they are routed to. Delivery failures are logged but never fail the
+// invocation.
+func notifyChanges(ctx context.Context, changes []Change) {
+	changes = filterChanges(changes, loadRules())
+	if len(changes) == 0 {
+		return
+	}
+	if b := batchFrom(ctx); b != nil {
+		b.add(changes)
+		return
+	}
+	sendChanges(ctx, changes)
+}
+
+// sendChanges delivers already filtered changes to their routed channels.
+func sendChanges(ctx context.Context, changes []Change) {
+	if len(changes) == 0 {
+		return
+	}
+	for _, n := range configuredNotifiers() {
+		routedChanges := routeChanges(changes, n.Name())
+		if len(routedChanges) == 0 {
+			continue
+		}
+		if err := deliver(ctx, n, routedChanges); err != nil {
+			slog.ErrorContext(ctx, "notification failed", "channel", n.Name(), "error", err)
+		}
+	}
+}
+
+// statusError reports a non‑2xx response from a notification endpoint.
+type statusError struct {
+	code int
+}
+
+func (e *statusError) Error() string { return fmt.Sprintf("unexpected status %d", e.code) }
+
+// oneOffHeadlines are the message keys titling a message made up only of one
+// kind of one‑off change.
+var oneOffHeadlines = map[string]string{
+	tokenField:         "headline.token",
+	tokenExpiringField: "headline.expiring",
+	failureField:       "headline.failure",
+	badgeField:         "headline.badge",
+	milestoneField:     "headline.milestone",
+	goalField:          "headline.goal",
+	anomalyField:       "headline.anomaly",
+}
+
+// headline is the title used by the human‑readable notifiers.
+func headline(changes []Change) string {
+	stats := tr("headline.stats")
+	if len(changes) == 0 {
+		return stats
+	}
+	first := changes[0].Field
+	if isNotice(changes[0]) {
+		return tr(oneOffHeadlines[first])
+	}
+	if highPriority(changes) {
+		return tr("headline.blood")
+	}
+	for _, c := range changes {
+		if c.Field != first {
+			return stats
+		}
+	}
+	if h, ok := oneOffHeadlines[first]; ok {
+		return tr(h)
+	}
+	return stats
+}
+
+// postJSON sends payload as a JSON POST and, if target is non‑nil, decodes the
+// response body into it.
+func postJSON(ctx context.Context, url string, headers map[string]string, payload, target interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return postBody(ctx, url, headers, body, target)
+}
+
+// postBody is postJSON for callers that need the exact bytes sent, e.g. to
+// sign them.
+func postBody(ctx context.Context, url string, headers map[string]string, body []byte, target interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := notifyClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &statusError{code: resp.StatusCode}
+	}
+	if target != nil {
+		return json.NewDecoder(resp.Body).Decode(target)
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	ebtypes "github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+)
+
+// EventBridge source and detail types emitted by this service.
+const (
+	eventSource       = "htb.rankings"
+	eventRankChanged  = "htb.rank.changed"
+	eventStatsChanged = "htb.stats.changed"
+	eventBadgeEarned  = "htb.badge.earned"
+	eventMilestone    = "htb.milestone.reached"
+	eventGoal         = "htb.goal.reached"
+	eventFetchFailed  = "htb.fetch.failed"
+	eventTokenInvalid = "htb.token.invalid"
+	eventTokenExpiry  = "htb.token.expiring"
+	eventAnomaly      = "htb.anomaly.detected"
+)
+
+// maxEventBridgeBatch is the PutEvents entry limit.
+const maxEventBridgeBatch = 10
+
+// eventBridgeNotifier publishes typed change events to a custom bus so users
+// can attach their own rules and targets.
+type eventBridgeNotifier struct {
+	client  *eventbridge.Client
+	busName string
+}
+
+// eventBridgeNotifierFromEnv returns a notifier when EVENT_BUS_NAME is set.
+func eventBridgeNotifierFromEnv() Notifier {
+	busName := os.Getenv("EVENT_BUS_NAME")
+	if busName == "" {
+		return nil
+	}
+	return &eventBridgeNotifier{client: eventbridge.NewFromConfig(awsCfg), busName: busName}
+}
+
+func (n *eventBridgeNotifier) Name() string { return "eventbridge" }
+
+func (n *eventBridgeNotifier) Notify(ctx context.Context, changes []Change) error {
+	var entries []ebtypes.PutEventsRequestEntry
+	for _, ev := range changeEvents(changes) {
+		if ev.Field == failureField || ev.Field == tokenField || ev.Field == tokenExpiringField {
+			detailType := eventFetchFailed
+			switch ev.Field {
+			case tokenField:
+				detailType = eventTokenInvalid
+			case tokenExpiringField:
+				detailType = eventTokenExpiry
+			}
+			entry, err := n.entry(detailType, map[string]interface{}{
+				"user":      ev.User,
+				"error":     ev.Detail,
+				"timestamp": ev.Timestamp,
+			})
+			if err != nil {
+				return err
+			}
+			entries = append(entries, entry)
+			continue
+		}
+		detailType := eventStatsChanged
+		switch {
+		case rankFields[ev.Field]:
+			detailType = eventRankChanged
+		case ev.Field == badgeField:
+			detailType = eventBadgeEarned
+		case ev.Field == milestoneField:
+			detailType = eventMilestone
+		case ev.Field == goalField:
+			detailType = eventGoal
+		case ev.Field == anomalyField:
+			detailType = eventAnomaly
+		}
+		entry, err := n.entry(detailType, ev)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, entry)
+	}
+	// one entry per change, so a rejected entry’s index is its change’s
+	failed, err := n.put(ctx, entries)
+	if err != nil && len(failed) < len(changes) {
+		undelivered := make([]Change, 0, len(failed))
+		for _, i := range failed {
+			undelivered = append(undelivered, changes[i])
+		}
+		return &undeliveredError{changes: undelivered, err: err}
+	}
+	return err
+}
+
+// Check confirms the bus exists and is visible to the execution role.
+func (n *eventBridgeNotifier) Check(ctx context.Context) error {
+	_, err := n.client.DescribeEventBus(ctx, &eventbridge.DescribeEventBusInput{Name: aws.String(n.busName)})
+	return err
+}
+
+func (n *eventBridgeNotifier) entry(detailType string, detail interface{}) (ebtypes.PutEventsRequestEntry, error) {
+	body, err := json.Marshal(detail)
+	if err != nil {
+		return ebtypes.PutEventsRequestEntry{}, err
+	}
+	return ebtypes.PutEventsRequestEntry{
+		EventBusName: aws.String(n.busName),
+		Source:       aws.String(eventSource),
+		DetailType:   aws.String(detailType),
+		Detail:       aws.String(string(body)),
+	}, nil
+}
+
+// put sends entries in chunks of maxEventBridgeBatch. When some are
+// rejected, or a chunk’s call fails, it carries on with the other chunks and
+// returns the indices of the entries that didn’t go out with the error, so
+// only those are sent again.
+func (n *eventBridgeNotifier) put(ctx context.Context, entries []ebtypes.PutEventsRequestEntry) (failed []int, err error) {
+	for start := 0; start < len(entries); start += maxEventBridgeBatch {
+		end := min(start+maxEventBridgeBatch, len(entries))
+		resp, putErr := n.client.PutEvents(ctx, &eventbridge.PutEventsInput{Entries: entries[start:end]})
+		if putErr != nil {
+			for i := start; i < end; i++ {
+				failed = append(failed, i)
+			}
+			err = putErr
+			continue
+		}
+		if resp.FailedEntryCount > 0 {
+			for i, e := range resp.Entries {
+				if e.ErrorCode != nil {
+					failed = append(failed, start+i)
+				}
+			}
+		}
+	}
+	if len(failed) > 0 && err == nil {
+		err = fmt.Errorf("%d of %d events rejected", len(failed), len(entries))
+	}
+	return failed, err
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"html"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/sesv2"
+)
+
+// pagerDutyNotifier triggers incidents through the PagerDuty Events API v2.
+type pagerDutyNotifier struct {
+	routingKey string
+}
+
+// pagerDutyNotifierFromEnv returns a notifier when PAGERDUTY_ROUTING_KEY is set.
+func pagerDutyNotifierFromEnv() Notifier {
+	key := os.Getenv("PAGERDUTY_ROUTING_KEY")
+	if key == "" {
+		return nil
+	}
+	return &pagerDutyNotifier{routingKey: key}
+}
+
+func (n *pagerDutyNotifier) Name() string { return "pagerduty" }
+
+func (n *pagerDutyNotifier) Notify(ctx context.Context, changes []Change) error {
+	severity := "info"
+	if len(changes) > 0 && isNotice(changes[0]) {
+		severity = "critical"
+	}
+	text, err := messageText(ctx, n.Name(), changes)
+	if err != nil {
+		return err
+	}
+	return postJSON(ctx, "https://events.pagerduty.com/v2/enqueue", nil, map[string]interface{}{
+		"routing_key":  n.routingKey,
+		"event_action": "trigger",
+		// one open incident per kind of problem rather than one per refresh
+		"dedup_key": "htb-rankings/" + changes[0].Field,
+		"payload": map[string]interface{}{
+			"summary":        headline(changes),
+			"source":         "htb-rankings",
+			"severity":       severity,
+			"custom_details": map[string]interface{}{"changes": text},
+		},
+	}, nil)
+}
+
+// opsgenieNotifier creates Opsgenie alerts.
+type opsgenieNotifier struct {
+	apiKey string
+	apiURL string
+}
+
+// opsgenieNotifierFromEnv returns a notifier when OPSGENIE_API_KEY is set.
+// OPSGENIE_API_URL selects the EU instance (https://api.eu.opsgenie.com).
+func opsgenieNotifierFromEnv() Notifier {
+	n := &opsgenieNotifier{
+		apiKey: os.Getenv("OPSGENIE_API_KEY"),
+		apiURL: strings.TrimRight(os.Getenv("OPSGENIE_API_URL"), "/"),
+	}
+	if n.apiKey == "" {
+		return nil
+	}
+	if n.apiURL == "" {
+		n.apiURL = "https://api.opsgenie.com"
+	}
+	return n
+}
+
+func (n *opsgenieNotifier) Name() string { return "opsgenie" }
+
+func (n *opsgenieNotifier) Notify(ctx context.Context, changes []Change) error {
+	priority := "P5"
+	if len(changes) > 0 && isNotice(changes[0]) {
+		priority = "P2"
+	}
+	text, err := messageText(ctx, n.Name(), changes)
+	if err != nil {
+		return err
+	}
+	headers := map[string]string{"Authorization": "GenieKey " + n.apiKey}
+	return postJSON(ctx, n.apiURL+"/v2/alerts", headers, map[string]interface{}{
+		"message":     headline(changes),
+		"description": text,
+		"alias":       "htb-rankings/" + changes[0].Field,
+		"priority":    priority,
+		"source":      "htb-rankings",
+	}, nil)
+}
+
+// emailNotifier sends plain alert emails through SES to ALERT_EMAIL_TO. As an
+// operator channel it only receives kinds explicitly routed to "email".
+type emailNotifier struct {
+	from string
+	to   []string
+}
+
+// emailNotifierFromEnv returns a notifier when ALERT_EMAIL_TO is set. The
+// sender is ALERT_EMAIL_FROM, falling back to DIGEST_FROM.
+func emailNotifierFromEnv() Notifier {
+	n := &emailNotifier{
+		from: os.Getenv("ALERT_EMAIL_FROM"),
+		to:   splitList(os.Getenv("ALERT_EMAIL_TO")),
+	}
+	if n.from == "" {
+		n.from = os.Getenv("DIGEST_FROM")
+	}
+	if n.from == "" || len(n.to) == 0 {
+		return nil
+	}
+	return n
+}
+
+func (n *emailNotifier) Name() string { return "email" }
+
+func (n *emailNotifier) Notify(ctx context.Context, changes []Change) error {
+	body, ok, err := renderTemplate(ctx, n.Name(), changes)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		body = "<p>" + strings.ReplaceAll(html.EscapeString(plainSummary(changes)), "\n", "<br>") + "</p>"
+	}
+	return sendEmail(ctx, n.from, n.to, headline(changes), body)
+}
+
+// Check confirms the role can reach SES and sending isn’t paused for the
+// account.
+func (n *emailNotifier) Check(ctx context.Context) error {
+	account, err := sesv2.NewFromConfig(awsCfg).GetAccount(ctx, &sesv2.GetAccountInput{})
+	if err != nil {
+		return err
+	}
+	if !account.SendingEnabled {
+		return errors.New("SES sending is disabled for this account")
+	}
+	return nil
+}
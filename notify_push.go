@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// plainSummary renders the changes as one line each, for plain‑text channels.
+func plainSummary(changes []Change) string {
+	lines := make([]string, 0, len(changes))
+	for _, c := range changes {
+		lines = append(lines, c.Summary())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// firstImage returns the first badge artwork URL among the changes, if any.
+func firstImage(changes []Change) string {
+	for _, c := range changes {
+		if c.Image != "" {
+			return c.Image
+		}
+	}
+	return ""
+}
+
+// ntfyNotifier publishes to an ntfy topic, on ntfy.sh or a self‑hosted server.
+type ntfyNotifier struct {
+	server string
+	topic  string
+	token  string
+}
+
+// ntfyNotifierFromEnv returns a notifier when NTFY_TOPIC is set. NTFY_SERVER
+// defaults to https://ntfy.sh; NTFY_TOKEN is only needed for protected topics.
+func ntfyNotifierFromEnv() Notifier {
+	n := &ntfyNotifier{
+		server: strings.TrimRight(os.Getenv("NTFY_SERVER"), "/"),
+		topic:  os.Getenv("NTFY_TOPIC"),
+		token:  os.Getenv("NTFY_TOKEN"),
+	}
+	if n.topic == "" {
+		return nil
+	}
+	if n.server == "" {
+		n.server = "https://ntfy.sh"
+	}
+	return n
+}
+
+func (n *ntfyNotifier) Name() string { return "ntfy" }
+
+func (n *ntfyNotifier) Notify(ctx context.Context, changes []Change) error {
+	msg, err := messageText(ctx, n.Name(), changes)
+	if err != nil {
+		return err
+	}
+	var headers map[string]string
+	if n.token != "" {
+		headers = map[string]string{"Authorization": "Bearer " + n.token}
+	}
+	// JSON publishing goes to the server root with the topic in the body
+	payload := map[string]interface{}{
+		"topic":   n.topic,
+		"title":   headline(changes),
+		"message": msg,
+		"tags":    []string{"chart_with_upwards_trend"},
+	}
+	if highPriority(changes) {
+		payload["priority"] = 5
+		payload["tags"] = []string{"drop_of_blood"}
+	}
+	if img := firstImage(changes); img != "" {
+		payload["attach"] = img
+	}
+	return postJSON(ctx, n.server, headers, payload, nil)
+}
+
+// Check asks the server’s health endpoint whether it is up.
+func (n *ntfyNotifier) Check(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, n.server+"/v1/health", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := notifyClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return &statusError{code: resp.StatusCode}
+	}
+	return nil
+}
+
+// pushoverNotifier sends messages through the Pushover API.
+type pushoverNotifier struct {
+	appToken string
+	userKey  string
+}
+
+// pushoverNotifierFromEnv returns a notifier when both PUSHOVER_TOKEN and
+// PUSHOVER_USER are set.
+func pushoverNotifierFromEnv() Notifier {
+	n := &pushoverNotifier{
+		appToken: os.Getenv("PUSHOVER_TOKEN"),
+		userKey:  os.Getenv("PUSHOVER_USER"),
+	}
+	if n.appToken == "" || n.userKey == "" {
+		return nil
+	}
+	return n
+}
+
+func (n *pushoverNotifier) Name() string { return "pushover" }
+
+func (n *pushoverNotifier) Notify(ctx context.Context, changes []Change) error {
+	msg, err := messageText(ctx, n.Name(), changes)
+	if err != nil {
+		return err
+	}
+	payload := map[string]interface{}{
+		"token":   n.appToken,
+		"user":    n.userKey,
+		"title":   headline(changes),
+		"message": msg,
+	}
+	if img := firstImage(changes); img != "" {
+		payload["url"] = img
+	}
+	if highPriority(changes) {
+		payload["priority"] = 1
+	}
+	return postJSON(ctx, "https://api.pushover.net/1/messages.json", nil, payload, nil)
+}
+
+// Check validates the app token and user key without sending a message.
+func (n *pushoverNotifier) Check(ctx context.Context) error {
+	return postJSON(ctx, "https://api.pushover.net/1/users/validate.json", nil, map[string]string{
+		"token": n.appToken,
+		"user":  n.userKey,
+	}, nil)
+}
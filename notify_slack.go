@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+)
+
+// slackNotifier posts change summaries to Slack, either through an incoming
+// webhook or through chat.postMessage with a bot token.
+type slackNotifier struct {
+	webhookURL string
+	botToken   string
+	channel    string
+}
+
+// slackNotifierFromEnv returns a notifier when SLACK_WEBHOOK_URL, or both
+// SLACK_BOT_TOKEN and SLACK_CHANNEL, are set.
+func slackNotifierFromEnv() Notifier {
+	n := &slackNotifier{
+		webhookURL: os.Getenv("SLACK_WEBHOOK_URL"),
+		botToken:   os.Getenv("SLACK_BOT_TOKEN"),
+		channel:    os.Getenv("SLACK_CHANNEL"),
+	}
+	if n.webhookURL == "" && (n.botToken == "" || n.channel == "") {
+		return nil
+	}
+	return n
+}
+
+func (n *slackNotifier) Name() string { return "slack" }
+
+func (n *slackNotifier) Notify(ctx context.Context, changes []Change) error {
+	msg := map[string]interface{}{
+		"text":   headline(changes),
+		"blocks": slackBlocks(changes),
+	}
+	if text, ok, err := renderTemplate(ctx, n.Name(), changes); err != nil {
+		return err
+	} else if ok {
+		// a custom template replaces the Block Kit layout with plain mrkdwn
+		msg = map[string]interface{}{"text": text}
+	}
+
+	if n.webhookURL != "" {
+		return postJSON(ctx, n.webhookURL, nil, msg, nil)
+	}
+
+	// bot token → Web API, which reports failures in the body with a 200
+	msg["channel"] = n.channel
+	var resp struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error"`
+	}
+	headers := map[string]string{"Authorization": "Bearer " + n.botToken}
+	if err := postJSON(ctx, "https://slack.com/api/chat.postMessage", headers, msg, &resp); err != nil {
+		return err
+	}
+	if !resp.OK {
+		return errors.New("slack API error: " + resp.Error)
+	}
+	return nil
+}
+
+// Check verifies the bot token with auth.test; incoming webhooks can only be
+// tested by posting.
+func (n *slackNotifier) Check(ctx context.Context) error {
+	if n.webhookURL != "" {
+		return errNotCheckable
+	}
+	var resp struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error"`
+	}
+	headers := map[string]string{"Authorization": "Bearer " + n.botToken}
+	if err := postJSON(ctx, "https://slack.com/api/auth.test", headers, map[string]string{}, &resp); err != nil {
+		return err
+	}
+	if !resp.OK {
+		return errors.New("slack API error: " + resp.Error)
+	}
+	return nil
+}
+
+// slackBlocks renders the changes as Block Kit: a header, one two‑column
+// section per batch of up to 10 fields (Slack's limit), and a date footer.
+func slackBlocks(changes []Change) []map[string]interface{} {
+	blocks := []map[string]interface{}{{
+		"type": "header",
+		"text": map[string]interface{}{"type": "plain_text", "text": headline(changes)},
+	}}
+
+	var fields []map[string]interface{}
+	for _, c := range changes {
+		switch c.Field {
+		case badgeField:
+			// badges get their own section so the artwork can be shown
+			blocks = append(blocks, slackBadgeBlock(c))
+			continue
+		case failureField, tokenField, tokenExpiringField, milestoneField, goalField, anomalyField:
+			blocks = append(blocks, map[string]interface{}{
+				"type": "section",
+				"text": map[string]interface{}{"type": "mrkdwn", "text": c.Summary()},
+			})
+			continue
+		}
+		fields = append(fields, map[string]interface{}{
+			"type": "mrkdwn",
+			"text": "*" + slackLabel(c) + "*\n" + formatValue(c.Old) + " → " + formatValue(c.New) + " " + c.Arrow(),
+		})
+	}
+	for len(fields) > 0 {
+		end := len(fields)
+		if end > 10 {
+			end = 10
+		}
+		blocks = append(blocks, map[string]interface{}{"type": "section", "fields": fields[:end]})
+		fields = fields[end:]
+	}
+
+	blocks = append(blocks, map[string]interface{}{
+		"type": "context",
+		"elements": []map[string]interface{}{
+			{"type": "mrkdwn", "text": tr("snapshot_for", currentDate())},
+		},
+	})
+	return blocks
+}
+
+func slackBadgeBlock(c Change) map[string]interface{} {
+	block := map[string]interface{}{
+		"type": "section",
+		"text": map[string]interface{}{"type": "mrkdwn", "text": "*" + slackLabel(c) + "*\n" + formatValue(c.New)},
+	}
+	if c.Image != "" {
+		block["accessory"] = map[string]interface{}{
+			"type":      "image",
+			"image_url": c.Image,
+			"alt_text":  formatValue(c.New),
+		}
+	}
+	return block
+}
+
+// slackLabel prefixes the field label with the user in combined batches.
+func slackLabel(c Change) string {
+	if c.User != "" {
+		return c.User + " · " + c.Label()
+	}
+	return c.Label()
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	snstypes "github.com/aws/aws-sdk-go-v2/service/sns/types"
+)
+
+// snsNotifier publishes one structured ChangeEvent per changed field to an
+// SNS topic so other services can subscribe without touching this one.
+type snsNotifier struct {
+	client   *sns.Client
+	topicARN string
+}
+
+// snsNotifierFromEnv returns a notifier when SNS_TOPIC_ARN is set.
+func snsNotifierFromEnv() Notifier {
+	topicARN := os.Getenv("SNS_TOPIC_ARN")
+	if topicARN == "" {
+		return nil
+	}
+	return &snsNotifier{client: sns.NewFromConfig(awsCfg), topicARN: topicARN}
+}
+
+func (n *snsNotifier) Name() string { return "sns" }
+
+func (n *snsNotifier) Notify(ctx context.Context, changes []Change) error {
+	for _, ev := range changeEvents(changes) {
+		body, err := json.Marshal(ev)
+		if err != nil {
+			return err
+		}
+		// field/user attributes let subscribers use SNS filter policies
+		if _, err := n.client.Publish(ctx, &sns.PublishInput{
+			TopicArn: aws.String(n.topicARN),
+			Message:  aws.String(string(body)),
+			MessageAttributes: map[string]snstypes.MessageAttributeValue{
+				"field":          {DataType: aws.String("String"), StringValue: aws.String(ev.Field)},
+				"user":           {DataType: aws.String("String"), StringValue: aws.String(ev.User)},
+				"schema_version": {DataType: aws.String("String"), StringValue: aws.String(ev.SchemaVersion)},
+			},
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Check confirms the topic exists and is visible to the execution role.
+func (n *snsNotifier) Check(ctx context.Context) error {
+	_, err := n.client.GetTopicAttributes(ctx, &sns.GetTopicAttributesInput{TopicArn: aws.String(n.topicARN)})
+	return err
+}
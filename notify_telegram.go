@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"html"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// telegramNotifier sends change summaries to a chat through the Bot API.
+type telegramNotifier struct {
+	botToken   string
+	chatID     string
+	refreshURL string
+}
+
+// telegramNotifierFromEnv returns a notifier when both TELEGRAM_BOT_TOKEN and
+// TELEGRAM_CHAT_ID are set. REFRESH_URL, if present, adds a refresh button.
+func telegramNotifierFromEnv() Notifier {
+	n := &telegramNotifier{
+		botToken:   os.Getenv("TELEGRAM_BOT_TOKEN"),
+		chatID:     os.Getenv("TELEGRAM_CHAT_ID"),
+		refreshURL: os.Getenv("REFRESH_URL"),
+	}
+	if n.botToken == "" || n.chatID == "" {
+		return nil
+	}
+	return n
+}
+
+func (n *telegramNotifier) Name() string { return "telegram" }
+
+func (n *telegramNotifier) Notify(ctx context.Context, changes []Change) error {
+	lines := []string{"<b>" + headline(changes) + "</b>"}
+	for _, c := range changes {
+		line := html.EscapeString(c.Summary())
+		if c.Image != "" {
+			line += ` <a href="` + html.EscapeString(c.Image) + `">🖼</a>`
+		}
+		lines = append(lines, line)
+	}
+	text := strings.Join(lines, "\n")
+	if custom, ok, err := renderTemplate(ctx, n.Name(), changes); err != nil {
+		return err
+	} else if ok {
+		text = custom
+	}
+	msg := map[string]interface{}{
+		"chat_id":    n.chatID,
+		"text":       text,
+		"parse_mode": "HTML",
+	}
+	if n.refreshURL != "" {
+		msg["reply_markup"] = map[string]interface{}{
+			"inline_keyboard": [][]map[string]string{{
+				{"text": "🔄 Refresh", "url": n.refreshURL},
+			}},
+		}
+	}
+
+	// the Bot API reports failures in the body as well as the status code
+	var resp struct {
+		OK          bool   `json:"ok"`
+		Description string `json:"description"`
+	}
+	endpoint := "https://api.telegram.org/bot" + n.botToken + "/sendMessage"
+	if err := postJSON(ctx, endpoint, nil, msg, &resp); err != nil {
+		// transport errors quote the URL, which embeds the bot token
+		var uerr *url.Error
+		if errors.As(err, &uerr) {
+			return uerr.Err
+		}
+		return err
+	}
+	if !resp.OK {
+		return errors.New("telegram API error: " + resp.Description)
+	}
+	return nil
+}
+
+// Check looks the chat up with getChat, which verifies both the bot token and
+// that the bot can reach TELEGRAM_CHAT_ID.
+func (n *telegramNotifier) Check(ctx context.Context) error {
+	var resp struct {
+		OK          bool   `json:"ok"`
+		Description string `json:"description"`
+	}
+	endpoint := "https://api.telegram.org/bot" + n.botToken + "/getChat"
+	if err := postJSON(ctx, endpoint, nil, map[string]string{"chat_id": n.chatID}, &resp); err != nil {
+		var uerr *url.Error
+		if errors.As(err, &uerr) {
+			return uerr.Err
+		}
+		return err
+	}
+	if !resp.OK {
+		return errors.New("telegram API error: " + resp.Description)
+	}
+	return nil
+}
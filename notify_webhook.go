@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+)
+
+// webhookNotifier POSTs the change events to an arbitrary URL, signed with
+// HMAC‑SHA256 so the receiver can verify they came from this deployment.
+type webhookNotifier struct {
+	url    string
+	secret string
+}
+
+// webhookNotifierFromEnv returns a notifier when WEBHOOK_URL is set.
+// WEBHOOK_SECRET is optional but strongly recommended.
+func webhookNotifierFromEnv() Notifier {
+	url := os.Getenv("WEBHOOK_URL")
+	if url == "" {
+		return nil
+	}
+	return &webhookNotifier{url: url, secret: os.Getenv("WEBHOOK_SECRET")}
+}
+
+func (n *webhookNotifier) Name() string { return "webhook" }
+
+func (n *webhookNotifier) Notify(ctx context.Context, changes []Change) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"schema_version": changeEventSchemaVersion,
+		"events":         changeEvents(changes),
+	})
+	if err != nil {
+		return err
+	}
+	headers := map[string]string{}
+	if n.secret != "" {
+		mac := hmac.New(sha256.New, []byte(n.secret))
+		mac.Write(body)
+		headers["X-HTB-Signature"] = "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	}
+
+	return postBody(ctx, n.url, headers, body, nil)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// localNeighbours is how many users ranked directly above the tracked user
+// are kept in each snapshot's Local_Above list.
+const localNeighbours = 10
+
+// annotateOvertakes explains a worsened Local_Rank by naming the users that
+// are above the tracked user today but weren’t yesterday, e.g.
+// "Country rank: 4 → 5 ▼ (in GB, overtaken by X)".
+//
+// After a change of country the ranks are in different leaderboards, so the
+// change is explained by the move instead.
+func annotateOvertakes(changes []Change, prev, curr map[string]interface{}) []Change {
+	if countryMoved(prev, curr) {
+		for i, c := range changes {
+			if c.Field == "Local_Rank" {
+				changes[i].Detail = tr("country_moved", prev["Country_Code"], curr["Country_Code"])
+			}
+		}
+		return changes
+	}
+	oldAbove, okOld := prev["Local_Above"].([]interface{})
+	newAbove, okNew := curr["Local_Above"].([]interface{})
+	if !okOld || !okNew {
+		return changes
+	}
+	seen := make(map[string]bool, len(oldAbove))
+	for _, n := range oldAbove {
+		seen[fmt.Sprint(n)] = true
+	}
+	var passers []string
+	for _, n := range newAbove {
+		if !seen[fmt.Sprint(n)] {
+			passers = append(passers, fmt.Sprint(n))
+		}
+	}
+
+	for i, c := range changes {
+		if c.Field != "Local_Rank" {
+			continue
+		}
+		if improved, ok := c.Improved(); !ok || improved || len(passers) == 0 {
+			continue
+		}
+		changes[i].Detail = tr("overtaken_by", strings.Join(passers, ", "))
+		if code, ok := curr["Country_Code"].(string); ok && code != "" {
+			changes[i].Detail = tr("overtaken_in", code, strings.Join(passers, ", "))
+		}
+	}
+	return changes
+}
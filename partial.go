@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// fetchStatusField maps each HTB call of a refresh to how it went: "ok",
+// "failed" (the country call also when the profile failed), "skipped" (turned
+// off) or "kept" — failed, with its fields carried over from the day’s
+// earlier snapshot.
+const fetchStatusField = "Fetch_Status"
+
+// partialField marks a snapshot missing some calls’ data (failed or kept);
+// from retryAtField, a Unix time, it is due to be fetched again.
+const (
+	partialField = "Partial"
+	retryAtField = "Retry_At"
+)
+
+// callFields lists the snapshot fields each HTB call supplies.
+var callFields = map[string][]string{
+	"profile": {"Name", "Country_Code", "System_Owns", "User_Owns", "System_Bloods", "User_Bloods", "Rank",
+		"User_Global_Rank", "Points", "Rank_Ownership", "Next_Rank", "Rank_Requirement", "Global_Percentile"},
+	"country":    {"Local_Rank", "Local_Above", "Country_Unavailable", "Country_Ranked_Users", "Country_Percentile"},
+	"challenges": {"Challenge_Owns", "Challenge_Categories"},
+	"badges":     {"Badges"},
+	"season":     {"Season_ID", "Season_Name", "Season_Start", "Season_Tier", "Season_Rank", "Season_Points", "Season_Machines"},
+	"bloods":     {"Recent_Bloods"},
+}
+
+// callStatus is "ok" for a nil err and "failed" otherwise.
+func callStatus(err error) string {
+	if err != nil {
+		return "failed"
+	}
+	return "ok"
+}
+
+// setFetchStatus stores status on info and marks info partial, due again
+// after FAILURE_TTL, when any call failed or was kept.
+func setFetchStatus(info map[string]interface{}, status map[string]interface{}) {
+	info[fetchStatusField] = status
+	delete(info, partialField)
+	delete(info, retryAtField)
+	for _, st := range status {
+		if st == "failed" || st == "kept" {
+			info[partialField] = true
+			info[retryAtField] = time.Now().Add(failureTTL()).Unix()
+			return
+		}
+	}
+}
+
+// fetchOK reports whether info holds fresh data from call; snapshots from
+// before Fetch_Status was recorded count as complete.
+func fetchOK(info map[string]interface{}, call string) bool {
+	status, ok := info[fetchStatusField].(map[string]interface{})
+	return !ok || status[call] == "ok"
+}
+
+// mergePartial fills the fields of calls that failed in info from existing,
+// the day’s earlier snapshot, when that one has them, so a retry only ever
+// adds data. The carried calls are marked "kept".
+func mergePartial(existing, info map[string]interface{}) {
+	status, ok := info[fetchStatusField].(map[string]interface{})
+	if !ok || info[partialField] != true || len(existing) <= 1 {
+		return
+	}
+	before, _ := existing[fetchStatusField].(map[string]interface{})
+	for call, st := range status {
+		if st != "failed" || before[call] == "failed" || before[call] == "skipped" {
+			continue
+		}
+		if call == "country" && countryMoved(existing, info) {
+			// the earlier rank is in the old country’s leaderboard
+			continue
+		}
+		has := false
+		for _, f := range callFields[call] {
+			_, ok := existing[f]
+			has = has || ok && f != "Country_Unavailable"
+		}
+		if !has {
+			continue
+		}
+		for _, f := range callFields[call] {
+			delete(info, f)
+			if v, ok := existing[f]; ok {
+				info[f] = v
+			}
+		}
+		status[call] = "kept"
+	}
+	setFetchStatus(info, status)
+}
+
+// partialDue reports whether item is a partial snapshot whose retry time
+// has come.
+func partialDue(item map[string]interface{}) bool {
+	if item[partialField] != true {
+		return false
+	}
+	at, ok := toFloat(item[retryAtField])
+	return !ok || time.Now().Unix() >= int64(at)
+}
+
+// refreshDue reports whether a stored snapshot should be fetched again: a
+// new REFRESH_INTERVAL slot has begun, or it is partial and due a retry.
+func refreshDue(item map[string]interface{}) bool {
+	return intradayDue(item) || partialDue(item)
+}
+
+// deadlineReserve is the part of the invocation’s time kept back from HTB
+// calls, to store what was fetched, queue the rest and notify.
+const deadlineReserve = 5 * time.Second
+
+// fetchContext bounds a refresh’s HTB calls to end deadlineReserve before
+// ctx’s deadline, so calls still running then are cancelled and the ones
+// done are kept as a partial snapshot instead of being lost to the timeout.
+func fetchContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return context.WithCancel(ctx)
+	}
+	return context.WithDeadline(ctx, deadline.Add(-deadlineReserve))
+}
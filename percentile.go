@@ -0,0 +1,41 @@
+package main
+
+import (
+	"math"
+	"os"
+	"strconv"
+)
+
+// topPercent returns the share of ranked users at or above rank, rounded to
+// two decimals below 1% and one decimal above, e.g. 812 of 100000 → 0.81.
+func topPercent(rank, total float64) (float64, bool) {
+	if rank <= 0 || total <= 0 || rank > total {
+		return 0, false
+	}
+	p := rank / total * 100
+	if p < 1 {
+		return math.Round(p*100) / 100, true
+	}
+	return math.Round(p*10) / 10, true
+}
+
+// addPercentiles sets Global_Percentile and Country_Percentile ("top x%")
+// on info. The country total is the size of the country ranking; HTB has no
+// endpoint for the global total, so it is read from RANKED_USERS.
+func addPercentiles(info map[string]interface{}, countryTotal int) {
+	if countryTotal > 0 {
+		info["Country_Ranked_Users"] = countryTotal
+		if rank, ok := toFloat(info["Local_Rank"]); ok {
+			if p, ok := topPercent(rank, float64(countryTotal)); ok {
+				info["Country_Percentile"] = p
+			}
+		}
+	}
+	if total, err := strconv.Atoi(os.Getenv("RANKED_USERS")); err == nil && total > 0 {
+		if rank, ok := toFloat(info["User_Global_Rank"]); ok {
+			if p, ok := topPercent(rank, float64(total)); ok {
+				info["Global_Percentile"] = p
+			}
+		}
+	}
+}
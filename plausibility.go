@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// implausibleError rejects a fetch whose data can’t be right — a rank of 0,
+// owns down by hundreds, a profile without a rank — so it isn’t stored as the
+// day’s stats.
+type implausibleError struct {
+	problems []string
+}
+
+func (e *implausibleError) Error() string {
+	return "implausible HTB data: " + strings.Join(e.problems, "; ")
+}
+
+// plausibleDrop is how far a count (owns, bloods, challenges) may fall from
+// the previous snapshot before the fetch is rejected, from PLAUSIBLE_MAX_DROP
+// (default 100). Smaller drops are only flagged as anomalies.
+func plausibleDrop() float64 {
+	if n, err := strconv.Atoi(os.Getenv("PLAUSIBLE_MAX_DROP")); err == nil && n > 0 {
+		return float64(n)
+	}
+	return 100
+}
+
+// implausible lists what is obviously broken in info, compared with prev,
+// the day’s earlier snapshot or else yesterday’s: missing profile fields,
+// ranks of 0 or below, negative counts and counts that fell by more than
+// plausibleDrop. Fields of failed or skipped calls aren’t checked.
+func implausible(prev, info map[string]interface{}) []string {
+	var problems []string
+	if fetchOK(info, "profile") {
+		for _, field := range []string{"Name", "Country_Code", "Rank"} {
+			if s, _ := info[field].(string); s == "" {
+				problems = append(problems, field+" is empty")
+			}
+		}
+		if rank, ok := toFloat(info["User_Global_Rank"]); !ok || rank <= 0 {
+			problems = append(problems, fmt.Sprintf("User_Global_Rank is %v", formatValue(info["User_Global_Rank"])))
+		}
+	}
+	if v, ok := info["Local_Rank"]; ok {
+		if rank, ok := toFloat(v); !ok || rank <= 0 {
+			problems = append(problems, fmt.Sprintf("Local_Rank is %v", formatValue(v)))
+		}
+	}
+	for _, field := range countFields {
+		n, ok := toFloat(info[field])
+		if !ok {
+			continue
+		}
+		if n < 0 {
+			problems = append(problems, fmt.Sprintf("%s is %v", field, formatValue(info[field])))
+			continue
+		}
+		if old, ok := toFloat(prev[field]); ok && old-n > plausibleDrop() {
+			problems = append(problems, fmt.Sprintf("%s fell from %v to %v", field, formatValue(prev[field]), formatValue(info[field])))
+		}
+	}
+	return problems
+}
+
+// reportImplausible logs a rejected fetch, counts it in the
+// ImplausibleFetch metric and sends it as a data‑quality notice, routed and
+// published like an anomaly.
+func reportImplausible(ctx context.Context, userID string, err *implausibleError) {
+	slog.WarnContext(ctx, "rejected implausible fetch", "user", userID, "problems", err.problems)
+	emitMetric("ImplausibleFetch", 1, map[string]string{"User": userID})
+	c := Change{Field: anomalyField, Detail: tr("implausible", strings.Join(err.problems, "; "))}
+	if len(configuredUsers()) > 1 {
+		c.User = userID
+	}
+	notifyChanges(ctx, []Change{c})
+}
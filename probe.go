@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// probePath is requested without a token: any answer from HTB’s API, a 401
+// included, shows it is up.
+const probePath = "/api/v4/user/info"
+
+// probeTimeout bounds the probe well below a refresh’s HTB calls.
+const probeTimeout = 5 * time.Second
+
+// probeTTL is how long a probe result is reused, from HTB_PROBE_TTL
+// (default 1m; 0 turns the probe off and HTB counts as up).
+func probeTTL() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("HTB_PROBE_TTL")); err == nil && d >= 0 {
+		return d
+	}
+	return time.Minute
+}
+
+var (
+	probeMutex sync.Mutex
+	probedAt   time.Time
+	probeErr   error
+)
+
+// probeHTB makes one unauthenticated request to HTB’s API, without retries.
+// A 5xx, a 429, a maintenance page or challenge, a timeout or a connection
+// error mean HTB is down.
+func probeHTB(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, htbAPI(probePath), nil)
+	setHTBHeaders(req)
+	client := &http.Client{Transport: tracedTransport(chaosTransport{next: http.DefaultTransport})}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if blocked := blockedResponse(resp); blocked != nil {
+		return blocked
+	}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return &rateLimitError{retryAfter: retryAfter(resp.Header.Get("Retry-After"))}
+	}
+	if resp.StatusCode >= 500 {
+		return &statusError{code: resp.StatusCode}
+	}
+	return nil
+}
+
+// htbHealth reports when HTB was last probed and why it looks down, nil when
+// it looks up, probing it at most once per probeTTL per container. Batch
+// refreshes consult it so a whole batch isn’t spent on timeouts during an
+// outage.
+func htbHealth(ctx context.Context) (checkedAt time.Time, err error) {
+	ttl := probeTTL()
+	if ttl == 0 {
+		return time.Time{}, nil
+	}
+	probeMutex.Lock()
+	defer probeMutex.Unlock()
+	if time.Since(probedAt) < ttl {
+		return probedAt, probeErr
+	}
+	probeErr, probedAt = probeHTB(ctx), time.Now()
+	if probeErr != nil {
+		probeErr = fmt.Errorf("HTB health probe failed: %w", probeErr)
+		slog.WarnContext(ctx, "HTB health probe failed", "endpoint", probePath, "error", probeErr)
+		emitMetric("HTBProbeFailures", 1, nil)
+	}
+	return probedAt, probeErr
+}
+
+// readyHandler serves /readyz: 200 when HTB answered the probe and the
+// circuit breaker is closed, else 503 with the reason, for load balancers,
+// uptime checks and schedulers deciding whether to refresh now.
+func readyHandler(ctx context.Context) (map[string]interface{}, error) {
+	body := map[string]interface{}{"ready": true, "htb": "up"}
+	at, err := htbHealth(ctx)
+	if !at.IsZero() {
+		body["checked_at"] = at.UTC().Format(time.RFC3339)
+	}
+	if err != nil {
+		body["ready"], body["htb"], body["detail"] = false, "down", err.Error()
+	}
+	if tableName := os.Getenv("TABLE_NAME"); tableName != "" {
+		if _, until := circuitState(ctx, tableName); time.Now().Before(until) {
+			body["ready"] = false
+			body["circuit_open_until"] = until.UTC().Format(time.RFC3339)
+		}
+	}
+	if body["ready"] != true {
+		return httpResponse(http.StatusServiceUnavailable, body), nil
+	}
+	return httpResponse(http.StatusOK, body), nil
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"os"
+	"time"
+)
+
+// projectionWindow is how many days of history the pace is measured over.
+const projectionWindow = 30
+
+// rankRequirements is the ownership percentage HTB requires for each rank
+// title, used when the profile doesn’t report the next rank’s requirement.
+var rankRequirements = map[string]float64{
+	"Script Kiddie": 5,
+	"Hacker":        20,
+	"Pro Hacker":    45,
+	"Elite Hacker":  70,
+	"Guru":          90,
+	"Omniscient":    100,
+}
+
+// rankProjection estimates when the next rank title is reached at the pace
+// of the last projectionWindow days.
+type rankProjection struct {
+	Rank          string  `json:"rank"`
+	NextRank      string  `json:"next_rank,omitempty"`
+	Ownership     float64 `json:"ownership"`
+	Requirement   float64 `json:"requirement,omitempty"`
+	PerDay        float64 `json:"ownership_per_day"`
+	PointsPerDay  float64 `json:"points_per_day"`
+	ProjectedDate string  `json:"projected_date,omitempty"`
+	DaysLeft      int     `json:"days_left,omitempty"`
+}
+
+// nextRank returns the title after the snapshot’s rank and the ownership it
+// needs, preferring what HTB reported.
+func nextRank(item map[string]interface{}) (string, float64, bool) {
+	if next, ok := item["Next_Rank"].(string); ok && next != "" {
+		if req, ok := toFloat(item["Rank_Requirement"]); ok && req > 0 {
+			return next, req, true
+		}
+		if req, ok := rankRequirements[next]; ok {
+			return next, req, true
+		}
+	}
+	current, ok := statValue("Rank", item["Rank"])
+	if !ok || int(current)+1 >= len(rankTitles) {
+		return "", 0, false
+	}
+	next := rankTitles[int(current)+1]
+	return next, rankRequirements[next], true
+}
+
+// projectRank measures the ownership gained per day between the oldest
+// snapshot in points and latest, and extrapolates to the next rank.
+func projectRank(points []map[string]interface{}, latest map[string]interface{}, today time.Time) rankProjection {
+	p := rankProjection{Rank: fmt.Sprint(latest["Rank"])}
+	p.Ownership, _ = toFloat(latest["Rank_Ownership"])
+	next, req, ok := nextRank(latest)
+	if ok {
+		p.NextRank, p.Requirement = next, req
+	}
+
+	for _, old := range points {
+		d, err := time.Parse("2006-01-02", fmt.Sprint(old["date"]))
+		oldOwn, okOwn := toFloat(old["Rank_Ownership"])
+		if err != nil || !okOwn {
+			continue
+		}
+		days := today.Sub(d).Hours() / 24
+		if days < 1 {
+			break
+		}
+		p.PerDay = math.Round((p.Ownership-oldOwn)/days*1000) / 1000
+		break
+	}
+	p.PointsPerDay, _, _, _ = velocity(points, latest, today)
+
+	if ok && p.PerDay > 0 && p.Ownership < p.Requirement {
+		p.DaysLeft = int(math.Ceil((p.Requirement - p.Ownership) / p.PerDay))
+		p.ProjectedDate = today.AddDate(0, 0, p.DaysLeft).Format("2006-01-02")
+	}
+	return p
+}
+
+// projectionHandler serves /projection[?user=ID]: the pace towards the next
+// rank title and the date it will be reached at that pace.
+func projectionHandler(ctx context.Context, inv invocation) (map[string]interface{}, error) {
+	tableName := os.Getenv("TABLE_NAME")
+	if tableName == "" {
+		return httpResponse(http.StatusInternalServerError, map[string]string{"error": "TABLE_NAME not configured"}), nil
+	}
+	user, ok := requestedUser(inv)
+	if !ok {
+		return httpResponse(http.StatusNotFound, map[string]string{"error": "unknown user"}), nil
+	}
+	if denied := requireVisible(inv, "Rank", "Rank_Ownership", "Points"); denied != nil {
+		return denied, nil
+	}
+
+	today := currentDay()
+	items, err := loadRange(ctx, tableName, user, today.AddDate(0, 0, -projectionWindow), today)
+	if err != nil {
+		slog.ErrorContext(ctx, "BatchGetItem failed", "region", awsRegion, "table", tableName, "error", err)
+		return httpResponse(http.StatusInternalServerError, map[string]string{"error": "Database lookup failed", "detail": err.Error()}), nil
+	}
+	points := visibleSeries(inv, series(items))
+	if len(points) == 0 {
+		return httpResponse(http.StatusNotFound, map[string]string{"error": "no snapshots in the last 30 days"}), nil
+	}
+	latest := points[len(points)-1]
+	day, _ := time.Parse("2006-01-02", latest["date"].(string))
+	return httpResponse(http.StatusOK, projectRank(points[:len(points)-1], latest, day)), nil
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"unicode"
+)
+
+// authenticated reports whether the request carries REFRESH_HOOK_SECRET or a
+// tenant’s API key; such requests see every field.
+func authenticated(inv invocation) bool {
+	return inv.tenant != nil || hookAuthorized(inv)
+}
+
+// fieldVisible reports whether the snapshot field may be shown to inv: any
+// field without PUBLIC_FIELDS or to an authenticated request, otherwise only
+// the listed ones.
+func fieldVisible(inv invocation, field string) bool {
+	public := splitList(os.Getenv("PUBLIC_FIELDS"))
+	if len(public) == 0 || authenticated(inv) {
+		return true
+	}
+	for _, f := range public {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// snapshotField reports whether key names a stored stat: snapshot fields are
+// capitalised (User_Global_Rank, Name, …) while response envelopes use lower
+// case keys. Labels is the translation table added by ?lang=.
+func snapshotField(key string) bool {
+	return key != "" && key != "Labels" && unicode.IsUpper([]rune(key)[0])
+}
+
+// redactResponse removes the snapshot fields PUBLIC_FIELDS doesn’t list from
+// a response to an unauthenticated request: the keys of stored items, and the
+// rows of per‑field listings such as /compare and /diff. Function URL
+// responses are decoded from and re‑encoded into their body; the root path’s
+// bare item is filtered directly.
+func redactResponse(inv invocation, res map[string]interface{}) map[string]interface{} {
+	if os.Getenv("PUBLIC_FIELDS") == "" || authenticated(inv) || res == nil {
+		return res
+	}
+	body, ok := res["body"].(string)
+	if _, isHTTP := res["statusCode"]; !isHTTP || !ok {
+		return redactValue(inv, res).(map[string]interface{})
+	}
+	var decoded interface{}
+	if err := json.Unmarshal([]byte(body), &decoded); err != nil {
+		return res
+	}
+	raw, _ := json.Marshal(redactValue(inv, decoded))
+	out := make(map[string]interface{}, len(res))
+	for k, v := range res {
+		out[k] = v
+	}
+	out["body"] = string(raw)
+	return out
+}
+
+func redactValue(inv invocation, v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for k, val := range v {
+			if snapshotField(k) && !fieldVisible(inv, k) {
+				continue
+			}
+			out[k] = redactValue(inv, val)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, 0, len(v))
+		for _, val := range v {
+			if row, ok := val.(map[string]interface{}); ok {
+				if field, ok := row["field"].(string); ok && snapshotField(field) && !fieldVisible(inv, field) {
+					continue
+				}
+			}
+			out = append(out, redactValue(inv, val))
+		}
+		return out
+	}
+	return v
+}
+
+// fieldForbidden is the response to a request for a series of a field
+// PUBLIC_FIELDS keeps private.
+func fieldForbidden(field string) map[string]interface{} {
+	return httpResponse(http.StatusForbidden, map[string]string{"error": field + " is not public"})
+}
+
+// visible returns item’s field when inv may see it, nil otherwise.
+func visible(inv invocation, item map[string]interface{}, field string) interface{} {
+	if !fieldVisible(inv, field) {
+		return nil
+	}
+	return item[field]
+}
+
+// requireVisible is the 403 for the first of fields inv may not see, nil
+// when it may see them all. Routes whose figures are derived from snapshot
+// fields (owns gained, best ranks, season standings) check the fields they
+// can’t do without before computing anything.
+func requireVisible(inv invocation, fields ...string) map[string]interface{} {
+	for _, f := range fields {
+		if !fieldVisible(inv, f) {
+			return fieldForbidden(f)
+		}
+	}
+	return nil
+}
+
+// visibleSeries returns points without the snapshot fields inv may not see,
+// so figures derived from them, such as a best country rank, drop out of the
+// response instead of leaking under a lower‑case key that redactResponse
+// can’t tell from an envelope field.
+func visibleSeries(inv invocation, points []map[string]interface{}) []map[string]interface{} {
+	if os.Getenv("PUBLIC_FIELDS") == "" || authenticated(inv) {
+		return points
+	}
+	out := make([]map[string]interface{}, 0, len(points))
+	for _, p := range points {
+		kept := make(map[string]interface{}, len(p))
+		for k, v := range p {
+			if !snapshotField(k) || fieldVisible(inv, k) {
+				kept[k] = v
+			}
+		}
+		out = append(out, kept)
+	}
+	return out
+}
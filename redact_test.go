@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+// wireValue encodes v as a DynamoDB JSON attribute value.
+func wireValue(v interface{}) map[string]interface{} {
+	switch v := v.(type) {
+	case string:
+		return map[string]interface{}{"S": v}
+	case int:
+		return map[string]interface{}{"N": strconv.Itoa(v)}
+	case float64:
+		return map[string]interface{}{"N": strconv.FormatFloat(v, 'f', -1, 64)}
+	case []interface{}:
+		l := make([]interface{}, len(v))
+		for i, e := range v {
+			l[i] = wireValue(e)
+		}
+		return map[string]interface{}{"L": l}
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			m[k] = wireValue(e)
+		}
+		return map[string]interface{}{"M": m}
+	}
+	panic("unsupported attribute value")
+}
+
+// fakeSnapshots serves BatchGetItem from ten days of snapshots of user 42
+// ending today, with every field the derived routes read.
+func fakeSnapshots(t *testing.T) {
+	items := map[string]map[string]interface{}{}
+	today := currentDay()
+	for i := 0; i < 10; i++ {
+		date := today.AddDate(0, 0, i-9).Format("2006-01-02")
+		items[itemKey("42", date)] = map[string]interface{}{
+			"Name":                 "alice",
+			"Country_Code":         "GB",
+			"User_Global_Rank":     500 - i*10,
+			"Local_Rank":           50 - i,
+			"System_Owns":          20 + i,
+			"User_Owns":            30 + i*(i%2),
+			"System_Bloods":        1,
+			"User_Bloods":          2,
+			"Challenge_Owns":       10 + i,
+			"Challenge_Categories": map[string]interface{}{"Web": 3 + i},
+			"Badges":               []interface{}{map[string]interface{}{"id": 1, "name": "First", "icon": "x.png"}},
+			"Rank":                 "Hacker",
+			"Rank_Ownership":       40.0 + float64(i),
+			"Points":               100 + i,
+			"Season_ID":            7,
+			"Season_Start":         today.AddDate(0, 0, -20).Format("2006-01-02"),
+			"Season_Points":        10 + i,
+			"Season_Machines":      i,
+			"Season_Rank":          300 - i,
+			"Season_Tier":          "Gold",
+		}
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.Header.Get("X-Amz-Target"), ".BatchGetItem") {
+			http.Error(w, `{"__type":"UnknownOperationException"}`, http.StatusBadRequest)
+			return
+		}
+		var in struct {
+			RequestItems map[string]struct {
+				Keys []map[string]map[string]string
+			}
+		}
+		json.NewDecoder(r.Body).Decode(&in)
+		out := map[string][]interface{}{}
+		for table, req := range in.RequestItems {
+			out[table] = []interface{}{}
+			for _, k := range req.Keys {
+				key := k["date"]["S"]
+				if item, ok := items[key]; ok {
+					av := map[string]interface{}{"date": wireValue(key)}
+					for f, v := range item {
+						av[f] = wireValue(v)
+					}
+					out[table] = append(out[table], av)
+				}
+			}
+		}
+		w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+		json.NewEncoder(w).Encode(map[string]interface{}{"Responses": out})
+	}))
+	t.Cleanup(srv.Close)
+	saved := dynamoClient
+	dynamoClient = dynamodb.New(dynamodb.Options{
+		Region:           "eu-west-1",
+		BaseEndpoint:     aws.String(srv.URL),
+		Credentials:      aws.AnonymousCredentials{},
+		RetryMaxAttempts: 1,
+	})
+	t.Cleanup(func() { dynamoClient = saved })
+}
+
+// TestPublicFieldsDerivedRoutes checks that the routes deriving figures from
+// snapshot fields answer 403 or leave the figures out when PUBLIC_FIELDS
+// keeps their source private.
+func TestPublicFieldsDerivedRoutes(t *testing.T) {
+	t.Setenv("TABLE_NAME", "stats")
+	t.Setenv("USER_ID", "42")
+	fakeSnapshots(t)
+	year := strconv.Itoa(currentDay().Year())
+	gains := "System_Owns,User_Owns,System_Bloods,User_Bloods,Challenge_Owns,Badges"
+
+	tests := []struct {
+		name   string
+		public string
+		path   string
+		query  map[string]string
+		status int
+		has    []string
+		hasnt  []string
+	}{
+		{"review unfiltered", "", "/review/" + year, nil, 200, []string{`"best_country_rank"`, `"best_global_rank"`}, nil},
+		{"review private gains", "User_Global_Rank,User_Owns", "/review/" + year, nil, 403, nil, []string{`"best_country_rank"`, `"owns_gained"`}},
+		{"review private country rank", gains + ",User_Global_Rank", "/review/" + year, nil, 200, []string{`"best_global_rank"`, `"owns_gained"`}, []string{`"best_country_rank"`}},
+		{"season private standings", "User_Global_Rank,User_Owns", "/season/current", nil, 403, nil, []string{`"points"`}},
+		{"season private rank and tier", "Season_ID,Season_Points,Season_Machines", "/season/current", nil, 200, []string{`"points"`}, []string{`"rank"`, `"best_rank"`, `"tier"`, "Gold"}},
+		{"aggregate private owns", "User_Global_Rank,User_Owns", "/history/aggregate", nil, 403, nil, []string{`"min_rank"`}},
+		{"aggregate private rank", "System_Owns,User_Owns", "/history/aggregate", nil, 200, []string{`"owns_gained"`}, []string{`"min_rank"`, `"max_rank"`, `"avg_rank"`}},
+		{"projection private", "User_Global_Rank,User_Owns", "/projection", nil, 403, nil, []string{`"ownership"`}},
+		{"categories private", "User_Global_Rank,User_Owns", "/history/categories", nil, 403, nil, []string{"Web"}},
+		{"correlation private rank", "User_Owns", "/correlation", nil, 403, nil, []string{`"metrics"`}},
+		{"correlation private metrics", "User_Global_Rank,User_Owns", "/correlation", nil, 200, []string{`"User_Owns"`}, []string{"System_Owns", "Challenge_Owns", "Bloods"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("PUBLIC_FIELDS", tt.public)
+			event, _ := json.Marshal(map[string]interface{}{"rawPath": tt.path, "queryStringParameters": tt.query})
+			res, err := handler(context.Background(), event)
+			if err != nil {
+				t.Fatalf("handler: %v", err)
+			}
+			body, _ := res["body"].(string)
+			if res["statusCode"] != tt.status {
+				t.Fatalf("status = %v, want %d: %s", res["statusCode"], tt.status, body)
+			}
+			for _, s := range tt.has {
+				if !strings.Contains(body, s) {
+					t.Errorf("body lacks %s: %s", s, body)
+				}
+			}
+			for _, s := range tt.hasnt {
+				if strings.Contains(body, s) {
+					t.Errorf("body leaks %s: %s", s, body)
+				}
+			}
+		})
+	}
+}
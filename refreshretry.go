@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+)
+
+// maxQueueDelay is the longest delay SQS accepts on a message.
+const maxQueueDelay = 15 * time.Minute
+
+// refreshRetries is how many delayed retries a refresh that failed upstream
+// gets on REFRESH_QUEUE_URL, from REFRESH_RETRIES (default 5; 0 disables
+// them).
+func refreshRetries() int {
+	if n, err := strconv.Atoi(os.Getenv("REFRESH_RETRIES")); err == nil && n >= 0 {
+		return n
+	}
+	return 5
+}
+
+// retryDelay is the delay before retry n (from 0): FAILURE_TTL, doubled for
+// each retry after, up to the 15 minutes SQS allows. Doubling stops at the
+// cap, so a large REFRESH_RETRIES can’t overflow the delay.
+func retryDelay(n int) time.Duration {
+	d := failureTTL()
+	for i := 0; i < n && d < maxQueueDelay; i++ {
+		d *= 2
+	}
+	return min(d, maxQueueDelay)
+}
+
+type attemptKey struct{}
+
+// withAttempt marks ctx as the worker’s handling of retry n of a refresh.
+func withAttempt(ctx context.Context, n int) context.Context {
+	return context.WithValue(ctx, attemptKey{}, n)
+}
+
+// retryMarkerKey names the marker of a queued retry of userID’s refresh
+// for date.
+func retryMarkerKey(userID, date string) string {
+	return envKey("retry#" + userID + "#" + date)
+}
+
+// claimRetry records in tableName, with a conditional write like the fetch
+// lock, that retry attempt of userID’s refresh for date is being queued. It
+// fails when another retry is already pending: one queued within
+// FAILURE_TTL, other than the one being handled now. When DynamoDB can’t be
+// reached it fails open, as a duplicate retry beats none.
+func claimRetry(ctx context.Context, tableName, userID, date string, attempt int) bool {
+	if tableName == "" {
+		return true
+	}
+	now := time.Now()
+	_, err := dynamoClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(tableName),
+		Item: map[string]types.AttributeValue{
+			"date":       &types.AttributeValueMemberS{Value: retryMarkerKey(userID, date)},
+			"attempt":    &types.AttributeValueMemberN{Value: strconv.Itoa(attempt)},
+			"expires_at": &types.AttributeValueMemberN{Value: strconv.FormatInt(now.Add(failureTTL()).Unix(), 10)},
+		},
+		ConditionExpression:      aws.String("attribute_not_exists(#k) OR expires_at < :now OR attempt < :attempt"),
+		ExpressionAttributeNames: map[string]string{"#k": "date"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":now":     &types.AttributeValueMemberN{Value: strconv.FormatInt(now.Unix(), 10)},
+			":attempt": &types.AttributeValueMemberN{Value: strconv.Itoa(attempt)},
+		},
+	})
+	var condErr *types.ConditionalCheckFailedException
+	if errors.As(err, &condErr) {
+		return false
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "marking the retry as queued failed", "user", userID, "error", err)
+	}
+	return true
+}
+
+// releaseRetry removes the marker claimRetry wrote, so that a retry whose
+// message couldn’t be sent is queued by the next failure instead.
+func releaseRetry(ctx context.Context, tableName, userID, date string) {
+	if tableName == "" {
+		return
+	}
+	_, err := dynamoClient.DeleteItem(context.WithoutCancel(ctx), &dynamodb.DeleteItemInput{
+		TableName: aws.String(tableName),
+		Key:       map[string]types.AttributeValue{"date": &types.AttributeValueMemberS{Value: retryMarkerKey(userID, date)}},
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "removing the retry marker failed", "user", userID, "error", err)
+	}
+}
+
+// scheduleRetry queues a delayed retry of userID’s refresh for date after it
+// failed with err, when the failure was upstream — HTB down, rate limiting or
+// the circuit breaker — or the invocation ran out of time, and retries are
+// left. At most one retry per user and date is pending at a time: while the
+// circuit is open every widget hit lands here, and each would otherwise add
+// a message. It reports whether one is queued, by this call or an earlier
+// one; the worker then doesn’t report the job as failed, so SQS doesn’t
+// redeliver it on top.
+func scheduleRetry(ctx context.Context, tableName, userID, date string, err error) bool {
+	retriable := upstreamFailure(err) || errors.Is(err, errCircuitOpen) || errors.Is(err, context.DeadlineExceeded)
+	if os.Getenv("REFRESH_QUEUE_URL") == "" || !retriable {
+		return false
+	}
+	n, _ := ctx.Value(attemptKey{}).(int)
+	if n >= refreshRetries() {
+		return false
+	}
+	if !claimRetry(ctx, tableName, userID, date, n+1) {
+		slog.DebugContext(ctx, "refresh retry already queued", "user", userID)
+		return true
+	}
+	body, _ := json.Marshal(refreshJob{UserID: userID, Date: date, Attempt: n + 1})
+	delay := retryDelay(n)
+	_, sendErr := sqs.NewFromConfig(awsCfg).SendMessage(ctx, &sqs.SendMessageInput{
+		QueueUrl:     aws.String(os.Getenv("REFRESH_QUEUE_URL")),
+		MessageBody:  aws.String(string(body)),
+		DelaySeconds: int32(delay / time.Second),
+	})
+	if sendErr != nil {
+		slog.ErrorContext(ctx, "queueing refresh retry failed", "user", userID, "error", sendErr)
+		releaseRetry(ctx, tableName, userID, date)
+		return false
+	}
+	slog.InfoContext(ctx, "refresh failed upstream, retry queued", "user", userID, "retry", n+1, "retries", refreshRetries(), "delay", delay.String())
+	return true
+}
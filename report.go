@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html/template"
+	"io"
+	"log/slog"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// reportLinkTTL is how long the emailed report link stays valid, from
+// REPORT_LINK_DAYS (default and SigV4 maximum: 7 days).
+func reportLinkTTL() time.Duration {
+	days, _ := strconv.Atoi(os.Getenv("REPORT_LINK_DAYS"))
+	if days <= 0 || days > 7 {
+		days = 7
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+var reportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"t": func(key string) string { return tr(key) },
+}).Parse(`<html><head><meta charset="utf-8"><title>{{t "report.title"}} {{.Month}}</title></head>
+<body style="font-family:sans-serif;max-width:720px;margin:auto">
+<h2>{{t "report.title"}} — {{.Month}}</h2>
+<p>{{.User}} · {{.From}} → {{.To}} · {{.Days}} {{t "report.days"}}</p>
+{{if .Points}}<h3>{{t "label.Points"}}</h3>{{.Points}}{{end}}
+{{if .Rank}}<h3>{{t "label.User_Global_Rank"}}</h3>{{.Rank}}{{end}}
+{{if .Changes}}<table cellpadding="6" style="border-collapse:collapse">
+<tr><th align="left">{{t "digest.stat"}}</th><th>{{t "digest.start"}}</th><th>{{t "digest.end"}}</th><th></th></tr>
+{{range .Changes}}<tr><td>{{.Label}}</td><td align="center">{{.OldText}}</td><td align="center">{{.NewText}}</td><td>{{.Arrow}}</td></tr>
+{{end}}</table>{{else}}<p>{{t "report.none"}}</p>{{end}}
+{{if .Badges}}<h3>{{t "report.badges"}}</h3>
+<p>{{range .Badges}}{{if .Image}}<img src="{{.Image}}" alt="" height="32" style="vertical-align:middle"> {{end}}{{.New}}<br>{{end}}</p>{{end}}
+</body></html>`))
+
+// sparkline renders values as an inline SVG line chart, flipped when lower is
+// better (ranks). It returns nothing for fewer than two values.
+func sparkline(values []float64, lowerIsBetter bool) template.HTML {
+	if len(values) < 2 {
+		return ""
+	}
+	const w, h = 680.0, 120.0
+	lo, hi := values[0], values[0]
+	for _, v := range values {
+		lo, hi = min(lo, v), max(hi, v)
+	}
+	span := hi - lo
+	if span == 0 {
+		span = 1
+	}
+	pts := make([]string, len(values))
+	for i, v := range values {
+		y := (v - lo) / span
+		if !lowerIsBetter {
+			y = 1 - y
+		}
+		pts[i] = fmt.Sprintf("%.1f,%.1f", float64(i)*w/float64(len(values)-1), 5+y*(h-10))
+	}
+	return template.HTML(fmt.Sprintf(
+		`<svg width="%.0f" height="%.0f" xmlns="http://www.w3.org/2000/svg"><polyline fill="none" stroke="#9fef00" stroke-width="2" points="%s"/></svg>`+
+			`<div style="font-size:small;color:#666">%s – %s</div>`,
+		w, h, strings.Join(pts, " "), formatValue(lo), formatValue(hi)))
+}
+
+// renderReport builds the HTML for one user and month from a date‑ordered
+// series that starts with the last snapshot of the month before, when there
+// is one, as the baseline.
+func renderReport(user, month string, points []map[string]interface{}) ([]byte, error) {
+	var inMonth []map[string]interface{}
+	for _, p := range points {
+		if strings.HasPrefix(p["date"].(string), month) {
+			inMonth = append(inMonth, p)
+		}
+	}
+	data := map[string]interface{}{"User": user, "Month": month, "Days": len(inMonth)}
+	if len(inMonth) > 0 {
+		data["From"] = inMonth[0]["date"]
+		data["To"] = inMonth[len(inMonth)-1]["date"]
+
+		var pts, ranks []float64
+		for _, p := range inMonth {
+			if v, ok := toFloat(p["Points"]); ok {
+				pts = append(pts, v)
+			}
+			if v, ok := toFloat(p["User_Global_Rank"]); ok && v > 0 {
+				ranks = append(ranks, v)
+			}
+		}
+		data["Points"] = sparkline(pts, false)
+		data["Rank"] = sparkline(ranks, true)
+
+		first, last := points[0], inMonth[len(inMonth)-1]
+		var rows []digestRow
+		for _, c := range detectChanges(first, last) {
+			rows = append(rows, digestRow{Change: c, OldText: formatValue(c.Old), NewText: formatValue(c.New)})
+		}
+		data["Changes"] = rows
+		badges := detectNewBadges(first, last)
+		for i := range badges {
+			badges[i].Image = badgeIconURL(badges[i].Image)
+		}
+		data["Badges"] = badges
+	}
+
+	var buf bytes.Buffer
+	if err := reportTemplate.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// renderPDF converts html with the headless Chromium renderer at
+// REPORT_PDF_URL, which takes the page as an index.html form file (e.g.
+// Gotenberg’s /forms/chromium/convert/html).
+func renderPDF(ctx context.Context, html []byte) ([]byte, error) {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("files", "index.html")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := part.Write(html); err != nil {
+		return nil, err
+	}
+	if err := form.Close(); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, os.Getenv("REPORT_PDF_URL"), &body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	resp, err := (&http.Client{Timeout: 60 * time.Second}).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("PDF renderer returned %s", resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// monthlyReport renders last month’s report (or {"month": "YYYY-MM"}) for
+// every tracked user, stores it in REPORT_BUCKET as HTML — and as PDF when
+// REPORT_PDF_URL is set — and emails a presigned link to REPORT_TO (or
+// DIGEST_TO). Schedule it with {"action": "monthly_report"} on the 1st.
+func monthlyReport(ctx context.Context, inv invocation) (map[string]interface{}, error) {
+	tableName := os.Getenv("TABLE_NAME")
+	bucket := os.Getenv("REPORT_BUCKET")
+	if tableName == "" || bucket == "" {
+		return map[string]interface{}{"error": "TABLE_NAME or REPORT_BUCKET not configured"}, nil
+	}
+	prefix := strings.Trim(os.Getenv("REPORT_PREFIX"), "/")
+	if prefix == "" {
+		prefix = "htb-reports"
+	}
+
+	now := time.Now().In(dateLocation())
+	start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC).AddDate(0, -1, 0)
+	if inv.Month != "" {
+		m, err := time.Parse("2006-01", inv.Month)
+		if err != nil {
+			return map[string]interface{}{"error": "month must be YYYY-MM"}, nil
+		}
+		start = m
+	}
+	month := start.Format("2006-01")
+	// the last day of the month before is the baseline for the deltas
+	from, to := start.AddDate(0, 0, -1), start.AddDate(0, 1, -1)
+
+	client := s3.NewFromConfig(awsCfg)
+	presigner := s3.NewPresignClient(client)
+	var links []string
+	for _, user := range configuredUsers() {
+		items, err := loadRange(ctx, tableName, user, from, to)
+		if err != nil {
+			slog.ErrorContext(ctx, "BatchGetItem failed", "region", awsRegion, "table", tableName, "error", err)
+			return map[string]interface{}{"error": "Database lookup failed", "detail": err.Error()}, nil
+		}
+		html, err := renderReport(user, month, series(items))
+		if err != nil {
+			return map[string]interface{}{"error": "Error rendering report", "detail": err.Error()}, nil
+		}
+
+		key, body, contentType := fmt.Sprintf("%s/%s/%s.html", prefix, user, month), html, "text/html; charset=utf-8"
+		if os.Getenv("REPORT_PDF_URL") != "" {
+			pdf, err := renderPDF(ctx, html)
+			if err != nil {
+				// the HTML version is still worth sending
+				slog.ErrorContext(ctx, "PDF rendering failed, storing HTML", "error", err)
+			} else {
+				key, body, contentType = strings.TrimSuffix(key, ".html")+".pdf", pdf, "application/pdf"
+			}
+		}
+		if _, err := client.PutObject(ctx, &s3.PutObjectInput{
+			Bucket:      aws.String(bucket),
+			Key:         aws.String(key),
+			Body:        bytes.NewReader(body),
+			ContentType: aws.String(contentType),
+		}); err != nil {
+			slog.ErrorContext(ctx, "PutObject failed", "bucket", bucket, "key", key, "error", err)
+			return map[string]interface{}{"error": "Error writing to S3", "detail": err.Error()}, nil
+		}
+
+		signed, err := presigner.PresignGetObject(ctx, &s3.GetObjectInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String(key),
+		}, s3.WithPresignExpires(reportLinkTTL()))
+		if err != nil {
+			return map[string]interface{}{"error": "Error presigning report", "detail": err.Error()}, nil
+		}
+		links = append(links, signed.URL)
+	}
+	res := map[string]interface{}{"month": month, "links": links}
+
+	sender := os.Getenv("DIGEST_FROM")
+	recipients := splitList(os.Getenv("REPORT_TO"))
+	if len(recipients) == 0 {
+		recipients = splitList(os.Getenv("DIGEST_TO"))
+	}
+	if sender == "" || len(recipients) == 0 || len(links) == 0 {
+		return res, nil
+	}
+	var body strings.Builder
+	body.WriteString("<html><body style=\"font-family:sans-serif\"><p>" + template.HTMLEscapeString(tr("report.ready", month)) + "</p><ul>")
+	for _, l := range links {
+		body.WriteString(`<li><a href="` + template.HTMLEscapeString(l) + `">` + template.HTMLEscapeString(tr("report.title")+" "+month) + "</a></li>")
+	}
+	body.WriteString("</ul></body></html>")
+	if err := sendEmail(ctx, sender, recipients, tr("report.title")+" "+month, body.String()); err != nil {
+		slog.ErrorContext(ctx, "SES SendEmail failed", "error", err)
+		return map[string]interface{}{"error": "Error sending report", "detail": err.Error(), "links": links}, nil
+	}
+	res["sent"] = len(recipients)
+	return res, nil
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+)
+
+// errDeadLettered marks a delivery that failed every attempt but was saved to
+// the notification DLQ for later replay.
+var errDeadLettered = errors.New("notification dead-lettered")
+
+// undeliveredError reports a delivery that got only some of its changes
+// through. The retries, and the DLQ after them, then carry only the
+// undelivered ones, so what was accepted isn’t sent twice.
+type undeliveredError struct {
+	changes []Change
+	err     error
+}
+
+func (e *undeliveredError) Error() string { return e.err.Error() }
+func (e *undeliveredError) Unwrap() error { return e.err }
+
+// notifyRetries is how many extra attempts a failed delivery gets, from
+// NOTIFY_RETRIES (default 2).
+func notifyRetries() int {
+	if n, err := strconv.Atoi(os.Getenv("NOTIFY_RETRIES")); err == nil && n >= 0 {
+		return n
+	}
+	return 2
+}
+
+// notifyWithRetry calls n.Notify, retrying transport errors, 429s and 5xx
+// with exponential backoff (1s, 2s, 4s, …). Client errors are not retried.
+// After an *undeliveredError only its changes are tried again. Once attempts
+// are exhausted the batch is pushed to NOTIFY_DLQ_URL, if set, and a
+// NotificationFailures metric is logged.
+func notifyWithRetry(ctx context.Context, n Notifier, changes []Change) error {
+	retries := notifyRetries()
+	var err error
+	for attempt := 0; ; attempt++ {
+		if err = n.Notify(ctx, changes); err == nil {
+			return nil
+		}
+		var partial *undeliveredError
+		if errors.As(err, &partial) {
+			changes = partial.changes
+		}
+		var se *statusError
+		permanent := errors.As(err, &se) && se.code < 500 && se.code != http.StatusTooManyRequests
+		if permanent || attempt == retries {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Second << attempt):
+		}
+	}
+
+	emitMetric("NotificationFailures", 1, map[string]string{"Channel": n.Name()})
+	queueURL := os.Getenv("NOTIFY_DLQ_URL")
+	if queueURL == "" {
+		return err
+	}
+	if dlqErr := deadLetter(ctx, queueURL, n.Name(), changes, err); dlqErr != nil {
+		slog.ErrorContext(ctx, "sending notification to DLQ failed", "channel", n.Name(), "error", dlqErr)
+		return err
+	}
+	return fmt.Errorf("%w: %v", errDeadLettered, err)
+}
+
+// deadLetter records an undeliverable batch on SQS with enough context to
+// replay it.
+func deadLetter(ctx context.Context, queueURL, channel string, changes []Change, cause error) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"channel":   channel,
+		"error":     cause.Error(),
+		"events":    changeEvents(changes),
+		"timestamp": time.Now().UTC(),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = sqs.NewFromConfig(awsCfg).SendMessage(ctx, &sqs.SendMessageInput{
+		QueueUrl:    aws.String(queueURL),
+		MessageBody: aws.String(string(body)),
+	})
+	return err
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// yearReview is the /review/<year> response.
+type yearReview struct {
+	User           string   `json:"user"`
+	Year           int      `json:"year"`
+	Days           int      `json:"days_tracked"`
+	OwnsGained     int      `json:"owns_gained"`
+	BloodsGained   int      `json:"bloods_gained"`
+	ChallengesDone int      `json:"challenges_solved"`
+	BestRank       int      `json:"best_global_rank,omitempty"`
+	BestRankDate   string   `json:"best_global_rank_date,omitempty"`
+	BestLocalRank  int      `json:"best_country_rank,omitempty"`
+	BusiestMonth   string   `json:"busiest_month,omitempty"`
+	BusiestOwns    int      `json:"busiest_month_owns,omitempty"`
+	Badges         []string `json:"badges_earned"`
+	Summary        string   `json:"summary"`
+}
+
+// gained sums the increases of value between consecutive points, so a reset
+// or an anomalous dip doesn’t cancel out real progress.
+func gained(points []map[string]interface{}, value func(map[string]interface{}) (float64, bool)) int {
+	total := 0.0
+	var last float64
+	have := false
+	for _, p := range points {
+		v, ok := value(p)
+		if !ok {
+			continue
+		}
+		if have && v > last {
+			total += v - last
+		}
+		last, have = v, true
+	}
+	return int(total)
+}
+
+func fieldValue(field string) func(map[string]interface{}) (float64, bool) {
+	return func(item map[string]interface{}) (float64, bool) { return toFloat(item[field]) }
+}
+
+// reviewYear summarises year from a date‑ordered series that starts with the
+// last snapshot of the year before, when there is one, as the baseline.
+func reviewYear(user string, year int, points []map[string]interface{}) yearReview {
+	r := yearReview{User: user, Year: year, Badges: []string{}}
+	prefix := strconv.Itoa(year)
+	var inYear []map[string]interface{}
+	for _, p := range points {
+		if strings.HasPrefix(p["date"].(string), prefix) {
+			inYear = append(inYear, p)
+		}
+	}
+	r.Days = len(inYear)
+
+	r.OwnsGained = gained(points, totalOwns)
+	r.BloodsGained = gained(points, fieldValue("System_Bloods")) + gained(points, fieldValue("User_Bloods"))
+	r.ChallengesDone = gained(points, fieldValue("Challenge_Owns"))
+
+	for _, p := range inYear {
+		if rank, ok := toFloat(p["User_Global_Rank"]); ok && rank > 0 && (r.BestRank == 0 || int(rank) < r.BestRank) {
+			r.BestRank, r.BestRankDate = int(rank), p["date"].(string)
+		}
+		if rank, ok := toFloat(p["Local_Rank"]); ok && rank > 0 && (r.BestLocalRank == 0 || int(rank) < r.BestLocalRank) {
+			r.BestLocalRank = int(rank)
+		}
+	}
+	for _, m := range aggregate(points, "month") {
+		if strings.HasPrefix(m.Period, prefix) && m.OwnsGained > r.BusiestOwns {
+			r.BusiestMonth, r.BusiestOwns = m.Period, m.OwnsGained
+		}
+	}
+
+	// badges: the first snapshot with badge data against the last one
+	var first map[string]interface{}
+	for _, p := range points {
+		if _, ok := p["Badges"].([]interface{}); ok {
+			first = p
+			break
+		}
+	}
+	if first != nil && len(inYear) > 0 {
+		for _, c := range detectNewBadges(first, inYear[len(inYear)-1]) {
+			r.Badges = append(r.Badges, formatValue(c.New))
+		}
+	}
+
+	r.Summary = tr("review.summary", year, r.OwnsGained, r.BloodsGained, r.ChallengesDone, len(r.Badges))
+	if r.BestRank > 0 {
+		r.Summary += " " + tr("review.best_rank", r.BestRank)
+	}
+	if r.BusiestMonth != "" {
+		r.Summary += " " + tr("review.busiest", r.BusiestMonth, r.BusiestOwns)
+	}
+	return r
+}
+
+// reviewHandler serves /review/<year>[?user=ID]: a shareable summary of a
+// calendar year — owns, bloods and challenges gained, best ranks, the busiest
+// month and the badges earned.
+func reviewHandler(ctx context.Context, inv invocation) (map[string]interface{}, error) {
+	tableName := os.Getenv("TABLE_NAME")
+	if tableName == "" {
+		return httpResponse(http.StatusInternalServerError, map[string]string{"error": "TABLE_NAME not configured"}), nil
+	}
+	year, err := strconv.Atoi(strings.TrimPrefix(inv.RawPath, "/review/"))
+	now := time.Now().In(dateLocation())
+	if err != nil || year < 2017 || year > now.Year() {
+		return httpResponse(http.StatusBadRequest, map[string]string{"error": "want /review/<year>"}), nil
+	}
+	user, ok := requestedUser(inv)
+	if !ok {
+		return httpResponse(http.StatusNotFound, map[string]string{"error": "unknown user"}), nil
+	}
+	// the gains and badges make up the review; best ranks are left out when
+	// private
+	if denied := requireVisible(inv, "System_Owns", "User_Owns", "System_Bloods", "User_Bloods", "Challenge_Owns", "Badges"); denied != nil {
+		return denied, nil
+	}
+
+	// Dec 31 of the year before is the baseline for what was gained
+	from := time.Date(year-1, 12, 31, 0, 0, 0, 0, time.UTC)
+	to := time.Date(year, 12, 31, 0, 0, 0, 0, time.UTC)
+	if today, _ := time.Parse("2006-01-02", now.Format("2006-01-02")); to.After(today) {
+		to = today
+	}
+	items, err := loadRange(ctx, tableName, user, from, to)
+	if err != nil {
+		slog.ErrorContext(ctx, "BatchGetItem failed", "region", awsRegion, "table", tableName, "error", err)
+		return httpResponse(http.StatusInternalServerError, map[string]string{"error": "Database lookup failed", "detail": err.Error()}), nil
+	}
+	return httpResponse(http.StatusOK, reviewYear(user, year, visibleSeries(inv, series(items)))), nil
+}
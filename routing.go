@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+)
+
+// Event kinds that routes can be defined for.
+const (
+	kindRank      = "rank"
+	kindStats     = "stats"
+	kindBlood     = "blood"
+	kindBadge     = "badge"
+	kindMilestone = "milestone"
+	kindGoal      = "goal"
+	kindAnomaly   = "anomaly"
+	kindFailure   = "failure"
+	kindToken     = "token"
+	kindDigest    = "digest"
+)
+
+// Change.Field values for operational notices, which carry a message in
+// Detail rather than an old and new value.
+const (
+	failureField       = "Fetch_Failed"
+	tokenField         = "Token_Invalid"
+	tokenExpiringField = "Token_Expiring"
+)
+
+// isNotice reports whether c is an operational notice rather than a stat.
+func isNotice(c Change) bool {
+	return c.Field == failureField || c.Field == tokenField || c.Field == tokenExpiringField || c.Field == anomalyField
+}
+
+// isOneOff reports whether c is an event without a before/after value —
+// a badge, a milestone, a goal or a notice — which is never merged with another.
+func isOneOff(c Change) bool {
+	return c.Field == badgeField || c.Field == milestoneField || c.Field == goalField || isNotice(c)
+}
+
+// operatorChannels only receive the kinds routed to them, never the implicit
+// "every channel" fallback used for stat changes.
+var operatorChannels = map[string]bool{"pagerduty": true, "opsgenie": true, "email": true}
+
+// defaultRoutes apply to kinds missing from NOTIFY_ROUTES. Failures and the
+// digest are opt‑in everywhere except the event bus and email respectively;
+// a rejected token pages the operator channels.
+var defaultRoutes = map[string][]string{
+	kindFailure: {"eventbridge"},
+	kindToken:   {"eventbridge", "pagerduty", "opsgenie", "email"},
+	kindDigest:  {"email"},
+}
+
+var (
+	routesMutex  sync.Mutex
+	routesSource *string
+	notifyRoutes map[string][]string
+)
+
+// loadRoutes parses NOTIFY_ROUTES or NOTIFY_ROUTES_FILE, a map from event
+// kind (or "*") to the channel names that should receive it, again whenever
+// either changes.
+func loadRoutes() map[string][]string {
+	routesMutex.Lock()
+	defer routesMutex.Unlock()
+	if src := settingSource("NOTIFY_ROUTES"); routesSource == nil || *routesSource != src {
+		routesSource, notifyRoutes = &src, nil
+		if err := loadYAMLSetting("NOTIFY_ROUTES", &notifyRoutes); err != nil {
+			slog.Error("loading notification routes failed", "error", err)
+			notifyRoutes = nil
+		}
+	}
+	return notifyRoutes
+}
+
+// changeKind classifies a change for routing.
+func changeKind(c Change) string {
+	switch {
+	case c.Field == failureField:
+		return kindFailure
+	case c.Field == tokenField, c.Field == tokenExpiringField:
+		return kindToken
+	case c.Field == anomalyField:
+		return kindAnomaly
+	case c.Field == badgeField:
+		return kindBadge
+	case c.Field == milestoneField:
+		return kindMilestone
+	case c.Field == goalField:
+		return kindGoal
+	case rankFields[c.Field]:
+		return kindRank
+	}
+	if _, ok := bloodFields[c.Field]; ok {
+		if improved, _ := c.Improved(); improved {
+			return kindBlood
+		}
+	}
+	return kindStats
+}
+
+// routed reports whether events of kind should go to channel. Kinds without
+// an explicit route use their default, then the "*" route, and finally every
+// non‑operator channel.
+func routed(kind, channel string) bool {
+	routes := loadRoutes()
+	sinks, ok := routes[kind]
+	if !ok {
+		sinks, ok = defaultRoutes[kind]
+	}
+	if !ok {
+		sinks, ok = routes["*"]
+	}
+	if !ok {
+		return !operatorChannels[channel]
+	}
+	for _, s := range sinks {
+		if s == channel || s == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// routeChanges keeps the changes whose kind is routed to channel and whose
+// user, if any, hasn’t limited their channels to others.
+func routeChanges(changes []Change, channel string) []Change {
+	var out []Change
+	for _, c := range changes {
+		if routed(changeKind(c), channel) && (c.User == "" || userChannel(c.User, channel)) {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// notifyFailure reports a failed HTB refresh to the channels routed for
+// failures.
+func notifyFailure(ctx context.Context, err error) {
+	notifyChanges(ctx, []Change{{Field: failureField, Detail: err.Error()}})
+}
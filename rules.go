@@ -0,0 +1,132 @@
+package main
+
+import (
+	"log/slog"
+	"math"
+	"os"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Rule decides whether a change to Field is worth a notification. Field "*"
+// matches every tracked field.
+//
+//	changed      any movement (the default)
+//	improved     the stat moved in the good direction (e.g. rank promotion)
+//	worsened     the stat moved in the bad direction
+//	enters_below new value <= Value while the old one was above it (top N)
+//	leaves_below old value <= Value while the new one is above it
+//	multiple_of  the stat crossed a multiple of Value (every 50th own)
+//	min_delta    the stat moved by at least Value
+type Rule struct {
+	Field string  `yaml:"field" json:"field"`
+	When  string  `yaml:"when" json:"when"`
+	Value float64 `yaml:"value" json:"value"`
+}
+
+var (
+	rulesMutex  sync.Mutex
+	rulesSource *string
+	notifyRules []Rule
+)
+
+// loadRules parses NOTIFY_RULES or NOTIFY_RULES_FILE, again whenever either
+// changes. Errors are logged and leave the rule set empty so nothing is
+// silently dropped.
+func loadRules() []Rule {
+	rulesMutex.Lock()
+	defer rulesMutex.Unlock()
+	if src := settingSource("NOTIFY_RULES"); rulesSource == nil || *rulesSource != src {
+		rulesSource, notifyRules = &src, nil
+		if err := loadYAMLSetting("NOTIFY_RULES", &notifyRules); err != nil {
+			slog.Error("loading notification rules failed", "error", err)
+			notifyRules = nil
+		}
+	}
+	return notifyRules
+}
+
+// settingSource identifies what loadYAMLSetting would read for env — the
+// inline value, or the file with its modification time — so a parsed setting
+// can tell when SSM or a config reload has changed it.
+func settingSource(env string) string {
+	if v := os.Getenv(env); v != "" {
+		return v
+	}
+	path := os.Getenv(env + "_FILE")
+	if info, err := os.Stat(path); err == nil {
+		return path + "@" + info.ModTime().String()
+	}
+	return path
+}
+
+// loadYAMLSetting decodes the inline JSON or YAML in env or, failing that,
+// the file named by env+"_FILE" into target. Neither being set is not an
+// error and leaves target untouched.
+func loadYAMLSetting(env string, target interface{}) error {
+	raw := []byte(os.Getenv(env))
+	if len(raw) == 0 {
+		path := os.Getenv(env + "_FILE")
+		if path == "" {
+			return nil
+		}
+		var err error
+		if raw, err = os.ReadFile(path); err != nil {
+			return err
+		}
+	}
+	// YAML is a superset of JSON, so one decoder covers both
+	return yaml.Unmarshal(raw, target)
+}
+
+// filterChanges keeps only the changes matched by at least one rule. With no
+// rules configured every change passes.
+func filterChanges(changes []Change, rules []Rule) []Change {
+	if len(rules) == 0 {
+		return changes
+	}
+	var kept []Change
+	for _, c := range changes {
+		// rules are about stat movement; operational notices always pass
+		if isNotice(c) {
+			kept = append(kept, c)
+			continue
+		}
+		for _, r := range rules {
+			if (r.Field == c.Field || r.Field == "*") && r.matches(c) {
+				kept = append(kept, c)
+				break
+			}
+		}
+	}
+	return kept
+}
+
+func (r Rule) matches(c Change) bool {
+	if r.When == "" || r.When == "changed" {
+		return true
+	}
+	improved, ok := c.Improved()
+	oldF, okOld := statValue(c.Field, c.Old)
+	newF, okNew := statValue(c.Field, c.New)
+	if !ok || !okOld || !okNew {
+		return false
+	}
+	switch r.When {
+	case "improved":
+		return improved
+	case "worsened":
+		return !improved
+	case "enters_below":
+		return oldF > r.Value && newF <= r.Value
+	case "leaves_below":
+		return oldF <= r.Value && newF > r.Value
+	case "multiple_of":
+		return r.Value > 0 && math.Floor(oldF/r.Value) != math.Floor(newF/r.Value)
+	case "min_delta":
+		return math.Abs(newF-oldF) >= r.Value
+	}
+	slog.Warn("unknown notification rule condition", "when", r.When)
+	return false
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// eventsSchema is the JSON Schema for ChangeEvent, served at
+// /schema/events.json so consumers can validate against it.
+//
+//go:embed schema/events.json
+var eventsSchema string
+
+func schemaResponse() map[string]interface{} {
+	return map[string]interface{}{
+		"statusCode": http.StatusOK,
+		"headers":    map[string]string{"Content-Type": "application/schema+json"},
+		"body":       eventsSchema,
+	}
+}
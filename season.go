@@ -0,0 +1,134 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"strconv"
+)
+
+// seasonTiers lists HTB season leagues from lowest to highest.
+var seasonTiers = []string{"Bronze", "Silver", "Gold", "Platinum", "Ruby", "Holo"}
+
+// seasonTrackingEnabled reports whether TRACK_SEASON switches on the
+// extra season calls per refresh.
+func seasonTrackingEnabled() bool {
+	return os.Getenv("TRACK_SEASON") == "true"
+}
+
+// seasonTopN is the season leaderboard size whose entry and exit is alerted,
+// from SEASON_TOP_N (default 100).
+func seasonTopN() float64 {
+	if n, err := strconv.Atoi(os.Getenv("SEASON_TOP_N")); err == nil && n > 0 {
+		return float64(n)
+	}
+	return 100
+}
+
+// errNotTokenOwner skips the season calls for a user fetched with someone
+// else’s token.
+var errNotTokenOwner = errors.New("the app token belongs to another user")
+
+// fetchSeason adds Season_ID, Season_Name, Season_Start, Season_Tier,
+// Season_Rank, Season_Points and Season_Machines for the active season to
+// info. HTB only serves the season standing of the app token’s owner, so
+// for any other user — one tracked with the shared token — nothing is added
+// and errNotTokenOwner is returned. Failures leave the fields out and are
+// returned; without an active season there is nothing to add.
+func fetchSeason(doGet func(string, interface{}) error, userID string, info map[string]interface{}) error {
+	var ownerResp struct {
+		Info struct {
+			ID int `json:"id"`
+		} `json:"info"`
+	}
+	if err := doGet(htbAPI("/api/v4/user/info"), &ownerResp); err != nil {
+		return err
+	}
+	if strconv.Itoa(ownerResp.Info.ID) != userID {
+		return errNotTokenOwner
+	}
+
+	var listResp struct {
+		Data []struct {
+			ID     int    `json:"id"`
+			Name   string `json:"name"`
+			Start  string `json:"start_date"`
+			Active bool   `json:"active"`
+		} `json:"data"`
+	}
+	if err := doGet(htbAPI("/api/v4/season/list"), &listResp); err != nil {
+		return err
+	}
+	seasonID, name, start := 0, "", ""
+	for _, s := range listResp.Data {
+		if s.Active {
+			seasonID, name, start = s.ID, s.Name, s.Start
+		}
+	}
+	if seasonID == 0 {
+		return nil
+	}
+
+	var rankResp struct {
+		Data struct {
+			League string `json:"league"`
+			Rank   int    `json:"rank"`
+			Points int    `json:"total_season_points"`
+		} `json:"data"`
+	}
+	if err := doGet(htbAPI("/api/v4/season/user/rank/"+strconv.Itoa(seasonID)), &rankResp); err != nil {
+		return err
+	}
+	info["Season_ID"] = seasonID
+	info["Season_Tier"] = rankResp.Data.League
+	info["Season_Rank"] = rankResp.Data.Rank
+	info["Season_Points"] = rankResp.Data.Points
+	if name != "" {
+		info["Season_Name"] = name
+	}
+	if len(start) >= 10 {
+		info["Season_Start"] = start[:10]
+	}
+
+	// machines played: season machines with at least the user flag
+	var machinesResp struct {
+		Data []struct {
+			UserOwned bool `json:"is_owned_user"`
+			RootOwned bool `json:"is_owned_root"`
+		} `json:"data"`
+	}
+	if err := doGet(htbAPI("/api/v4/season/machines"), &machinesResp); err == nil {
+		played := 0
+		for _, m := range machinesResp.Data {
+			if m.UserOwned || m.RootOwned {
+				played++
+			}
+		}
+		info["Season_Machines"] = played
+	}
+	return nil
+}
+
+// detectSeasonChanges reports tier promotions/demotions and entering or
+// leaving the season top N. Snapshots from different seasons aren’t compared.
+func detectSeasonChanges(prev, curr map[string]interface{}) []Change {
+	if prev["Season_ID"] == nil || !sameValue(prev["Season_ID"], curr["Season_ID"]) {
+		return nil
+	}
+	var changes []Change
+	if !sameValue(prev["Season_Tier"], curr["Season_Tier"]) {
+		changes = append(changes, Change{Field: "Season_Tier", Old: prev["Season_Tier"], New: curr["Season_Tier"]})
+	}
+
+	oldRank, okOld := toFloat(prev["Season_Rank"])
+	newRank, okNew := toFloat(curr["Season_Rank"])
+	if okOld && okNew && oldRank > 0 && newRank > 0 {
+		top := seasonTopN()
+		switch {
+		case oldRank > top && newRank <= top:
+			changes = append(changes, Change{Field: "Season_Rank", Old: prev["Season_Rank"], New: curr["Season_Rank"], Detail: tr("entered_top", int(top))})
+		case oldRank <= top && newRank > top:
+			changes = append(changes, Change{Field: "Season_Rank", Old: prev["Season_Rank"], New: curr["Season_Rank"], Detail: tr("left_top", int(top))})
+		}
+	}
+	return changes
+}
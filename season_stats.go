@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// seasonWeek is one week of a season’s cumulative standing, taken from the
+// week’s last snapshot.
+type seasonWeek struct {
+	Week         int    `json:"week"`
+	From         string `json:"from"`
+	To           string `json:"to"`
+	Points       int    `json:"points"`
+	PointsGained int    `json:"points_gained"`
+	Machines     int    `json:"machines_played"`
+	Rank         int    `json:"rank,omitempty"`
+	Tier         string `json:"tier,omitempty"`
+}
+
+// seasonStats is the /season response.
+type seasonStats struct {
+	ID       int          `json:"id"`
+	Name     string       `json:"name,omitempty"`
+	Start    string       `json:"start,omitempty"`
+	Points   int          `json:"points"`
+	Machines int          `json:"machines_played"`
+	Rank     int          `json:"rank,omitempty"`
+	BestRank int          `json:"best_rank,omitempty"`
+	Tier     string       `json:"tier,omitempty"`
+	Weeks    []seasonWeek `json:"weeks"`
+}
+
+// seasonSummary folds the snapshots of season id into weekly cumulative
+// standings. Weeks are counted from the season start (or its first snapshot),
+// and snapshots of any other season are ignored, so totals restart with
+// every new season.
+func seasonSummary(id int, points []map[string]interface{}) (seasonStats, bool) {
+	s := seasonStats{ID: id, Weeks: []seasonWeek{}}
+	var start time.Time
+	lastPoints := 0
+	for _, p := range points {
+		if sid, ok := toFloat(p["Season_ID"]); !ok || int(sid) != id {
+			continue
+		}
+		date := p["date"].(string)
+		d, err := time.Parse("2006-01-02", date)
+		if err != nil {
+			continue
+		}
+		if start.IsZero() {
+			start = d
+			if st, err := time.Parse("2006-01-02", formatValue(p["Season_Start"])); err == nil && st.Before(d) {
+				start = st
+			}
+			s.Start = start.Format("2006-01-02")
+		}
+		if name, ok := p["Season_Name"].(string); ok {
+			s.Name = name
+		}
+
+		num := func(field string) int {
+			f, _ := toFloat(p[field])
+			return int(f)
+		}
+		week := int(d.Sub(start).Hours()/24)/7 + 1
+		if n := len(s.Weeks); n == 0 || s.Weeks[n-1].Week != week {
+			s.Weeks = append(s.Weeks, seasonWeek{Week: week, From: date})
+		}
+		w := &s.Weeks[len(s.Weeks)-1]
+		w.To = date
+		w.Points = num("Season_Points")
+		w.PointsGained += max(w.Points-lastPoints, 0)
+		lastPoints = w.Points
+		w.Machines = num("Season_Machines")
+		w.Rank = num("Season_Rank")
+		w.Tier, _ = p["Season_Tier"].(string)
+
+		s.Points, s.Machines, s.Rank, s.Tier = w.Points, w.Machines, w.Rank, w.Tier
+		if w.Rank > 0 && (s.BestRank == 0 || w.Rank < s.BestRank) {
+			s.BestRank = w.Rank
+		}
+	}
+	return s, len(s.Weeks) > 0
+}
+
+// seasonHandler serves /season/current and /season/<id>[?user=ID]: points,
+// machines played and placement week by week through a season, from the
+// snapshots of the last maxHistoryDays days.
+func seasonHandler(ctx context.Context, inv invocation) (map[string]interface{}, error) {
+	tableName := os.Getenv("TABLE_NAME")
+	if tableName == "" {
+		return httpResponse(http.StatusInternalServerError, map[string]string{"error": "TABLE_NAME not configured"}), nil
+	}
+	which := strings.TrimPrefix(inv.RawPath, "/season/")
+	id, err := strconv.Atoi(which)
+	if which != "current" && (err != nil || id <= 0) {
+		return httpResponse(http.StatusBadRequest, map[string]string{"error": "want /season/current or /season/<id>"}), nil
+	}
+	user, ok := requestedUser(inv)
+	if !ok {
+		return httpResponse(http.StatusNotFound, map[string]string{"error": "unknown user"}), nil
+	}
+	// the rank and tier are left out when private
+	if denied := requireVisible(inv, "Season_ID", "Season_Points", "Season_Machines"); denied != nil {
+		return denied, nil
+	}
+
+	to := currentDay()
+	items, err := loadRange(ctx, tableName, user, to.AddDate(0, 0, -maxHistoryDays), to)
+	if err != nil {
+		slog.ErrorContext(ctx, "BatchGetItem failed", "region", awsRegion, "table", tableName, "error", err)
+		return httpResponse(http.StatusInternalServerError, map[string]string{"error": "Database lookup failed", "detail": err.Error()}), nil
+	}
+	points := visibleSeries(inv, series(items))
+	if which == "current" {
+		for i := len(points) - 1; i >= 0 && id == 0; i-- {
+			if sid, ok := toFloat(points[i]["Season_ID"]); ok {
+				id = int(sid)
+			}
+		}
+	}
+	stats, ok := seasonSummary(id, points)
+	if !ok {
+		return httpResponse(http.StatusNotFound, map[string]string{"error": "no snapshots for that season (is TRACK_SEASON on?)"}), nil
+	}
+	return httpResponse(http.StatusOK, stats), nil
+}
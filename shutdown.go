@@ -0,0 +1,16 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+)
+
+// onShutdown is the Lambda SIGTERM hook, run before the runtime retires
+// the container. It only logs the shutdown and closes idle connections to
+// HTB and the notification endpoints; it doesn’t drain anything, as the
+// runtime only shuts down between invocations, when no refresh is in
+// flight. Graceful shutdown of a server mode isn’t implemented: there is none.
+func onShutdown() {
+	slog.Info("container shutting down")
+	http.DefaultClient.CloseIdleConnections()
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+)
+
+var (
+	ssmMutex sync.Mutex
+	// ssmLoaded is when parameters were last read, or a read last failed
+	ssmLoaded time.Time
+	// ssmValues are the variables set from the last read, ssmShadowed the
+	// function’s own values they replaced
+	ssmValues   = map[string]string{}
+	ssmShadowed = map[string]string{}
+)
+
+// ssmConfigTTL is how long parameters read from CONFIG_SSM_PATH are used
+// before they are read again, from CONFIG_SSM_TTL (default 5m).
+func ssmConfigTTL() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("CONFIG_SSM_TTL")); err == nil && d > 0 {
+		return d
+	}
+	return 5 * time.Minute
+}
+
+// loadSSMConfig copies every parameter under CONFIG_SSM_PATH into the
+// environment, named after the last path segment (/htb/prod/USER_ID →
+// USER_ID), so TABLE_NAME, USER_ID and the feature flags can change without a
+// redeploy. It runs at cold start and again once the TTL has passed, and a
+// parameter deleted since the last read falls back to the function’s own
+// value, if any. A failed read keeps the values loaded last and, like a
+// successful one, isn’t repeated until the TTL has passed, so a missing
+// permission or throttling doesn’t cost every invocation another call.
+func loadSSMConfig(ctx context.Context) {
+	prefix := os.Getenv("CONFIG_SSM_PATH")
+	if prefix == "" {
+		return
+	}
+	ssmMutex.Lock()
+	defer ssmMutex.Unlock()
+	if !ssmLoaded.IsZero() && time.Since(ssmLoaded) < ssmConfigTTL() {
+		return
+	}
+
+	values := map[string]string{}
+	paginator := ssm.NewGetParametersByPathPaginator(ssm.NewFromConfig(awsCfg), &ssm.GetParametersByPathInput{
+		Path:           aws.String("/" + strings.Trim(prefix, "/")),
+		Recursive:      aws.Bool(true),
+		WithDecryption: aws.Bool(true),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			slog.ErrorContext(ctx, "reading SSM parameters failed", "prefix", prefix, "error", err)
+			ssmLoaded = time.Now()
+			return
+		}
+		for _, p := range page.Parameters {
+			values[path.Base(aws.ToString(p.Name))] = aws.ToString(p.Value)
+		}
+	}
+	for name, value := range values {
+		// the path itself must stay put
+		if name != "CONFIG_SSM_PATH" {
+			if _, ours := ssmValues[name]; !ours {
+				if own, set := os.LookupEnv(name); set {
+					ssmShadowed[name] = own
+				}
+			}
+			os.Setenv(name, value)
+		}
+	}
+	for name, old := range ssmValues {
+		if _, kept := values[name]; kept || os.Getenv(name) != old {
+			continue
+		}
+		if own, ok := ssmShadowed[name]; ok {
+			os.Setenv(name, own)
+			delete(ssmShadowed, name)
+		} else {
+			os.Unsetenv(name)
+		}
+	}
+	ssmValues, ssmLoaded = values, time.Now()
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// streakState is persisted per user under the "streak#<user>" key. LastDay
+// and LastWeek are the latest day ("2006-01-02") and ISO week ("2024-W05")
+// with at least one new own.
+type streakState struct {
+	Day         int    `json:"day"`
+	LongestDay  int    `json:"longest_day"`
+	Week        int    `json:"week"`
+	LongestWeek int    `json:"longest_week"`
+	LastDay     string `json:"last_day"`
+	LastWeek    string `json:"last_week"`
+}
+
+// gainedOwn reports whether curr has more machine or challenge owns than prev.
+func gainedOwn(prev, curr map[string]interface{}) bool {
+	oldOwns, okOld := totalOwns(prev)
+	newOwns, okNew := totalOwns(curr)
+	if okOld && okNew && newOwns > oldOwns {
+		return true
+	}
+	oldC, okOld := toFloat(prev["Challenge_Owns"])
+	newC, okNew := toFloat(curr["Challenge_Owns"])
+	return okOld && okNew && newC > oldC
+}
+
+// advance records a gain on day. Repeated calls for the same day or week
+// (forced refreshes) leave the counts alone.
+func (s *streakState) advance(day time.Time) {
+	today := day.Format("2006-01-02")
+	if s.LastDay != today {
+		if s.LastDay == day.AddDate(0, 0, -1).Format("2006-01-02") {
+			s.Day++
+		} else {
+			s.Day = 1
+		}
+		s.LastDay = today
+	}
+	week := periodKey("week", day)
+	if s.LastWeek != week {
+		if s.LastWeek == periodKey("week", day.AddDate(0, 0, -7)) {
+			s.Week++
+		} else {
+			s.Week = 1
+		}
+		s.LastWeek = week
+	}
+	s.LongestDay = max(s.LongestDay, s.Day)
+	s.LongestWeek = max(s.LongestWeek, s.Week)
+}
+
+// fields returns the streaks as of day. A streak whose last gain was
+// yesterday (or last week) is still alive, since today can continue it.
+func (s streakState) fields(day time.Time) map[string]interface{} {
+	current, currentWeek := 0, 0
+	if s.LastDay == day.Format("2006-01-02") || s.LastDay == day.AddDate(0, 0, -1).Format("2006-01-02") {
+		current = s.Day
+	}
+	if s.LastWeek == periodKey("week", day) || s.LastWeek == periodKey("week", day.AddDate(0, 0, -7)) {
+		currentWeek = s.Week
+	}
+	return map[string]interface{}{
+		"Current_Streak":      current,
+		"Longest_Streak":      s.LongestDay,
+		"Current_Week_Streak": currentWeek,
+		"Longest_Week_Streak": s.LongestWeek,
+	}
+}
+
+// updateStreaks advances userID’s own streaks if curr gained an own over
+// prev, and returns the streak fields to store with the snapshot.
+func updateStreaks(ctx context.Context, tableName, userID string, day time.Time, prev, curr map[string]interface{}) map[string]interface{} {
+	key := userStateKey("streak", userID)
+	item, err := loadItem(ctx, tableName, key)
+	if err != nil {
+		slog.ErrorContext(ctx, "GetItem failed", "region", awsRegion, "table", tableName, "key", key, "error", err)
+		return nil
+	}
+	var state streakState
+	if raw, ok := item["state"].(string); ok {
+		if err := json.Unmarshal([]byte(raw), &state); err != nil {
+			slog.ErrorContext(ctx, "decoding item failed", "key", key, "error", err)
+		}
+	}
+
+	if gainedOwn(prev, curr) {
+		state.advance(day)
+		if err := saveStreakState(ctx, tableName, key, state); err != nil {
+			slog.ErrorContext(ctx, "saving item failed", "key", key, "error", err)
+		}
+	}
+	return state.fields(day)
+}
+
+func saveStreakState(ctx context.Context, tableName, key string, state streakState) error {
+	raw, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("encoding streak: %w", err)
+	}
+	_, err = dynamoClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(tableName),
+		Item: map[string]types.AttributeValue{
+			"date":  &types.AttributeValueMemberS{Value: key},
+			"state": &types.AttributeValueMemberS{Value: string(raw)},
+		},
+	})
+	return err
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+var (
+	revalidateMutex sync.Mutex
+	revalidating    = map[string]time.Time{}
+)
+
+// staleWhileRevalidate answers for a day whose stats aren’t stored yet
+// without waiting on HTB: it queues the day’s refresh on REFRESH_QUEUE_URL
+// and returns yesterday’s snapshot, marked Stale and carrying its own date.
+// It returns nil — the caller then fetches as usual — without a queue, without
+// a snapshot from yesterday, or when queueing fails. Each container queues a
+// day’s refresh at most once per FAILURE_TTL; the worker skips it if it is
+// stored by then.
+func staleWhileRevalidate(ctx context.Context, tableName, userID, date string) map[string]interface{} {
+	if os.Getenv("REFRESH_QUEUE_URL") == "" || date != currentDate() {
+		return nil
+	}
+	yesterday := currentDay().AddDate(0, 0, -1).Format("2006-01-02")
+	prev, err := loadItem(ctx, userTable(userID, tableName), itemKey(userID, yesterday))
+	if err != nil || len(prev) <= 1 {
+		return nil
+	}
+
+	key := itemKey(userID, date)
+	revalidateMutex.Lock()
+	last, queued := revalidating[key]
+	queued = queued && time.Since(last) < failureTTL()
+	if !queued {
+		revalidating[key] = time.Now()
+	}
+	revalidateMutex.Unlock()
+	if !queued {
+		if err := enqueueRefresh(ctx, userID, date); err != nil {
+			slog.ErrorContext(ctx, "queueing refresh failed", "user", userID, "error", err)
+			revalidateMutex.Lock()
+			delete(revalidating, key)
+			revalidateMutex.Unlock()
+			return nil
+		}
+	}
+
+	out := make(map[string]interface{}, len(prev)+1)
+	for k, v := range prev {
+		out[k] = v
+	}
+	out["date"] = yesterday
+	out[staleField] = true
+	return out
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	htmltemplate "html/template"
+	"io"
+	"os"
+	"strings"
+	"text/template"
+)
+
+// templateData is what a NOTIFY_TEMPLATE sees. Each change exposes .Field,
+// .Old, .New, .Label, .Arrow and .Summary.
+type templateData struct {
+	User    string
+	Date    string
+	Changes []Change
+}
+
+var templateFuncs = template.FuncMap{
+	"value": formatValue,
+	"join":  strings.Join,
+}
+
+type notifyUserKey struct{}
+
+// withNotifyUser returns ctx for notifications about userID’s refresh.
+func withNotifyUser(ctx context.Context, userID string) context.Context {
+	return context.WithValue(ctx, notifyUserKey{}, userID)
+}
+
+// templateUser is the .User a template sees: the user the changes are
+// tagged with when they all share one, else the user being refreshed, else
+// USER_ID.
+func templateUser(ctx context.Context, changes []Change) string {
+	user := ""
+	for i, c := range changes {
+		if i > 0 && c.User != user {
+			user = ""
+			break
+		}
+		user = c.User
+	}
+	if user == "" {
+		user, _ = ctx.Value(notifyUserKey{}).(string)
+	}
+	if user == "" {
+		user = os.Getenv("USER_ID")
+	}
+	return user
+}
+
+// htmlChannels are the channels whose messages are sent as HTML: Telegram
+// messages, alert emails and the digest email. Their
+// templates are parsed with html/template, so display names, badge names
+// and other values from HTB are escaped and can’t break or inject markup.
+var htmlChannels = map[string]bool{"telegram": true, "email": true, "digest": true}
+
+// parseTemplate parses src as channel’s template.
+func parseTemplate(channel, src string) (interface {
+	Execute(io.Writer, any) error
+}, error) {
+	if htmlChannels[channel] {
+		return htmltemplate.New(channel).Funcs(htmltemplate.FuncMap(templateFuncs)).Parse(src)
+	}
+	return template.New(channel).Funcs(templateFuncs).Parse(src)
+}
+
+// renderTemplate renders the message body for channel from
+// NOTIFY_TEMPLATE_<CHANNEL>, falling back to NOTIFY_TEMPLATE. ok is false
+// when neither is set and the notifier should use its built‑in format.
+func renderTemplate(ctx context.Context, channel string, changes []Change) (msg string, ok bool, err error) {
+	src := os.Getenv("NOTIFY_TEMPLATE_" + strings.ToUpper(channel))
+	if src == "" {
+		src = os.Getenv("NOTIFY_TEMPLATE")
+	}
+	if src == "" {
+		return "", false, nil
+	}
+	tmpl, err := parseTemplate(channel, src)
+	if err != nil {
+		return "", true, err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, templateData{
+		User:    templateUser(ctx, changes),
+		Date:    currentDate(),
+		Changes: changes,
+	}); err != nil {
+		return "", true, err
+	}
+	return buf.String(), true, nil
+}
+
+// messageText returns the channel’s templated body, or the plain summary
+// when no template is configured.
+func messageText(ctx context.Context, channel string, changes []Change) (string, error) {
+	msg, ok, err := renderTemplate(ctx, channel, changes)
+	if !ok {
+		return plainSummary(changes), nil
+	}
+	return msg, err
+}
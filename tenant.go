@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// tenant is one issued API key: who it belongs to, the HTB users it may read
+// (the first is its default) and how many requests it may make a day.
+type tenant struct {
+	Name       string   `json:"name" yaml:"name"`
+	KeySHA256  string   `json:"key_sha256" yaml:"key_sha256"`
+	Users      []string `json:"users" yaml:"users"`
+	DailyQuota int      `json:"daily_quota" yaml:"daily_quota"`
+}
+
+var (
+	tenantsMutex  sync.Mutex
+	tenantsSource *string
+	tenants       []tenant
+)
+
+// loadTenants parses TENANTS or TENANTS_FILE, a list of tenants, again
+// whenever either changes. Entries without a name, key hash or user are
+// logged and dropped.
+func loadTenants() []tenant {
+	tenantsMutex.Lock()
+	defer tenantsMutex.Unlock()
+	if src := settingSource("TENANTS"); tenantsSource == nil || *tenantsSource != src {
+		tenantsSource, tenants = &src, nil
+		var all []tenant
+		if err := loadYAMLSetting("TENANTS", &all); err != nil {
+			slog.Error("loading tenants failed", "error", err)
+		}
+		for _, t := range all {
+			if t.Name == "" || len(t.KeySHA256) != sha256.Size*2 || len(t.Users) == 0 || strings.Contains(t.Name, "#") {
+				slog.Warn("ignoring tenant: want a name without #, a hex key_sha256 and at least one user", "tenant", t.Name)
+				continue
+			}
+			t.KeySHA256 = strings.ToLower(t.KeySHA256)
+			tenants = append(tenants, t)
+		}
+	}
+	return tenants
+}
+
+// tenantUsers lists the users of every tenant, which are tracked alongside
+// the configured ones.
+func tenantUsers() []string {
+	var users []string
+	for _, t := range loadTenants() {
+		users = append(users, t.Users...)
+	}
+	return users
+}
+
+// allows reports whether t may read userID. A nil tenant, i.e. a deployment
+// without tenants or an operator request, may read everyone.
+func (t *tenant) allows(userID string) bool {
+	if t == nil {
+		return true
+	}
+	for _, u := range t.Users {
+		if u == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// tenantExempt are the paths that keep their own authentication, or have
+// nothing to protect, when tenants are configured.
+var tenantExempt = map[string]bool{
+	"/hooks/refresh":      true,
+	"/export":             true,
+	"/schema/events.json": true,
+	"/readyz":             true,
+}
+
+// authorizeTenant resolves the API key of a Function URL request, sent as an
+// X-API-Key header or ?api_key=, once TENANTS is set. It returns the tenant,
+// or nil for an operator holding REFRESH_HOOK_SECRET, and the error response
+// to send instead when the key is missing, unknown or over its quota.
+func authorizeTenant(ctx context.Context, inv invocation) (*tenant, map[string]interface{}) {
+	all := loadTenants()
+	if len(all) == 0 || tenantExempt[inv.RawPath] || hookAuthorized(inv) {
+		return nil, nil
+	}
+	given := inv.Headers["x-api-key"]
+	if given == "" {
+		given = inv.QueryParams["api_key"]
+	}
+	if given == "" {
+		return nil, httpResponse(http.StatusUnauthorized, map[string]string{"error": "API key required"})
+	}
+	sum := sha256.Sum256([]byte(given))
+	hash := []byte(hex.EncodeToString(sum[:]))
+	var match *tenant
+	for i := range all {
+		// compare every key so timing doesn’t reveal which one came close
+		if subtle.ConstantTimeCompare(hash, []byte(all[i].KeySHA256)) == 1 {
+			match = &all[i]
+		}
+	}
+	if match == nil {
+		return nil, httpResponse(http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+	}
+	if !claimQuota(ctx, match) {
+		return nil, httpResponse(http.StatusTooManyRequests, map[string]string{"error": "daily quota exceeded"})
+	}
+	return match, nil
+}
+
+// claimQuota counts a request against t’s daily_quota, reporting false once
+// the day’s allowance is used up. The counter is an item per tenant and day
+// that DynamoDB TTL removes; zero means no quota. Storage errors fail open.
+func claimQuota(ctx context.Context, t *tenant) bool {
+	tableName := os.Getenv("TABLE_NAME")
+	if t.DailyQuota <= 0 || tableName == "" {
+		return true
+	}
+	_, err := dynamoClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(tableName),
+		Key: map[string]types.AttributeValue{
+			"date": &types.AttributeValueMemberS{Value: envKey("quota#" + t.Name + "#" + currentDate())},
+		},
+		UpdateExpression:    aws.String("ADD requests :one SET expires_at = :exp"),
+		ConditionExpression: aws.String("attribute_not_exists(requests) OR requests < :max"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":one": &types.AttributeValueMemberN{Value: "1"},
+			":max": &types.AttributeValueMemberN{Value: strconv.Itoa(t.DailyQuota)},
+			":exp": &types.AttributeValueMemberN{Value: strconv.FormatInt(time.Now().Add(48*time.Hour).Unix(), 10)},
+		},
+	})
+	var condErr *types.ConditionalCheckFailedException
+	if errors.As(err, &condErr) {
+		return false
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "counting tenant requests failed", "tenant", t.Name, "error", err)
+	}
+	return true
+}
+
+// tenantStats serves the root path to a tenant: today’s stats of the user in
+// ?user=, by default the tenant’s first one.
+func tenantStats(ctx context.Context, inv invocation) (map[string]interface{}, error) {
+	user, ok := requestedUser(inv)
+	if !ok {
+		return httpResponse(http.StatusNotFound, map[string]string{"error": "unknown user"}), nil
+	}
+	if user == os.Getenv("USER_ID") {
+		return statsHandler(ctx)
+	}
+	tableName := os.Getenv("TABLE_NAME")
+	if tableName == "" {
+		return nil, &apiError{code: http.StatusInternalServerError, msg: "TABLE_NAME not configured"}
+	}
+	return todaysStats(ctx, tableName, user)
+}
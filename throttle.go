@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// quietWindow is a daily [start, end) window in minutes since midnight; it may
+// wrap past midnight (e.g. 22:00-07:00).
+type quietWindow struct {
+	start, end int
+}
+
+func parseQuietHours(s string) (*quietWindow, error) {
+	parts := strings.Split(s, "-")
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("quiet hours %q: want HH:MM-HH:MM", s)
+	}
+	var w quietWindow
+	for i, p := range parts {
+		t, err := time.Parse("15:04", strings.TrimSpace(p))
+		if err != nil {
+			return nil, fmt.Errorf("quiet hours %q: %v", s, err)
+		}
+		if i == 0 {
+			w.start = t.Hour()*60 + t.Minute()
+		} else {
+			w.end = t.Hour()*60 + t.Minute()
+		}
+	}
+	return &w, nil
+}
+
+func (w *quietWindow) contains(t time.Time) bool {
+	m := t.Hour()*60 + t.Minute()
+	if w.start <= w.end {
+		return m >= w.start && m < w.end
+	}
+	return m >= w.start || m < w.end
+}
+
+// channelLimits are the delivery limits for one notifier, read from
+// QUIET_HOURS[_<CHANNEL>] and NOTIFY_MAX_PER_HOUR[_<CHANNEL>].
+type channelLimits struct {
+	quiet      *quietWindow
+	maxPerHour int
+}
+
+func channelEnv(name, channel string) string {
+	if v := os.Getenv(name + "_" + strings.ToUpper(channel)); v != "" {
+		return v
+	}
+	return os.Getenv(name)
+}
+
+func limitsFor(channel string) channelLimits {
+	var l channelLimits
+	if s := channelEnv("QUIET_HOURS", channel); s != "" {
+		w, err := parseQuietHours(s)
+		if err != nil {
+			slog.Warn("invalid QUIET_HOURS", "channel", channel, "error", err)
+		}
+		l.quiet = w
+	}
+	l.maxPerHour, _ = strconv.Atoi(channelEnv("NOTIFY_MAX_PER_HOUR", channel))
+	return l
+}
+
+func (l channelLimits) active() bool { return l.quiet != nil || l.maxPerHour > 0 }
+
+// throttleState is persisted per channel under the "notify#<channel>" key.
+type throttleState struct {
+	Sent    []time.Time `json:"sent"`
+	Pending []Change    `json:"pending"`
+}
+
+// deliver sends changes through n, honouring the channel's quiet hours and
+// hourly cap. Suppressed changes are queued and collapsed into the next send
+// that is allowed; with no limits configured it just calls Notify.
+func deliver(ctx context.Context, n Notifier, changes []Change) error {
+	limits := limitsFor(n.Name())
+	if !limits.active() {
+		if len(changes) == 0 {
+			return nil
+		}
+		return sendOnce(ctx, n, changes)
+	}
+
+	tableName := os.Getenv("TABLE_NAME")
+	if tableName == "" {
+		return errors.New("TABLE_NAME not configured")
+	}
+	key := envKey("notify#" + n.Name())
+	state, err := loadThrottleState(ctx, tableName, key)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	recent := state.Sent[:0]
+	for _, t := range state.Sent {
+		if now.Sub(t) < time.Hour {
+			recent = append(recent, t)
+		}
+	}
+	state.Sent = recent
+	state.Pending = collapseChanges(append(state.Pending, changes...))
+	if len(state.Pending) == 0 {
+		return saveThrottleState(ctx, tableName, key, state)
+	}
+
+	quiet := limits.quiet != nil && limits.quiet.contains(now.In(dateLocation()))
+	capped := limits.maxPerHour > 0 && len(state.Sent) >= limits.maxPerHour
+	if quiet || capped {
+		return saveThrottleState(ctx, tableName, key, state)
+	}
+
+	// on failure the batch stays pending and goes out with the next send,
+	// unless it was handed to the dead‑letter queue
+	if err := sendOnce(ctx, n, state.Pending); err != nil {
+		if errors.Is(err, errDeadLettered) {
+			state.Pending = nil
+		}
+		if serr := saveThrottleState(ctx, tableName, key, state); serr != nil {
+			slog.ErrorContext(ctx, "saving notification queue failed", "channel", n.Name(), "error", serr)
+		}
+		return err
+	}
+	state.Sent = append(state.Sent, now)
+	state.Pending = nil
+	return saveThrottleState(ctx, tableName, key, state)
+}
+
+// flushNotifications sends any queued changes whose channel is no longer in
+// quiet hours or over its cap. Schedule it (e.g. hourly) with
+// {"action": "flush_notifications"}.
+func flushNotifications(ctx context.Context) (map[string]interface{}, error) {
+	flushed := 0
+	for _, n := range configuredNotifiers() {
+		if err := deliver(ctx, n, nil); err != nil {
+			slog.ErrorContext(ctx, "notification failed", "channel", n.Name(), "error", err)
+			continue
+		}
+		flushed++
+	}
+	return map[string]interface{}{"flushed": flushed}, nil
+}
+
+// collapseChanges merges repeated changes to the same field into one, keeping
+// the oldest Old and newest New, and drops fields that ended where they began.
+func collapseChanges(changes []Change) []Change {
+	var out []Change
+	index := map[string]int{}
+	for _, c := range changes {
+		key := c.User + "/" + c.Field
+		if isOneOff(c) {
+			key += "/" + formatValue(c.New) + "/" + c.Detail
+		}
+		if i, ok := index[key]; ok {
+			out[i].New = c.New
+			if c.Detail != "" {
+				out[i].Detail = c.Detail
+			}
+			continue
+		}
+		index[key] = len(out)
+		out = append(out, c)
+	}
+	kept := out[:0]
+	for _, c := range out {
+		if isOneOff(c) || !sameValue(c.Old, c.New) {
+			kept = append(kept, c)
+		}
+	}
+	return kept
+}
+
+func loadThrottleState(ctx context.Context, tableName, key string) (throttleState, error) {
+	var state throttleState
+	item, err := loadItem(ctx, tableName, key)
+	if err != nil {
+		return state, err
+	}
+	if raw, ok := item["state"].(string); ok {
+		err = json.Unmarshal([]byte(raw), &state)
+	}
+	return state, err
+}
+
+func saveThrottleState(ctx context.Context, tableName, key string, state throttleState) error {
+	raw, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	_, err = dynamoClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(tableName),
+		Item: map[string]types.AttributeValue{
+			"date":  &types.AttributeValueMemberS{Value: key},
+			"state": &types.AttributeValueMemberS{Value: string(raw)},
+		},
+	})
+	return err
+}
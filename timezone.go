@@ -0,0 +1,51 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	// Lambda’s base images don’t ship the zoneinfo database
+	_ "time/tzdata"
+)
+
+var (
+	zoneMutex sync.Mutex
+	zoneName  string
+	zone      = time.Local
+)
+
+// dateLocation is the TIMEZONE (an IANA name such as "Europe/Berlin") the
+// daily date key rolls over in, by default the Lambda’s local time, i.e. UTC.
+// An unknown name is logged and ignored.
+func dateLocation() *time.Location {
+	name := os.Getenv("TIMEZONE")
+	zoneMutex.Lock()
+	defer zoneMutex.Unlock()
+	if name == zoneName {
+		return zone
+	}
+	zoneName, zone = name, time.Local
+	if name != "" {
+		loc, err := time.LoadLocation(name)
+		if err != nil {
+			slog.Warn("invalid TIMEZONE", "value", name, "using", time.Local.String(), "error", err)
+		} else {
+			zone = loc
+		}
+	}
+	return zone
+}
+
+// currentDate is today’s date key, YYYY-MM-DD in dateLocation.
+func currentDate() string {
+	return time.Now().In(dateLocation()).Format("2006-01-02")
+}
+
+// currentDay is currentDate as a UTC midnight, the form date arithmetic on
+// stored keys uses.
+func currentDay() time.Time {
+	day, _ := time.Parse("2006-01-02", currentDate())
+	return day
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+)
+
+var (
+	tokenMutex  sync.Mutex
+	secretCache = map[string]cachedTokens{}
+)
+
+// cachedTokens are the tokens read from one secret and when.
+type cachedTokens struct {
+	primary, secondary string
+	fetched            time.Time
+}
+
+// tokenSecretTTL is how long a token read from Secrets Manager is reused
+// before it is fetched again, from TOKEN_SECRET_TTL (default 15m).
+func tokenSecretTTL() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("TOKEN_SECRET_TTL")); err == nil && d > 0 {
+		return d
+	}
+	return 15 * time.Minute
+}
+
+// appToken returns the primary default HTB app token.
+func appToken(ctx context.Context) (string, error) {
+	primary, _, err := appTokens(ctx)
+	return primary, err
+}
+
+// appTokens returns the default primary HTB app token and the optional
+// secondary one used while rotating: from the secret at TOKEN_SECRET_ARN
+// when set, and from TOKEN and TOKEN_SECONDARY otherwise.
+func appTokens(ctx context.Context) (primary, secondary string, err error) {
+	if arn := os.Getenv("TOKEN_SECRET_ARN"); arn != "" {
+		return secretTokens(ctx, arn)
+	}
+	if token := os.Getenv("TOKEN"); token != "" {
+		return token, os.Getenv("TOKEN_SECONDARY"), nil
+	}
+	return "", "", errors.New("TOKEN not configured")
+}
+
+// secretTokens reads the tokens held by the secret arn, cached for
+// tokenSecretTTL so a rotated secret is picked up without a redeploy.
+func secretTokens(ctx context.Context, arn string) (primary, secondary string, err error) {
+	tokenMutex.Lock()
+	defer tokenMutex.Unlock()
+	cached, ok := secretCache[arn]
+	if ok && time.Since(cached.fetched) < tokenSecretTTL() {
+		return cached.primary, cached.secondary, nil
+	}
+	resp, err := secretsmanager.NewFromConfig(awsCfg).GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(arn),
+	})
+	if err != nil {
+		if ok {
+			// a stale token beats none while Secrets Manager is unreachable
+			return cached.primary, cached.secondary, nil
+		}
+		return "", "", fmt.Errorf("reading secret %s: %w", arn, err)
+	}
+	primary, secondary = parseTokenSecret(aws.ToString(resp.SecretString))
+	if primary == "" {
+		return "", "", fmt.Errorf("secret %s holds no token", arn)
+	}
+	secretCache[arn] = cachedTokens{primary: primary, secondary: secondary, fetched: time.Now()}
+	return primary, secondary, nil
+}
+
+// parseTokenSecret accepts the token as the plain secret string or as a JSON
+// object with a "token" (or "TOKEN") key, as the console’s key/value editor
+// stores it, and an optional "secondary" (or "TOKEN_SECONDARY") key.
+func parseTokenSecret(secret string) (primary, secondary string) {
+	secret = strings.TrimSpace(secret)
+	if !strings.HasPrefix(secret, "{") {
+		return secret, ""
+	}
+	var fields map[string]string
+	if err := json.Unmarshal([]byte(secret), &fields); err != nil {
+		return "", ""
+	}
+	primary, secondary = fields["token"], fields["secondary"]
+	if primary == "" {
+		primary = fields["TOKEN"]
+	}
+	if secondary == "" {
+		secondary = fields["TOKEN_SECONDARY"]
+	}
+	return primary, secondary
+}
+
+// forgetToken drops the cached secrets after HTB rejected a token, so the
+// next refresh reads them again in case one was rotated in the meantime.
+func forgetToken() {
+	tokenMutex.Lock()
+	secretCache = map[string]cachedTokens{}
+	tokenMutex.Unlock()
+}
+
+// tokenExpiry reads the exp claim of a JWT app token. ok is false for tokens
+// that aren’t JWTs or carry no expiry.
+func tokenExpiry(token string) (exp time.Time, ok bool) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return exp, false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return exp, false
+	}
+	var claims struct {
+		Exp float64 `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Exp <= 0 {
+		return exp, false
+	}
+	return time.Unix(int64(claims.Exp), 0).UTC(), true
+}
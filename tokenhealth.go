@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// errUnauthorized is returned when HTB answers 401/403, which almost always
+// means the app token expired or was revoked.
+var errUnauthorized = errors.New("HTB rejected the app token (401/403)")
+
+// authError is the 401 or 403 a request got, matching errUnauthorized.
+// expired is set when the rejected token’s exp claim has passed.
+type authError struct {
+	code    int
+	expired bool
+}
+
+func (e *authError) Error() string {
+	return fmt.Sprintf("HTB rejected the app token (%d)", e.code)
+}
+
+func (e *authError) Is(target error) bool { return target == errUnauthorized }
+
+// guidance tells the operator how to fix the token: regenerate an expired
+// one, replace a revoked one, or check which account a 403 token is for.
+func (e *authError) guidance() string {
+	switch {
+	case e.expired:
+		return tr("auth.expired")
+	case e.code == http.StatusForbidden:
+		return tr("auth.forbidden")
+	}
+	return tr("auth.invalid")
+}
+
+// rejectedToken is the error for a 401 or 403 answered to token.
+func rejectedToken(code int, token string) *authError {
+	exp, ok := tokenExpiry(token)
+	return &authError{code: code, expired: ok && time.Now().After(exp)}
+}
+
+// tokenStatusKey is the table key holding the consecutive auth failure count.
+const tokenStatusKey = "token#status"
+
+// tokenAlertAfter is how many consecutive 401/403 refreshes page the
+// operator, from TOKEN_ALERT_AFTER (default 2).
+func tokenAlertAfter() int {
+	if n, err := strconv.Atoi(os.Getenv("TOKEN_ALERT_AFTER")); err == nil && n > 0 {
+		return n
+	}
+	return 2
+}
+
+// recordTokenResult tracks consecutive auth failures across refreshes and
+// emits a token.invalid notice once the threshold is reached. Any other
+// outcome resets the count.
+func recordTokenResult(ctx context.Context, tableName string, fetchErr error) {
+	key := map[string]types.AttributeValue{
+		"date": &types.AttributeValueMemberS{Value: envKey(tokenStatusKey)},
+	}
+	if !errors.Is(fetchErr, errUnauthorized) {
+		// only write when there is a count to clear
+		_, err := dynamoClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+			TableName:                 aws.String(tableName),
+			Key:                       key,
+			UpdateExpression:          aws.String("SET failures = :zero"),
+			ConditionExpression:       aws.String("failures > :zero"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{":zero": &types.AttributeValueMemberN{Value: "0"}},
+		})
+		var condErr *types.ConditionalCheckFailedException
+		if err != nil && !errors.As(err, &condErr) {
+			slog.ErrorContext(ctx, "resetting token status failed", "error", err)
+		}
+		return
+	}
+
+	resp, err := dynamoClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                 aws.String(tableName),
+		Key:                       key,
+		UpdateExpression:          aws.String("ADD failures :one"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{":one": &types.AttributeValueMemberN{Value: "1"}},
+		ReturnValues:              types.ReturnValueUpdatedNew,
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "recording token failure failed", "error", err)
+		return
+	}
+	failures := 0
+	if n, ok := resp.Attributes["failures"].(*types.AttributeValueMemberN); ok {
+		failures, _ = strconv.Atoi(n.Value)
+	}
+	// alert exactly once per outage, when the threshold is first crossed
+	if failures == tokenAlertAfter() {
+		guidance := tr("auth.invalid")
+		var ae *authError
+		if errors.As(fetchErr, &ae) {
+			guidance = ae.guidance()
+		}
+		notifyChanges(ctx, []Change{{
+			Field:  tokenField,
+			Detail: tr("token_rejected", failures, guidance),
+		}})
+	}
+}
+
+// tokenWarnDays is how many days before the app token expires the operator
+// is warned, from TOKEN_EXPIRY_WARN_DAYS (default 7).
+func tokenWarnDays() int {
+	if n, err := strconv.Atoi(os.Getenv("TOKEN_EXPIRY_WARN_DAYS")); err == nil && n > 0 {
+		return n
+	}
+	return 7
+}
+
+// daysUntil counts whole days from now until t, negative once t has passed.
+func daysUntil(t time.Time) int {
+	return int(math.Floor(time.Until(t).Hours() / 24))
+}
+
+// checkTokenExpiry raises a single token_expiring notice per token once its
+// exp claim is within tokenWarnDays, remembering the warned expiry under
+// the token#status key so every refresh and user doesn’t repeat it.
+func checkTokenExpiry(ctx context.Context, tableName string) {
+	token, err := appToken(ctx)
+	if err != nil {
+		return
+	}
+	exp, ok := tokenExpiry(token)
+	if !ok {
+		return
+	}
+	days := daysUntil(exp)
+	if days > tokenWarnDays() {
+		return
+	}
+	expAt := exp.Format(time.RFC3339)
+	_, err = dynamoClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                 aws.String(tableName),
+		Key:                       map[string]types.AttributeValue{"date": &types.AttributeValueMemberS{Value: envKey(tokenStatusKey)}},
+		UpdateExpression:          aws.String("SET warned_exp = :exp"),
+		ConditionExpression:       aws.String("attribute_not_exists(warned_exp) OR warned_exp <> :exp"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{":exp": &types.AttributeValueMemberS{Value: expAt}},
+	})
+	var condErr *types.ConditionalCheckFailedException
+	if errors.As(err, &condErr) {
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "recording token expiry warning failed", "error", err)
+		return
+	}
+	notifyChanges(ctx, []Change{{
+		Field:  tokenExpiringField,
+		Detail: tr("token_expiring", max(days, 0), exp.Format("2006-01-02")),
+	}})
+}
+
+// logTokenExpiry logs when the app token expires, at cold start.
+func logTokenExpiry(ctx context.Context) {
+	token, err := appToken(ctx)
+	if err != nil {
+		return
+	}
+	if exp, ok := tokenExpiry(token); ok {
+		if days := daysUntil(exp); days <= tokenWarnDays() {
+			slog.WarnContext(ctx, "HTB app token expires soon", "expires", exp.Format(time.RFC3339), "days", days)
+		} else {
+			slog.InfoContext(ctx, "HTB app token expiry", "expires", exp.Format(time.RFC3339))
+		}
+	}
+}
+
+// statusHandler serves /status: when the app tokens expire, where they come
+// from, how many refreshes in a row HTB has rejected them, and the state of
+// the circuit breaker.
+func statusHandler(ctx context.Context, inv invocation) (map[string]interface{}, error) {
+	if inv.tenant != nil {
+		return httpResponse(http.StatusForbidden, map[string]string{"error": "forbidden"}), nil
+	}
+	status := map[string]interface{}{"Token_Source": "env"}
+	if os.Getenv("TOKEN_SECRET_ARN") != "" {
+		status["Token_Source"] = "secretsmanager"
+	}
+	primary, secondary, err := appTokens(ctx)
+	if err != nil {
+		status["Token_Error"] = err.Error()
+	} else if exp, ok := tokenExpiry(primary); ok {
+		status["Token_Expires_At"] = exp.Format(time.RFC3339)
+		status["Token_Days_Left"] = daysUntil(exp)
+		status["Token_Expiring"] = daysUntil(exp) <= tokenWarnDays()
+	}
+	if secondary != "" {
+		status["Token_Secondary"] = true
+		if exp, ok := tokenExpiry(secondary); ok {
+			status["Token_Secondary_Expires_At"] = exp.Format(time.RFC3339)
+		}
+	}
+
+	if tableName := os.Getenv("TABLE_NAME"); tableName != "" {
+		item, err := loadItem(ctx, tableName, envKey(tokenStatusKey))
+		if err != nil {
+			slog.ErrorContext(ctx, "GetItem failed", "region", awsRegion, "table", tableName, "key", envKey(tokenStatusKey), "error", err)
+		}
+		failures, _ := toFloat(item["failures"])
+		status["Token_Failures"] = int(failures)
+		upstream, until := circuitState(ctx, tableName)
+		status["Upstream_Failures"] = upstream
+		status["Circuit_Open"] = time.Now().Before(until)
+		if !until.IsZero() {
+			status["Circuit_Open_Until"] = until.Format(time.RFC3339)
+		}
+	}
+	return httpResponse(http.StatusOK, status), nil
+}
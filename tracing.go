@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-xray-sdk-go/instrumentation/awsv2"
+	"github.com/aws/aws-xray-sdk-go/strategy/ctxmissing"
+	"github.com/aws/aws-xray-sdk-go/xray"
+	"github.com/aws/aws-xray-sdk-go/xraylog"
+)
+
+// setupTracing records an X-Ray subsegment for every AWS call made with
+// cfg’s clients — GetItem, TransactWriteItems, SendMessageBatch and the rest
+// — under the invocation’s segment. Lambda only sends them with active
+// tracing turned on. Outside Lambda, e.g. for validate, there is no segment
+// and the calls are simply not traced.
+func setupTracing(cfg *aws.Config) {
+	xray.Configure(xray.Config{ContextMissingStrategy: ctxmissing.NewDefaultIgnoreErrorStrategy()})
+	xray.SetLogger(xraylog.NewDefaultLogger(os.Stderr, xraylog.LogLevelWarn))
+	awsv2.AWSV2Instrumentor(&cfg.APIOptions)
+}
+
+// tracedTransport records an X-Ray subsegment, with the URL and status, for
+// every HTB request sent through next.
+func tracedTransport(next http.RoundTripper) http.RoundTripper {
+	return xray.RoundTripper(next)
+}
+
+// traceHTBCall runs an HTB call, retries included, in a subsegment named
+// after its endpoint, so a trace shows how long the profile, the country
+// leaderboard and the challenge progress each took.
+func traceHTBCall(ctx context.Context, rawURL string, call func(context.Context) error) error {
+	return xray.Capture(ctx, "HTB "+traceName(logEndpoint(rawURL)), call)
+}
+
+// traceName is an HTB API path without its "/api/v4/" prefix and with IDs
+// and country codes replaced by ":id", so every user’s calls to an endpoint
+// share one name in the X-Ray console.
+func traceName(path string) string {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(path, "/api/v4"), "/"), "/")
+	for i, p := range parts {
+		if strings.ContainsAny(p, "0123456789") || p != "" && strings.ToUpper(p) == p {
+			parts[i] = ":id"
+		}
+	}
+	return strings.Join(parts, "/")
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// trendMetrics maps the public metric names of /trend to snapshot fields.
+// "owns" is the sum of system and user owns.
+var trendMetrics = map[string]string{
+	"global_rank":    "User_Global_Rank",
+	"local_rank":     "Local_Rank",
+	"system_owns":    "System_Owns",
+	"user_owns":      "User_Owns",
+	"owns":           "",
+	"system_bloods":  "System_Bloods",
+	"user_bloods":    "User_Bloods",
+	"challenge_owns": "Challenge_Owns",
+	"season_rank":    "Season_Rank",
+	"season_points":  "Season_Points",
+}
+
+// trendPoint is one day of a chart series. Value is nil for a day without a
+// snapshot unless gaps are filled, in which case Filled marks the carried
+// forward value.
+type trendPoint struct {
+	Date   string      `json:"date"`
+	Value  interface{} `json:"value"`
+	Filled bool        `json:"filled,omitempty"`
+}
+
+func metricValue(metric string, item map[string]interface{}) (float64, bool) {
+	if len(item) <= 1 {
+		return 0, false
+	}
+	if metric == "owns" {
+		return totalOwns(item)
+	}
+	return toFloat(item[trendMetrics[metric]])
+}
+
+// trendSeries returns one point per day from from to to. Missing days hold
+// null, or the previous day’s value when fill is set.
+func trendSeries(items map[string]map[string]interface{}, metric string, from, to time.Time, fill bool) []trendPoint {
+	var points []trendPoint
+	var last interface{}
+	for d := from; !d.After(to); d = d.AddDate(0, 0, 1) {
+		p := trendPoint{Date: d.Format("2006-01-02")}
+		if v, ok := metricValue(metric, items[p.Date]); ok {
+			p.Value = v
+			last = v
+		} else if fill && last != nil {
+			p.Value, p.Filled = last, true
+		}
+		points = append(points, p)
+	}
+	return points
+}
+
+// trendHandler serves /trend?metric=global_rank&days=90[&gaps=fill]
+// [&smooth=rolling|ema&window=7][&user=ID] as a bare [{date, value}] array for
+// Chart.js or ECharts.
+func trendHandler(ctx context.Context, inv invocation) (map[string]interface{}, error) {
+	tableName := os.Getenv("TABLE_NAME")
+	if tableName == "" {
+		return httpResponse(http.StatusInternalServerError, map[string]string{"error": "TABLE_NAME not configured"}), nil
+	}
+	metric := strings.ToLower(inv.QueryParams["metric"])
+	if metric == "" {
+		metric = "global_rank"
+	}
+	field, ok := trendMetrics[metric]
+	if !ok {
+		return httpResponse(http.StatusBadRequest, map[string]string{"error": "unknown metric " + metric}), nil
+	}
+	fields := []string{field}
+	if field == "" {
+		fields = []string{"System_Owns", "User_Owns"}
+	}
+	for _, f := range fields {
+		if !fieldVisible(inv, f) {
+			return fieldForbidden(f), nil
+		}
+	}
+	days := 90
+	if s := inv.QueryParams["days"]; s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			return httpResponse(http.StatusBadRequest, map[string]string{"error": "days must be a positive number"}), nil
+		}
+		days = n
+	}
+	from, to, err := dateRange(inv, days-1)
+	if err != nil {
+		return httpResponse(http.StatusBadRequest, map[string]string{"error": err.Error()}), nil
+	}
+	user, ok := requestedUser(inv)
+	if !ok {
+		return httpResponse(http.StatusNotFound, map[string]string{"error": "unknown user"}), nil
+	}
+
+	items, err := loadRange(ctx, tableName, user, from, to)
+	if err != nil {
+		slog.ErrorContext(ctx, "BatchGetItem failed", "region", awsRegion, "table", tableName, "error", err)
+		return httpResponse(http.StatusInternalServerError, map[string]string{"error": "Database lookup failed", "detail": err.Error()}), nil
+	}
+	window := 7
+	if s := inv.QueryParams["window"]; s != "" {
+		if window, err = strconv.Atoi(s); err != nil || window < 1 {
+			return httpResponse(http.StatusBadRequest, map[string]string{"error": "window must be a positive number of days"}), nil
+		}
+	}
+	fill := inv.QueryParams["gaps"] == "fill"
+	points := trendSeries(items, metric, from, to, fill)
+	switch smooth := inv.QueryParams["smooth"]; smooth {
+	case "":
+	case "rolling":
+		rollingAverage(points, window)
+	case "ema":
+		exponentialAverage(points, window)
+	default:
+		return httpResponse(http.StatusBadRequest, map[string]string{"error": "smooth must be rolling or ema"}), nil
+	}
+	return httpResponse(http.StatusOK, points), nil
+}
+
+// rollingAverage replaces each value with the mean of the values in the
+// window days ending on it. Days without a value stay null.
+func rollingAverage(points []trendPoint, window int) {
+	raw := make([]interface{}, len(points))
+	for i, p := range points {
+		raw[i] = p.Value
+	}
+	for i := range points {
+		if raw[i] == nil {
+			continue
+		}
+		sum, n := 0.0, 0
+		for j := max(0, i-window+1); j <= i; j++ {
+			if v, ok := raw[j].(float64); ok {
+				sum += v
+				n++
+			}
+		}
+		points[i].Value = math.Round(sum/float64(n)*100) / 100
+	}
+}
+
+// exponentialAverage replaces each value with its exponential moving average
+// over a span of window days (alpha = 2/(window+1)). Days without a value stay
+// null and don’t move the average.
+func exponentialAverage(points []trendPoint, window int) {
+	alpha := 2 / float64(window+1)
+	var ema float64
+	started := false
+	for i, p := range points {
+		v, ok := p.Value.(float64)
+		if !ok {
+			continue
+		}
+		if started {
+			ema = alpha*v + (1-alpha)*ema
+		} else {
+			ema, started = v, true
+		}
+		points[i].Value = math.Round(ema*100) / 100
+	}
+}
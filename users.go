@@ -0,0 +1,313 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// usersTTL is how long the user configuration is used before it is read
+// again.
+const usersTTL = 5 * time.Minute
+
+// userConfig is one tracked user beyond the environment variables. Token is
+// a literal app token; TokenRef points at one instead — a Secrets Manager ARN
+// or "env:NAME" — and EncryptedToken holds it encrypted with KMS, base64
+// encoded; each falls back to the default token when empty.
+// Channels, when set, limits this user’s notifications to those channels.
+// KeyPrefix and Table isolate the user’s records under their own key prefix
+// or in their own table, so they can be exported or dropped on their own.
+type userConfig struct {
+	UserID         string   `json:"user_id" yaml:"user_id" dynamodbav:"user_id"`
+	Token          string   `json:"token,omitempty" yaml:"token" dynamodbav:"token,omitempty"`
+	TokenRef       string   `json:"token_ref,omitempty" yaml:"token_ref" dynamodbav:"token_ref,omitempty"`
+	EncryptedToken string   `json:"encrypted_token,omitempty" yaml:"encrypted_token" dynamodbav:"encrypted_token,omitempty"`
+	Channels       []string `json:"channels,omitempty" yaml:"channels" dynamodbav:"channels,omitempty"`
+	Disabled       bool     `json:"disabled,omitempty" yaml:"disabled" dynamodbav:"disabled,omitempty"`
+	KeyPrefix      string   `json:"key_prefix,omitempty" yaml:"key_prefix" dynamodbav:"key_prefix,omitempty"`
+	Table          string   `json:"table,omitempty" yaml:"table" dynamodbav:"table,omitempty"`
+}
+
+var (
+	usersMutex  sync.RWMutex
+	userConfigs map[string]userConfig
+	userOrder   []string
+	usersLoaded time.Time
+
+	// staticUsers come from CONFIG_JSON or CONFIG_S3_URI and are read once,
+	// fileUsers from CONFIG_FILE and tableUsers from USERS_TABLE as last read
+	staticUsers []userConfig
+	fileUsers   []userConfig
+	tableUsers  []userConfig
+)
+
+// loadStaticUsers parses the user list in CONFIG_JSON, or in the object at
+// CONFIG_S3_URI (s3://bucket/key), for deployments managed as code. Unlike
+// table items, a malformed list is an error so a bad deploy fails loudly.
+func loadStaticUsers(ctx context.Context) error {
+	raw := []byte(os.Getenv("CONFIG_JSON"))
+	if uri := os.Getenv("CONFIG_S3_URI"); len(raw) == 0 && uri != "" {
+		bucket, key, ok := strings.Cut(strings.TrimPrefix(uri, "s3://"), "/")
+		if !strings.HasPrefix(uri, "s3://") || !ok || key == "" {
+			return fmt.Errorf("CONFIG_S3_URI %q: want s3://bucket/key", uri)
+		}
+		resp, err := s3.NewFromConfig(awsCfg).GetObject(ctx, &s3.GetObjectInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String(key),
+		})
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", uri, err)
+		}
+		defer resp.Body.Close()
+		if raw, err = io.ReadAll(resp.Body); err != nil {
+			return fmt.Errorf("reading %s: %w", uri, err)
+		}
+	}
+	if len(raw) == 0 {
+		// CONFIG_FILE may have listed users already
+		setUserConfigs()
+		return nil
+	}
+
+	var configs []userConfig
+	if err := json.Unmarshal(raw, &configs); err != nil {
+		return fmt.Errorf("parsing user config: %w", err)
+	}
+	for _, c := range configs {
+		if err := c.validate(); err != nil {
+			return err
+		}
+	}
+	staticUsers = configs
+	setUserConfigs()
+	return nil
+}
+
+// loadUserConfigs reads every item of USERS_TABLE (partition key user_id),
+// so adding a teammate is one PutItem instead of a redeploy. It runs at the
+// start of each invocation and rereads the table once usersTTL has passed;
+// a failed read keeps the users loaded last.
+func loadUserConfigs(ctx context.Context) {
+	tableName := os.Getenv("USERS_TABLE")
+	if tableName == "" {
+		return
+	}
+	usersMutex.RLock()
+	fresh := !usersLoaded.IsZero() && time.Since(usersLoaded) < usersTTL
+	usersMutex.RUnlock()
+	if fresh {
+		return
+	}
+
+	var configs []userConfig
+	paginator := dynamodb.NewScanPaginator(dynamoClient, &dynamodb.ScanInput{TableName: aws.String(tableName)})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			slog.ErrorContext(ctx, "Scan failed", "region", awsRegion, "table", tableName, "error", err)
+			return
+		}
+		var items []userConfig
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &items); err != nil {
+			slog.ErrorContext(ctx, "decoding user configs failed", "table", tableName, "error", err)
+			return
+		}
+		configs = append(configs, items...)
+	}
+	usersMutex.Lock()
+	tableUsers, usersLoaded = configs, time.Now()
+	usersMutex.Unlock()
+	setUserConfigs()
+}
+
+// setUserConfigs installs the users of CONFIG_FILE, CONFIG_JSON and
+// USERS_TABLE, in that order, the later entry winning for a user listed
+// twice. Invalid entries are logged and skipped.
+func setUserConfigs() {
+	usersMutex.RLock()
+	all := append(append(append([]userConfig{}, fileUsers...), staticUsers...), tableUsers...)
+	usersMutex.RUnlock()
+	byID := map[string]userConfig{}
+	var order []string
+	for _, c := range all {
+		if err := c.validate(); err != nil {
+			slog.Warn("skipping user config", "error", err)
+			continue
+		}
+		if _, dup := byID[c.UserID]; !dup {
+			order = append(order, c.UserID)
+		}
+		byID[c.UserID] = c
+	}
+	usersMutex.Lock()
+	userConfigs, userOrder = byID, order
+	usersMutex.Unlock()
+}
+
+func (c userConfig) validate() error {
+	if c.UserID == "" {
+		return errors.New("user_id missing")
+	}
+	if c.TokenRef != "" && !strings.HasPrefix(c.TokenRef, "arn:") && !strings.HasPrefix(c.TokenRef, "env:") {
+		return fmt.Errorf("user %s: token_ref must be a secret ARN or env:NAME", c.UserID)
+	}
+	if strings.Contains(c.KeyPrefix, "#") {
+		return fmt.Errorf("user %s: key_prefix must not contain #", c.UserID)
+	}
+	sources := 0
+	for _, s := range []string{c.Token, c.TokenRef, c.EncryptedToken} {
+		if s != "" {
+			sources++
+		}
+	}
+	if sources > 1 {
+		return fmt.Errorf("user %s: set only one of token, token_ref and encrypted_token", c.UserID)
+	}
+	return nil
+}
+
+// userSettings returns the stored configuration of userID, if any.
+func userSettings(userID string) (userConfig, bool) {
+	usersMutex.RLock()
+	defer usersMutex.RUnlock()
+	c, ok := userConfigs[userID]
+	return c, ok
+}
+
+// userTable returns the table holding userID’s records: their own table
+// when configured, tableName otherwise.
+func userTable(userID, tableName string) string {
+	if c, ok := userSettings(userID); ok && c.Table != "" {
+		return c.Table
+	}
+	return tableName
+}
+
+// userStateKey is the key of a per‑user state item such as streaks or goals:
+// "<name>#<id>", or "<key_prefix>#<name>" to keep it under the user’s prefix.
+func userStateKey(name, userID string) string {
+	if c, ok := userSettings(userID); ok && c.KeyPrefix != "" {
+		return envKey(c.KeyPrefix + "#" + name)
+	}
+	return envKey(name + "#" + userID)
+}
+
+// ownsKey reports whether the table key belongs to userID: anything under
+// their key prefix, or a state item named after them.
+func ownsKey(userID, key string) bool {
+	if c, ok := userSettings(userID); ok && c.KeyPrefix != "" {
+		return strings.HasPrefix(key, envKey(c.KeyPrefix+"#"))
+	}
+	return strings.HasSuffix(key, "#"+userID)
+}
+
+// prefixUser maps the part of a snapshot key before the date back to its
+// user: a configured key_prefix, or else a numeric HTB user ID. Anything
+// else (another environment’s prefix) isn’t a user.
+func prefixUser(prefix string) (string, bool) {
+	usersMutex.RLock()
+	defer usersMutex.RUnlock()
+	for _, c := range userConfigs {
+		if c.KeyPrefix == prefix {
+			return c.UserID, true
+		}
+	}
+	if _, err := strconv.Atoi(prefix); err != nil {
+		return "", false
+	}
+	return prefix, true
+}
+
+// dataTables lists every table snapshots are stored in: tableName and the
+// distinct tables of users configured with their own.
+func dataTables(tableName string) []string {
+	tables := []string{tableName}
+	seen := map[string]bool{tableName: true}
+	for _, user := range configuredUsers() {
+		if t := userTable(user, tableName); !seen[t] {
+			seen[t] = true
+			tables = append(tables, t)
+		}
+	}
+	return tables
+}
+
+// configuredUsers lists every tracked HTB user: USER_ID, any extra IDs in
+// the comma‑separated USER_IDS, the enabled users of CONFIG_FILE, CONFIG_JSON
+// (or CONFIG_S3_URI) and USERS_TABLE, then the discovered team and
+// university members and the users of TENANTS. A discovered member or tenant
+// user can be left out with a disabled user entry.
+func configuredUsers() []string {
+	var users []string
+	seen := map[string]bool{}
+	ids := append([]string{os.Getenv("USER_ID")}, splitList(os.Getenv("USER_IDS"))...)
+	usersMutex.RLock()
+	for _, id := range userOrder {
+		if !userConfigs[id].Disabled {
+			ids = append(ids, id)
+		}
+	}
+	for _, id := range append(discoveredUsers(), tenantUsers()...) {
+		if !userConfigs[id].Disabled {
+			ids = append(ids, id)
+		}
+	}
+	usersMutex.RUnlock()
+	for _, id := range ids {
+		if id != "" && !seen[id] {
+			seen[id] = true
+			users = append(users, id)
+		}
+	}
+	return users
+}
+
+// userTokens returns the app tokens to fetch userID with: the user’s own
+// token, encrypted_token or token_ref when configured, the default ones
+// otherwise.
+func userTokens(ctx context.Context, userID string) (primary, secondary string, err error) {
+	c, ok := userSettings(userID)
+	switch {
+	case ok && c.Token != "":
+		return c.Token, "", nil
+	case ok && c.EncryptedToken != "":
+		token, err := decryptUserToken(ctx, userID, c.EncryptedToken)
+		return token, "", err
+	case ok && strings.HasPrefix(c.TokenRef, "env:"):
+		if token := os.Getenv(strings.TrimPrefix(c.TokenRef, "env:")); token != "" {
+			return token, "", nil
+		}
+		return "", "", fmt.Errorf("%s not configured", strings.TrimPrefix(c.TokenRef, "env:"))
+	case ok && c.TokenRef != "":
+		return secretTokens(ctx, c.TokenRef)
+	}
+	return appTokens(ctx)
+}
+
+// userChannel reports whether changes of userID may go to channel: users
+// without a channel list get every routed channel.
+func userChannel(userID, channel string) bool {
+	c, ok := userSettings(userID)
+	if !ok || len(c.Channels) == 0 {
+		return true
+	}
+	for _, ch := range c.Channels {
+		if ch == channel {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// knownActions are the values of "action" the handler dispatches on.
+var knownActions = map[string]bool{
+	"weekly_digest": true, "flush_notifications": true, "dispatch": true, "backfill": true,
+	"export_parquet": true, "archive": true, "monthly_report": true, "validate": true, "doctor": true,
+}
+
+// fieldProblem is one invalid input: the field, or query parameter, and
+// what is wrong with it.
+type fieldProblem struct {
+	Field   string `json:"field"`
+	Problem string `json:"problem"`
+}
+
+// validationError rejects an event or request before anything runs, listing
+// every problem with it. It answers 400 on the Function URL.
+type validationError struct {
+	problems []fieldProblem
+}
+
+func (e *validationError) Error() string {
+	parts := make([]string, len(e.problems))
+	for i, p := range e.problems {
+		parts[i] = p.Field + ": " + p.Problem
+	}
+	return "invalid event: " + strings.Join(parts, "; ")
+}
+
+func (e *validationError) status() int { return http.StatusBadRequest }
+
+func (e *validationError) response() map[string]interface{} {
+	return map[string]interface{}{"error": "invalid request", "problems": e.problems}
+}
+
+func checkDate(s string) error {
+	if _, err := time.Parse("2006-01-02", s); err != nil {
+		return errors.New("want a date as YYYY-MM-DD")
+	}
+	return nil
+}
+
+// fieldProblems collects the problems found so far.
+type fieldProblems []fieldProblem
+
+func (ps *fieldProblems) check(field, value string, check func(string) error) {
+	if value == "" {
+		return
+	}
+	if err := check(value); err != nil {
+		*ps = append(*ps, fieldProblem{Field: field, Problem: err.Error()})
+	}
+}
+
+func (ps fieldProblems) err() error {
+	if len(ps) == 0 {
+		return nil
+	}
+	return &validationError{problems: ps}
+}
+
+// decodeInvocation parses and validates an event: well‑formed JSON of the
+// right types, a known action, a numeric user, no negative days, months as
+// YYYY-MM and, for Function URL requests, numeric user IDs and ISO dates in
+// the query parameters shared across paths. Path‑specific parameters are
+// still checked by their handlers.
+func decodeInvocation(event json.RawMessage) (invocation, error) {
+	var inv invocation
+	var ps fieldProblems
+	if err := json.Unmarshal(event, &inv); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			ps = append(ps, fieldProblem{Field: typeErr.Field, Problem: fmt.Sprintf("wrong type: want %s, got %s", typeErr.Type, typeErr.Value)})
+		} else {
+			return inv, &validationError{problems: []fieldProblem{{Field: "event", Problem: "not a JSON object: " + err.Error()}}}
+		}
+	}
+	if inv.Action != "" && !knownActions[inv.Action] {
+		ps = append(ps, fieldProblem{Field: "action", Problem: fmt.Sprintf("unknown action %q", inv.Action)})
+	}
+	ps.check("user", inv.User, checkID)
+	if inv.Days < 0 {
+		ps = append(ps, fieldProblem{Field: "days", Problem: "want a positive number of days"})
+	}
+	ps.check("month", inv.Month, func(s string) error {
+		if _, err := time.Parse("2006-01", s); err != nil {
+			return errors.New("want a month as YYYY-MM")
+		}
+		return nil
+	})
+	for _, name := range []string{"user", "a", "b"} {
+		ps.check(name, inv.QueryParams[name], checkID)
+	}
+	for _, name := range []string{"date", "from", "to"} {
+		ps.check(name, inv.QueryParams[name], checkDate)
+	}
+	return inv, ps.err()
+}
+
+// validateJob checks a refresh job from the queue.
+func validateJob(job refreshJob) error {
+	var ps fieldProblems
+	if job.UserID == "" {
+		ps = append(ps, fieldProblem{Field: "user_id", Problem: "required"})
+	}
+	ps.check("user_id", job.UserID, checkID)
+	ps.check("date", job.Date, checkDate)
+	if job.Attempt < 0 {
+		ps = append(ps, fieldProblem{Field: "attempt", Problem: "want a whole number"})
+	}
+	return ps.err()
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"time"
+)
+
+// velocity returns the average points per day and owns per week between the
+// oldest snapshot in points and latest, and the number of days measured.
+func velocity(points []map[string]interface{}, latest map[string]interface{}, day time.Time) (pointsPerDay, ownsPerWeek float64, days int, ok bool) {
+	newPts, okPts := toFloat(latest["Points"])
+	newOwns, okOwns := totalOwns(latest)
+	for _, old := range points {
+		d, err := time.Parse("2006-01-02", fmt.Sprint(old["date"]))
+		if err != nil {
+			continue
+		}
+		span := day.Sub(d).Hours() / 24
+		if span < 1 {
+			break
+		}
+		oldPts, okOldPts := toFloat(old["Points"])
+		oldOwns, okOldOwns := totalOwns(old)
+		if !(okPts && okOldPts) && !(okOwns && okOldOwns) {
+			continue
+		}
+		if okPts && okOldPts {
+			pointsPerDay = math.Round((newPts-oldPts)/span*10) / 10
+		}
+		if okOwns && okOldOwns {
+			ownsPerWeek = math.Round((newOwns-oldOwns)/span*7*10) / 10
+		}
+		return pointsPerDay, ownsPerWeek, int(span), true
+	}
+	return 0, 0, 0, false
+}
+
+// paceFields measures info against userID’s previous projectionWindow days
+// and returns the rolling Points_Per_Day, Owns_Per_Week (over Pace_Days) and
+// Projected_Next_Rank_Date to store with the snapshot.
+func paceFields(ctx context.Context, tableName, userID string, day time.Time, info map[string]interface{}) map[string]interface{} {
+	items, err := loadRange(ctx, tableName, userID, day.AddDate(0, 0, -projectionWindow), day.AddDate(0, 0, -1))
+	if err != nil {
+		slog.ErrorContext(ctx, "BatchGetItem failed", "region", awsRegion, "table", tableName, "error", err)
+		return nil
+	}
+	points := series(items)
+	fields := map[string]interface{}{}
+	if perDay, perWeek, days, ok := velocity(points, info, day); ok {
+		fields["Points_Per_Day"] = perDay
+		fields["Owns_Per_Week"] = perWeek
+		fields["Pace_Days"] = days
+	}
+	if p := projectRank(points, info, day); p.ProjectedDate != "" {
+		fields["Projected_Next_Rank_Date"] = p.ProjectedDate
+	}
+	return fields
+}